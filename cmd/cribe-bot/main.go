@@ -1,6 +1,7 @@
 package main
 
 import (
+	"expvar"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,9 +13,18 @@ import (
 	"github.com/robotomize/cribe/internal/logging"
 	"github.com/robotomize/cribe/internal/shutdown"
 	"github.com/robotomize/cribe/internal/srvenv"
+	"github.com/robotomize/cribe/internal/storage"
 )
 
 func main() {
+	ctx, cancel := shutdown.New()
+	defer cancel()
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrateCommand(ctx)
+		return
+	}
+
 	fmt.Fprintf(os.Stdout, buildinfo.Graffiti)
 	_, _ = fmt.Fprintf(
 		os.Stdout,
@@ -24,8 +34,6 @@ func main() {
 		buildinfo.TgBloopURL,
 		buildinfo.GithubBloopURL,
 	)
-	ctx, cancel := shutdown.New()
-	defer cancel()
 	env, err := srvenv.Setup(ctx)
 	if err != nil {
 		log.Fatalf("setup: %v", err)
@@ -38,7 +46,7 @@ func main() {
 		With("build_time", buildinfo.Info.Time())
 	ctx = logging.WithLogger(ctx, logger)
 
-	defer env.AMQP().Close() // nolint
+	defer env.Close() // nolint
 
 	mux := http.NewServeMux()
 	mux.HandleFunc(
@@ -47,6 +55,10 @@ func main() {
 		},
 	)
 	mux.Handle("/debug/pprof/", http.Handler(http.DefaultServeMux))
+	mux.Handle("/debug/vars", expvar.Handler())
+	if downloads := env.Downloads(); downloads != nil {
+		mux.Handle(storage.DownloadPath, downloads)
+	}
 
 	go func() {
 		if err = http.ListenAndServe(cfg.Addr, mux); err != nil { // nolint
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/robotomize/cribe/internal/db"
+	"github.com/sethvargo/go-envconfig"
+)
+
+const migrateUsage = `usage: cribe-bot migrate <command>
+
+commands:
+  up [N]       apply all or N pending migrations
+  down [N]     roll back N migrations, 1 by default
+  status       print the current schema version
+  force V      set the schema version to V and clear the dirty flag
+`
+
+// runMigrate runs the migrate subcommand against the database configured by the DB_* env variables
+func runMigrate(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(out, migrateUsage)
+
+		return errors.New("missing migrate command")
+	}
+
+	var cfg db.Config
+	if err := envconfig.Process(ctx, &cfg); err != nil {
+		return fmt.Errorf("env processing: %w", err)
+	}
+
+	if cfg.Type != db.TypePostgres {
+		return fmt.Errorf("migrations apply to postgres only, DB_TYPE is %q", cfg.Type)
+	}
+
+	m, err := db.NewMigrate(&cfg)
+	if err != nil {
+		return err
+	}
+
+	defer m.Close()
+
+	steps := func(def int) (int, error) {
+		if len(args) < 2 {
+			return def, nil
+		}
+
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid number of migrations %q", args[1])
+		}
+
+		return n, nil
+	}
+
+	switch args[0] {
+	case "up":
+		n, err := steps(0)
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			err = m.Up()
+		} else {
+			err = m.Steps(n)
+		}
+
+		if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return fmt.Errorf("migrate up: %w", err)
+		}
+	case "down":
+		n, err := steps(1)
+		if err != nil {
+			return err
+		}
+
+		if err = m.Steps(-n); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return fmt.Errorf("migrate down: %w", err)
+		}
+	case "status":
+	case "force":
+		if len(args) < 2 {
+			return errors.New("missing version to force")
+		}
+
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+
+		if err = m.Force(version); err != nil {
+			return fmt.Errorf("migrate force: %w", err)
+		}
+	default:
+		fmt.Fprint(out, migrateUsage)
+
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+
+	version, dirty, err := m.Version()
+	if err != nil {
+		if errors.Is(err, migrate.ErrNilVersion) {
+			fmt.Fprintln(out, "version: none")
+
+			return nil
+		}
+
+		return fmt.Errorf("migrate version: %w", err)
+	}
+
+	fmt.Fprintf(out, "version: %d, dirty: %t\n", version, dirty)
+
+	return nil
+}
+
+func migrateCommand(ctx context.Context) {
+	if err := runMigrate(ctx, os.Args[2:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+		os.Exit(1)
+	}
+}
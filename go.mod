@@ -17,6 +17,7 @@ require (
 	github.com/nicksnyder/go-i18n/v2 v2.1.2
 	github.com/sethvargo/go-envconfig v0.3.5
 	github.com/streadway/amqp v1.0.0
+	go.etcd.io/bbolt v1.3.6
 	go.uber.org/zap v1.19.1
 	golang.org/x/text v0.14.0
 	golang.org/x/tools v0.6.0
@@ -48,4 +49,6 @@ require (
 
 replace github.com/go-telegram-bot-api/telegram-bot-api => github.com/robotomize/telegram-bot-api v1.0.1-0.20211011211313-ce26e93d1e9e
 
-replace github.com/kkdai/youtube/v2 v2.7.4 => github.com/robotomize/youtube/v2 v2.7.5-0.20211019164800-6ee21b82f993
+// the library package of robotomize/youtube exposing the channel id, view count and keywords of videos,
+// carried in third_party/youtube until the change is pushed to the fork
+replace github.com/kkdai/youtube/v2 v2.7.4 => ./third_party/youtube
@@ -3,6 +3,7 @@ package bot
 import (
 	"context"
 	"io"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 	"github.com/kkdai/youtube/v2"
@@ -20,11 +21,47 @@ type (
 
 	MetadataDB interface {
 		FetchByMetadata(ctx context.Context, videoID string, mime string, quality string) (db.Metadata, error)
+		FetchByKeys(ctx context.Context, keys []db.MetadataKey) ([]db.Metadata, error)
 		Save(ctx context.Context, model db.Metadata) error
+		SaveBatch(ctx context.Context, models []db.Metadata) error
+		Touch(ctx context.Context, videoID string, mime string, quality string, at time.Time) error
+	}
+
+	// LinkDB keeps the expiry of the download links to stored objects, it is read past the metadata cache
+	LinkDB interface {
+		FetchByMetadata(ctx context.Context, videoID string, mime string, quality string) (db.Metadata, error)
+		ExtendLink(ctx context.Context, videoID string, mime string, quality string, at time.Time) error
+	}
+
+	UsageDB interface {
+		MostRequested(ctx context.Context, limit int) ([]db.Metadata, error)
+		PurgeUnused(ctx context.Context, before time.Time, archive bool) ([]db.MetadataKey, error)
+	}
+
+	UserDB interface {
+		Upsert(ctx context.Context, model db.User) error
+		SetBlocked(ctx context.Context, id int64, blocked bool) error
+	}
+
+	ChatDB interface {
+		Upsert(ctx context.Context, model db.Chat) error
+		SetBlocked(ctx context.Context, id int64, blocked bool) error
+	}
+
+	HistoryDB interface {
+		FetchByID(ctx context.Context, id int64) (db.Request, error)
+		ListByUser(ctx context.Context, userID int64, limit, offset int) ([]db.Request, error)
+		Save(ctx context.Context, model db.Request) error
+	}
+
+	UnavailableDB interface {
+		FetchByVideoID(ctx context.Context, videoID string) (db.Unavailable, error)
+		Save(ctx context.Context, model db.Unavailable) error
 	}
 
 	TelegramSender interface {
 		Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+		AnswerCallbackQuery(config tgbotapi.CallbackConfig) (tgbotapi.APIResponse, error)
 		UploadFileWithContext(ctx context.Context, endpoint string, params map[string]string, fieldname string, file interface{}) (tgbotapi.APIResponse, error)
 	}
 
@@ -45,4 +82,8 @@ type (
 		DeleteObject(ctx context.Context, bucket, key string) error
 		GetObject(ctx context.Context, bucket, key string) ([]byte, error)
 	}
+
+	URLSigner interface {
+		SignedURL(ctx context.Context, bucket, key, filename string, ttl time.Duration) (string, error)
+	}
 )
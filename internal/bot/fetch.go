@@ -6,23 +6,78 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"sort"
-	"strings"
 	"time"
 
+	"github.com/kkdai/youtube/v2"
 	"github.com/robotomize/cribe/internal/db"
+	"github.com/robotomize/cribe/internal/logging"
 	"github.com/robotomize/cribe/internal/storage"
 	"github.com/streadway/amqp"
 )
 
-func (s *Dispatcher) fetch(ctx context.Context, queue AMQPChannel, payload Payload) error {
+// DefaultQuality is the only quality fetched so far, objects under legacy keys always have it
+const DefaultQuality = "hd720"
+
+// getObject reads the stored video format, moving it from the legacy video ID key when found there
+func (s *Dispatcher) getObject(ctx context.Context, payload Payload) ([]byte, error) {
+	key := storage.ObjectKey(payload.VideoID, payload.Mime, payload.Quality)
+	b, err := s.storage.GetObject(ctx, s.opts.Bucket, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) && payload.Quality == DefaultQuality {
+			return storage.MigrateObject(ctx, s.storage, s.opts.Bucket, storage.LegacyObjectKey(payload.VideoID), key)
+		}
+
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// errTooLarge is returned for a video too large to be sent, or to be shared with a link when there is a signer
+var errTooLarge = errors.New("video is too large")
+
+// readStream downloads the format. A video is not downloaded past the upload limit, or past the link size
+// limit when it can be shared with a link, and errTooLarge is returned
+func (s *Dispatcher) readStream(ctx context.Context, video *youtube.Video, format *youtube.Format) ([]byte, error) {
+	stream, size, err := s.youtubeClient.GetStreamContext(ctx, video, format)
+	if err != nil {
+		return nil, fmt.Errorf("get video stream: %w", err)
+	}
+
+	defer stream.Close()
+
+	limit := s.opts.MaxUploadSize
+	if s.signer != nil {
+		limit = s.opts.MaxLinkSize
+	}
+
+	if size > limit {
+		return nil, errTooLarge
+	}
+
+	// the content length is unknown for some formats
+	buf, err := io.ReadAll(io.LimitReader(stream, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("read stream: %w", err)
+	}
+
+	if int64(len(buf)) > limit {
+		return nil, errTooLarge
+	}
+
+	return buf, nil
+}
+
+// fetch stores the video of the payload and queues its upload. The format is resolved into the payload,
+// so a failure is recorded against it
+func (s *Dispatcher) fetch(ctx context.Context, sender TelegramSender, queue AMQPChannel, payload *Payload) error {
 	client := s.youtubeClient
 	video, err := client.GetVideoContext(ctx, payload.VideoID)
 	if err != nil {
 		return fmt.Errorf("parsing video metadata: %w", err)
 	}
 
-	format := video.Formats.WithAudioChannels().FindByQuality("hd720")
+	format := video.Formats.WithAudioChannels().FindByQuality(DefaultQuality)
 	if format == nil {
 		return errors.New("video format not found")
 	}
@@ -32,6 +87,7 @@ func (s *Dispatcher) fetch(ctx context.Context, queue AMQPChannel, payload Paylo
 
 	encoded, err := json.Marshal(Payload{
 		ChatID:  payload.ChatID,
+		UserID:  payload.UserID,
 		VideoID: payload.VideoID,
 		Mime:    payload.Mime,
 		Quality: payload.Quality,
@@ -43,14 +99,13 @@ func (s *Dispatcher) fetch(ctx context.Context, queue AMQPChannel, payload Paylo
 	metadata, err := s.metadataDB.FetchByMetadata(ctx, payload.VideoID, payload.Mime, payload.Quality)
 	if err != nil {
 		if errors.Is(err, db.ErrNotFound) {
-			stream, _, err := client.GetStreamContext(ctx, video, format)
+			buf, err := s.readStream(ctx, video, format)
 			if err != nil {
-				return fmt.Errorf("get video stream: %w", err)
-			}
+				if errors.Is(err, errTooLarge) {
+					return s.rejectTooLarge(ctx, sender, *payload)
+				}
 
-			buf, err := io.ReadAll(stream)
-			if err != nil {
-				return fmt.Errorf("real stream: %w", err)
+				return err
 			}
 
 			select {
@@ -59,43 +114,20 @@ func (s *Dispatcher) fetch(ctx context.Context, queue AMQPChannel, payload Paylo
 			default:
 			}
 
-			if _, err := s.storage.GetObject(ctx, s.opts.Bucket, video.ID); err != nil {
+			key := storage.ObjectKey(video.ID, payload.Mime, payload.Quality)
+			if _, err := s.storage.GetObject(ctx, s.opts.Bucket, key); err != nil {
 				if errors.Is(err, storage.ErrNotFound) {
-					if err = s.storage.CreateObject(ctx, s.opts.Bucket, video.ID, buf); err != nil {
+					if err = s.storage.CreateObject(ctx, s.opts.Bucket, key, buf); err != nil {
 						return fmt.Errorf("create object to storage: %w", err)
 					}
 				}
 			}
 
-			// sort preview by telegram constrain
-			sort.Slice(video.Thumbnails, func(i, j int) bool {
-				w1, w2 := video.Thumbnails[i].Width, video.Thumbnails[j].Width
-				h1, h2 := video.Thumbnails[i].Height, video.Thumbnails[j].Height
-
-				return w1 > w2 && h1 > h2 && w1 <= 320 && h1 <= 320
-			})
-
-			var thumb string
-			if len(video.Thumbnails) > 0 {
-				idx := strings.Index(video.Thumbnails[0].URL, "?")
-				if idx > -1 {
-					thumb = video.Thumbnails[0].URL[:idx]
-				} else {
-					thumb = ""
-				}
-			}
-
 			if err = s.metadataDB.Save(ctx, db.Metadata{
-				VideoID: payload.VideoID,
-				Quality: payload.Quality,
-				Mime:    payload.Mime,
-				Params: db.VideoParams{
-					Title:    video.Title,
-					Width:    format.Width,
-					Height:   format.Height,
-					Duration: int(video.Duration.Seconds()),
-					Thumb:    thumb,
-				},
+				VideoID:   payload.VideoID,
+				Quality:   payload.Quality,
+				Mime:      payload.Mime,
+				Params:    newVideoParams(video, format),
 				FileID:    "",
 				CreatedAt: time.Now(),
 				UpdatedAt: time.Now(),
@@ -118,25 +150,28 @@ func (s *Dispatcher) fetch(ctx context.Context, queue AMQPChannel, payload Paylo
 		return fmt.Errorf("fetch metadata: %w", err)
 	}
 
+	s.backfillParams(ctx, metadata, video, format)
+
 	if metadata.FileID == "" {
-		if _, err = s.storage.GetObject(ctx, s.opts.Bucket, payload.VideoID); err != nil {
+		if _, err = s.getObject(ctx, *payload); err != nil {
 			if errors.Is(err, storage.ErrNotFound) {
-				format := video.Formats.WithAudioChannels().FindByQuality("hd720")
+				format := video.Formats.WithAudioChannels().FindByQuality(DefaultQuality)
 				if format == nil {
 					return fmt.Errorf("video format not found: %w", err)
 				}
 
-				stream, _, err := client.GetStreamContext(ctx, video, format)
+				buf, err := s.readStream(ctx, video, format)
 				if err != nil {
-					return fmt.Errorf("get video stream: %w", err)
-				}
+					if errors.Is(err, errTooLarge) {
+						return s.rejectTooLarge(ctx, sender, *payload)
+					}
 
-				buf, err := io.ReadAll(stream)
-				if err != nil {
-					return fmt.Errorf("real stream: %w", err)
+					return err
 				}
 
-				if err = s.storage.CreateObject(ctx, s.opts.Bucket, payload.VideoID, buf); err != nil {
+				if err = s.storage.CreateObject(
+					ctx, s.opts.Bucket, storage.ObjectKey(payload.VideoID, payload.Mime, payload.Quality), buf,
+				); err != nil {
 					return fmt.Errorf("create object to storage: %w", err)
 				}
 
@@ -177,3 +212,45 @@ func (s *Dispatcher) fetch(ctx context.Context, queue AMQPChannel, payload Paylo
 
 	return nil
 }
+
+// backfillParams rewrites the params saved by an older fetcher, the video is at hand anyway. Every stored
+// format of the video is read and saved in a single batch, so the formats not fetched any longer are
+// backfilled too. The backfill is best effort and never fails the fetch
+func (s *Dispatcher) backfillParams(ctx context.Context, metadata db.Metadata, video *youtube.Video, format *youtube.Format) {
+	if metadata.Params.Version >= db.VideoParamsVersion {
+		return
+	}
+
+	logger := logging.FromContext(ctx).Named("Dispatcher.backfillParams")
+
+	key := db.MetadataKey{VideoID: metadata.VideoID, Mime: metadata.Mime, Quality: metadata.Quality}
+	formats := map[db.MetadataKey]*youtube.Format{key: format}
+	keys := []db.MetadataKey{key}
+	for i := range video.Formats {
+		key := db.MetadataKey{VideoID: metadata.VideoID, Mime: video.Formats[i].MimeType, Quality: video.Formats[i].Quality}
+		if _, ok := formats[key]; !ok {
+			formats[key] = &video.Formats[i]
+			keys = append(keys, key)
+		}
+	}
+
+	stored, err := s.metadataDB.FetchByKeys(ctx, keys)
+	if err != nil {
+		logger.Errorf("fetching metadata: %v", err)
+		return
+	}
+
+	stale := make([]db.Metadata, 0, len(stored))
+	for _, model := range stored {
+		if model.Params.Version < db.VideoParamsVersion {
+			model.Params = newVideoParams(
+				video, formats[db.MetadataKey{VideoID: model.VideoID, Mime: model.Mime, Quality: model.Quality}],
+			)
+			stale = append(stale, model)
+		}
+	}
+
+	if err = s.metadataDB.SaveBatch(ctx, stale); err != nil {
+		logger.Errorf("saving metadata: %v", err)
+	}
+}
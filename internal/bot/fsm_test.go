@@ -0,0 +1,59 @@
+package bot
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files of testdata")
+
+// TestFSMDiagram keeps the diagrams of the conversation current, run it with -update after changing fsmStates
+func TestFSMDiagram(t *testing.T) {
+	t.Parallel()
+
+	if _, err := provideFSM(); err != nil {
+		t.Fatalf("provideFSM: %v", err)
+	}
+
+	testCases := []struct {
+		name   string
+		golden string
+		render func() string
+	}{
+		{
+			name:   "test_dot",
+			golden: "fsm.dot",
+			render: fsmStates().DOT,
+		},
+		{
+			name:   "test_mermaid",
+			golden: "fsm.mmd",
+			render: fsmStates().Mermaid,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join("testdata", tc.golden)
+			got := tc.render()
+			if *update {
+				if err := os.WriteFile(path, []byte(got), 0o600); err != nil {
+					t.Fatalf("write golden file: %v", err)
+				}
+			}
+
+			expected, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("read golden file: %v", err)
+			}
+
+			if got != string(expected) {
+				t.Errorf("%s is stale, run go test ./internal/bot -run TestFSMDiagram -update\ngot:\n%s", path, got)
+			}
+		})
+	}
+}
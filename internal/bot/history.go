@@ -0,0 +1,230 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/robotomize/cribe/internal/db"
+	"github.com/robotomize/cribe/internal/logging"
+)
+
+const (
+	HistoryPageSize       = 5
+	HistoryMessage        = "Your downloads"
+	HistoryEmptyMessage   = "You have not downloaded anything yet"
+	HistoryExpiredMessage = "This download is no longer available"
+	StartDownloadMessage  = "Starting to download the video"
+)
+
+// callback data of the history keyboard, the argument is a page number or a request id
+const (
+	historyPageCallback = "history:page:"
+	historySendCallback = "history:send:"
+)
+
+const historyTitleMaxLen = 48
+
+// recordOutcome saves the payload request to the user history, a history failure never fails the job. A payload
+// whose format is not resolved yet is kept apart from the requests of the formats, see db.RequestStore
+func (s *Dispatcher) recordOutcome(ctx context.Context, payload Payload, outcome db.RequestOutcome) {
+	if payload.UserID == 0 {
+		return
+	}
+
+	now := time.Now()
+	if err := s.historyDB.Save(ctx, db.Request{
+		UserID:    payload.UserID,
+		ChatID:    payload.ChatID,
+		VideoID:   payload.VideoID,
+		Mime:      payload.Mime,
+		Quality:   payload.Quality,
+		Outcome:   outcome,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}); err != nil {
+		logging.FromContext(ctx).Named("Dispatcher.recordOutcome").Errorf("save request history: %v", err)
+	}
+}
+
+func (s *Dispatcher) handleHistoryCommand(ctx context.Context, sender TelegramSender, message *tgbotapi.Message) error {
+	text, markup, err := s.historyPage(ctx, int64(message.From.ID), 0)
+	if err != nil {
+		return err
+	}
+
+	config := tgbotapi.NewMessage(message.Chat.ID, text)
+	if markup != nil {
+		config.ReplyMarkup = *markup
+	}
+
+	if _, err = sender.Send(config); err != nil {
+		return fmt.Errorf("send message: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Dispatcher) handleCallback(ctx context.Context, sender TelegramSender, query *tgbotapi.CallbackQuery) error {
+	var err error
+	switch {
+	case strings.HasPrefix(query.Data, historyPageCallback):
+		err = s.handleHistoryPage(ctx, sender, query)
+	case strings.HasPrefix(query.Data, historySendCallback):
+		err = s.handleHistorySend(ctx, sender, query)
+	}
+
+	// stop the button spinner whatever the outcome is
+	if _, answerErr := sender.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, "")); answerErr != nil && err == nil {
+		err = fmt.Errorf("answer callback query: %w", answerErr)
+	}
+
+	return err
+}
+
+func (s *Dispatcher) handleHistoryPage(ctx context.Context, sender TelegramSender, query *tgbotapi.CallbackQuery) error {
+	if query.Message == nil {
+		return nil
+	}
+
+	page, err := strconv.Atoi(strings.TrimPrefix(query.Data, historyPageCallback))
+	if err != nil || page < 0 {
+		return fmt.Errorf("invalid history page %q", query.Data)
+	}
+
+	text, markup, err := s.historyPage(ctx, int64(query.From.ID), page)
+	if err != nil {
+		return err
+	}
+
+	config := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+	config.ReplyMarkup = markup
+	if _, err = sender.Send(config); err != nil {
+		return fmt.Errorf("edit message: %w", err)
+	}
+
+	return nil
+}
+
+// handleHistorySend resends the video of a history entry, the cached file id is used when there is one
+func (s *Dispatcher) handleHistorySend(ctx context.Context, sender TelegramSender, query *tgbotapi.CallbackQuery) error {
+	if query.Message == nil {
+		return nil
+	}
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(query.Data, historySendCallback), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid history entry %q", query.Data)
+	}
+
+	chatID := query.Message.Chat.ID
+	request, err := s.historyDB.FetchByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			if _, err = sender.Send(tgbotapi.NewMessage(chatID, HistoryExpiredMessage)); err != nil {
+				return fmt.Errorf("send message: %w", err)
+			}
+
+			return nil
+		}
+
+		return fmt.Errorf("fetch history entry: %w", err)
+	}
+
+	// callback data comes from the client, an entry is only resent to its owner
+	if request.UserID != int64(query.From.ID) {
+		return nil
+	}
+
+	payload := Payload{
+		VideoID: request.VideoID,
+		Mime:    request.Mime,
+		Quality: request.Quality,
+		ChatID:  chatID,
+		UserID:  request.UserID,
+	}
+
+	metadata, err := s.metadataDB.FetchByMetadata(ctx, request.VideoID, request.Mime, request.Quality)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return fmt.Errorf("fetching metadata: %w", err)
+	}
+
+	if err == nil && metadata.FileID != "" {
+		return s.shareVideo(ctx, sender, metadata, payload)
+	}
+
+	if err = s.enqueueFetch(payload); err != nil {
+		return err
+	}
+
+	if _, err = sender.Send(tgbotapi.NewMessage(chatID, StartDownloadMessage)); err != nil {
+		return fmt.Errorf("send message: %w", err)
+	}
+
+	return nil
+}
+
+// historyPage renders a page of the user history as a message text and an inline keyboard
+func (s *Dispatcher) historyPage(
+	ctx context.Context, userID int64, page int,
+) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	// one extra entry tells whether there is a next page
+	requests, err := s.historyDB.ListByUser(ctx, userID, HistoryPageSize+1, page*HistoryPageSize)
+	if err != nil {
+		return "", nil, fmt.Errorf("list history: %w", err)
+	}
+
+	if len(requests) == 0 && page == 0 {
+		return HistoryEmptyMessage, nil, nil
+	}
+
+	hasNext := len(requests) > HistoryPageSize
+	if hasNext {
+		requests = requests[:HistoryPageSize]
+	}
+
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(requests)+1)
+	for _, request := range requests {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(
+				historyLabel(request), historySendCallback+strconv.FormatInt(request.ID, 10),
+			),
+		))
+	}
+
+	var nav []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("« Prev", historyPageCallback+strconv.Itoa(page-1)))
+	}
+
+	if hasNext {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("Next »", historyPageCallback+strconv.Itoa(page+1)))
+	}
+
+	if len(nav) > 0 {
+		rows = append(rows, nav)
+	}
+
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	return fmt.Sprintf("%s, page %d", HistoryMessage, page+1), &markup, nil
+}
+
+func historyLabel(request db.Request) string {
+	title := request.Title
+	if title == "" {
+		title = request.VideoID
+	}
+
+	title = truncate(title, historyTitleMaxLen)
+
+	if request.Quality != "" {
+		title += " (" + request.Quality + ")"
+	}
+
+	return title
+}
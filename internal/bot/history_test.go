@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/robotomize/cribe/internal/db"
+)
+
+func TestDispatcher_historyPage(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		page     int
+		found    int
+		text     string
+		rows     int
+		navigate int
+	}{
+		{
+			name: "test_empty",
+			text: HistoryEmptyMessage,
+		},
+		{
+			name:  "test_single_page",
+			found: 3,
+			text:  HistoryMessage + ", page 1",
+			rows:  3,
+		},
+		{
+			name:     "test_first_of_many",
+			found:    HistoryPageSize + 1,
+			text:     HistoryMessage + ", page 1",
+			rows:     HistoryPageSize + 1,
+			navigate: 1,
+		},
+		{
+			name:     "test_middle_page",
+			page:     1,
+			found:    HistoryPageSize + 1,
+			text:     HistoryMessage + ", page 2",
+			rows:     HistoryPageSize + 1,
+			navigate: 2,
+		},
+		{
+			name:     "test_last_page",
+			page:     2,
+			found:    1,
+			text:     HistoryMessage + ", page 3",
+			rows:     2,
+			navigate: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ctrl := gomock.NewController(t)
+			history := NewMockHistoryDB(ctrl)
+
+			requests := make([]db.Request, 0, tc.found)
+			for i := 0; i < tc.found; i++ {
+				requests = append(requests, db.Request{ID: int64(i), VideoID: fmt.Sprintf("video-%d", i), Quality: "hd720"})
+			}
+
+			history.
+				EXPECT().
+				ListByUser(gomock.Any(), int64(1), HistoryPageSize+1, tc.page*HistoryPageSize).
+				Return(requests, nil)
+
+			d := &Dispatcher{historyDB: history}
+			text, markup, err := d.historyPage(context.Background(), 1, tc.page)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if text != tc.text {
+				t.Errorf("got: %q, expected: %q", text, tc.text)
+			}
+
+			if tc.rows == 0 {
+				if markup != nil {
+					t.Errorf("got: %v, expected no keyboard", markup)
+				}
+				return
+			}
+
+			if got := len(markup.InlineKeyboard); got != tc.rows {
+				t.Errorf("got: %d rows, expected: %d", got, tc.rows)
+			}
+
+			if tc.navigate > 0 {
+				if got := len(markup.InlineKeyboard[len(markup.InlineKeyboard)-1]); got != tc.navigate {
+					t.Errorf("got: %d navigation buttons, expected: %d", got, tc.navigate)
+				}
+			}
+		})
+	}
+}
+
+func TestHistoryLabel(t *testing.T) {
+	t.Parallel()
+
+	long := db.Request{VideoID: "id", Quality: "hd720", Title: string(make([]rune, 100))}
+	if got := []rune(historyLabel(long)); len(got) != historyTitleMaxLen+len(" (hd720)") {
+		t.Errorf("got: %d runes, expected a truncated title", len(got))
+	}
+
+	if got, want := historyLabel(db.Request{VideoID: "id"}), "id"; got != want {
+		t.Errorf("got: %q, expected: %q", got, want)
+	}
+}
@@ -0,0 +1,178 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/robotomize/cribe/internal/db"
+	"github.com/robotomize/cribe/internal/logging"
+	"github.com/robotomize/cribe/internal/storage"
+	"github.com/streadway/amqp"
+)
+
+const (
+	TooLargeMessage     = "The video is too large to be sent via Telegram"
+	DownloadLinkMessage = "The video is too large to be sent via Telegram, download it here:\n%s\n\nThe link is valid until %s"
+)
+
+// expiringQueue returns the queue holding shared objects for the link TTL. The TTL is part of the name
+// since a declared queue can not change its arguments
+func (s *Dispatcher) expiringQueue() string {
+	return QueueExpiring + "." + strconv.FormatInt(s.opts.LinkTTL.Milliseconds(), 10)
+}
+
+func (s *Dispatcher) declareExpiringQueue(channel AMQPChannel) error {
+	if _, err := channel.QueueDeclare(
+		s.expiringQueue(), true, false, false, false, amqp.Table{
+			"x-message-ttl":             s.opts.LinkTTL.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": QueueDeleting,
+		},
+	); err != nil {
+		return fmt.Errorf("can not declare broker queue: %w", err)
+	}
+
+	return nil
+}
+
+// rejectTooLarge tells the user the video is too large to be sent and there is no signer to share a link to it
+func (s *Dispatcher) rejectTooLarge(ctx context.Context, sender TelegramSender, payload Payload) error {
+	if _, err := sender.Send(tgbotapi.NewMessage(payload.ChatID, TooLargeMessage)); err != nil {
+		return fmt.Errorf("send message: %w", err)
+	}
+
+	s.recordOutcome(ctx, payload, db.OutcomeTooLarge)
+
+	return nil
+}
+
+// shareLink keeps a video too large for telegram in storage for the link TTL and sends the user a signed link to it
+func (s *Dispatcher) shareLink(
+	ctx context.Context, sender TelegramSender, channel AMQPChannel, metadata db.Metadata, payload Payload,
+) error {
+	key := storage.ObjectKey(payload.VideoID, payload.Mime, payload.Quality)
+	if s.signer == nil {
+		if err := s.rejectTooLarge(ctx, sender, payload); err != nil {
+			return err
+		}
+
+		// fetching no longer stores such videos without a signer, this one was stored before
+		return s.storage.DeleteObject(ctx, s.opts.Bucket, key)
+	}
+
+	expiresAt := time.Now().Add(s.opts.LinkTTL)
+	link, err := s.signer.SignedURL(
+		ctx, s.opts.Bucket, key, storage.ObjectFilename(metadata.VideoID, metadata.Mime), s.opts.LinkTTL,
+	)
+	if err != nil {
+		return fmt.Errorf("sign download link: %w", err)
+	}
+
+	// the object outlives the removals scheduled by the older links, see deleteExpiredObject
+	if err = s.linkDB.ExtendLink(ctx, metadata.VideoID, metadata.Mime, metadata.Quality, expiresAt); err != nil {
+		return fmt.Errorf("extend link: %w", err)
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal expiring payload: %w", err)
+	}
+
+	if err = s.declareExpiringQueue(channel); err != nil {
+		return err
+	}
+
+	if err = channel.Publish(
+		"", s.expiringQueue(), false, false, amqp.Publishing{
+			ContentType: "application/json",
+			Body:        encoded,
+		},
+	); err != nil {
+		return fmt.Errorf("publish to expiring queue: %w", err)
+	}
+
+	if _, err = sender.Send(
+		tgbotapi.NewMessage(
+			payload.ChatID,
+			fmt.Sprintf(DownloadLinkMessage, link, expiresAt.UTC().Format("2006-01-02 15:04 MST")),
+		),
+	); err != nil {
+		return fmt.Errorf("send message: %w", err)
+	}
+
+	s.recordOutcome(ctx, payload, db.OutcomeLink)
+
+	return nil
+}
+
+func (s *Dispatcher) consumingExpiredObjects(ctx context.Context) error {
+	channel, err := s.broker.Chan()
+	if err != nil {
+		return fmt.Errorf("can not create broker channel: %w", err)
+	}
+
+	defer channel.Close()
+
+	if _, err = channel.QueueDeclare(QueueDeleting, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("can not declare broker queue: %w", err)
+	}
+
+	if err = s.declareExpiringQueue(channel); err != nil {
+		return err
+	}
+
+	logger := logging.FromContext(ctx).Named("Dispatcher.consumingExpiredObjects")
+	messages, err := channel.Consume(QueueDeleting, "", true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("amqp consume deleting: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		if err = channel.Close(); err != nil {
+			logger.Errorf("broker channel close: %v", err)
+		}
+	}()
+
+	for message := range messages {
+		var payload Payload
+		if err = json.Unmarshal(message.Body, &payload); err != nil {
+			logger.Errorf("json unmarshal: %v", err)
+			continue
+		}
+
+		if err = s.deleteExpiredObject(ctx, payload); err != nil {
+			if !errors.Is(err, context.Canceled) {
+				logger.Errorf("deleting expired object: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// deleteExpiredObject removes a shared object once every link to it has expired. The payload is dead-lettered
+// after the link TTL, so only a link issued later can still be valid
+func (s *Dispatcher) deleteExpiredObject(ctx context.Context, payload Payload) error {
+	metadata, err := s.linkDB.FetchByMetadata(ctx, payload.VideoID, payload.Mime, payload.Quality)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return fmt.Errorf("fetching metadata: %w", err)
+	}
+
+	if err == nil && metadata.LinkExpiresAt.After(time.Now()) {
+		return nil
+	}
+
+	if err = s.storage.DeleteObject(
+		ctx, s.opts.Bucket, storage.ObjectKey(payload.VideoID, payload.Mime, payload.Quality),
+	); err != nil {
+		return fmt.Errorf("delete object from storage: %w", err)
+	}
+
+	return nil
+}
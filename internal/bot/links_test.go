@@ -0,0 +1,243 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/golang/mock/gomock"
+	"github.com/kkdai/youtube/v2"
+	"github.com/robotomize/cribe/internal/db"
+	"github.com/robotomize/cribe/internal/storage"
+)
+
+func TestDispatcher_shareLink(t *testing.T) {
+	t.Parallel()
+
+	metadata := db.Metadata{VideoID: "video", Mime: `video/webm; codecs="vp9"`, Quality: "hd720"}
+	payload := Payload{VideoID: "video", Mime: metadata.Mime, Quality: "hd720", ChatID: 1}
+	key := storage.ObjectKey("video", metadata.Mime, "hd720")
+
+	testCases := []struct {
+		name      string
+		signer    bool
+		extendErr error
+		err       bool
+	}{
+		{
+			name:   "test_shared",
+			signer: true,
+		},
+		{
+			name: "test_no_signer",
+		},
+		{
+			name:      "test_extend_error",
+			signer:    true,
+			extendErr: errors.New("mock error"),
+			err:       true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ctrl := gomock.NewController(t)
+			sender := NewMockTelegramSender(ctrl)
+			linkDB := NewMockLinkDB(ctrl)
+			blob := NewMockBlob(ctrl)
+			channel := NewMockAMQPChannel(ctrl)
+			d := &Dispatcher{
+				opts:    Options{Bucket: "bucket", LinkTTL: time.Hour},
+				linkDB:  linkDB,
+				storage: blob,
+			}
+
+			if !tc.signer {
+				sender.EXPECT().Send(tgbotapi.NewMessage(1, TooLargeMessage)).Return(tgbotapi.Message{}, nil)
+				blob.EXPECT().DeleteObject(gomock.Any(), "bucket", key).Return(nil)
+			} else {
+				signer := NewMockURLSigner(ctrl)
+				signer.EXPECT().SignedURL(gomock.Any(), "bucket", key, "video.webm", time.Hour).Return("https://link", nil)
+				d.signer = signer
+
+				before := time.Now()
+				linkDB.
+					EXPECT().
+					ExtendLink(gomock.Any(), "video", metadata.Mime, "hd720", gomock.Any()).
+					DoAndReturn(func(_ context.Context, _, _, _ string, at time.Time) error {
+						if at.Before(before.Add(time.Hour)) || at.After(time.Now().Add(time.Hour)) {
+							t.Errorf("link expiry got: %v, expected about: %v", at, before.Add(time.Hour))
+						}
+
+						return tc.extendErr
+					})
+			}
+
+			if tc.signer && tc.extendErr == nil {
+				channel.EXPECT().QueueDeclare(d.expiringQueue(), true, false, false, false, gomock.Any())
+				channel.EXPECT().Publish("", d.expiringQueue(), false, false, gomock.Any()).Return(nil)
+				sender.
+					EXPECT().
+					Send(gomock.Any()).
+					DoAndReturn(func(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+						if msg, ok := c.(tgbotapi.MessageConfig); !ok || !strings.Contains(msg.Text, "https://link") {
+							t.Errorf("unexpected link message: %+v", c)
+						}
+
+						return tgbotapi.Message{}, nil
+					})
+			}
+
+			err := d.shareLink(context.Background(), sender, channel, metadata, payload)
+			if (err != nil) != tc.err {
+				t.Errorf("shareLink got: %v, expected error: %t", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestDispatcher_deleteExpiredObject(t *testing.T) {
+	t.Parallel()
+
+	payload := Payload{VideoID: "video", Mime: "video/mp4", Quality: "hd720"}
+	testCases := []struct {
+		name     string
+		metadata db.Metadata
+		fetchErr error
+		deleted  bool
+		err      bool
+	}{
+		{
+			name:     "test_link_expired",
+			metadata: db.Metadata{LinkExpiresAt: time.Now().Add(-time.Second)},
+			deleted:  true,
+		},
+		{
+			name:     "test_newer_link",
+			metadata: db.Metadata{LinkExpiresAt: time.Now().Add(time.Hour)},
+		},
+		{
+			name: "test_saved_after_link",
+			metadata: db.Metadata{
+				LinkExpiresAt: time.Now().Add(-time.Second),
+				UpdatedAt:     time.Now().Add(time.Minute),
+			},
+			deleted: true,
+		},
+		{
+			name:     "test_metadata_not_found",
+			fetchErr: db.ErrNotFound,
+			deleted:  true,
+		},
+		{
+			name:     "test_fetch_error",
+			fetchErr: errors.New("mock error"),
+			err:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ctrl := gomock.NewController(t)
+			linkDB := NewMockLinkDB(ctrl)
+			blob := NewMockBlob(ctrl)
+
+			linkDB.EXPECT().FetchByMetadata(gomock.Any(), "video", "video/mp4", "hd720").Return(tc.metadata, tc.fetchErr)
+			if tc.deleted {
+				blob.
+					EXPECT().
+					DeleteObject(gomock.Any(), "bucket", storage.ObjectKey("video", "video/mp4", "hd720")).
+					Return(nil)
+			}
+
+			d := &Dispatcher{opts: Options{Bucket: "bucket"}, linkDB: linkDB, storage: blob}
+			err := d.deleteExpiredObject(context.Background(), payload)
+			if (err != nil) != tc.err {
+				t.Errorf("deleteExpiredObject got: %v, expected error: %t", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestDispatcher_readStream(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		contents string
+		size     int64
+		signer   bool
+		err      error
+	}{
+		{
+			name:     "test_fits",
+			contents: "1234",
+			size:     4,
+		},
+		{
+			name:     "test_too_large",
+			contents: "123456",
+			size:     6,
+			err:      errTooLarge,
+		},
+		{
+			name:     "test_too_large_unknown_size",
+			contents: "123456",
+			err:      errTooLarge,
+		},
+		{
+			name:     "test_too_large_shared",
+			contents: "123456",
+			size:     6,
+			signer:   true,
+		},
+		{
+			name:     "test_too_large_to_share",
+			contents: "12345678901",
+			size:     11,
+			signer:   true,
+			err:      errTooLarge,
+		},
+		{
+			name:     "test_too_large_to_share_unknown_size",
+			contents: "12345678901",
+			signer:   true,
+			err:      errTooLarge,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ctrl := gomock.NewController(t)
+			client := NewMockYoutubeClient(ctrl)
+			client.
+				EXPECT().
+				GetStreamContext(gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(io.NopCloser(strings.NewReader(tc.contents)), tc.size, nil)
+
+			d := &Dispatcher{opts: Options{MaxUploadSize: 5, MaxLinkSize: 10}, youtubeClient: client}
+			if tc.signer {
+				d.signer = NewMockURLSigner(ctrl)
+			}
+
+			buf, err := d.readStream(context.Background(), &youtube.Video{}, &youtube.Format{})
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("readStream got: %v, expected: %v", err, tc.err)
+			}
+
+			if tc.err == nil && string(buf) != tc.contents {
+				t.Errorf("readStream got: %q, expected: %q", buf, tc.contents)
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	context "context"
 	io "io"
 	reflect "reflect"
+	time "time"
 
 	telegram_bot_api "github.com/go-telegram-bot-api/telegram-bot-api"
 	gomock "github.com/golang/mock/gomock"
@@ -93,6 +94,21 @@ func (m *MockMetadataDB) EXPECT() *MockMetadataDBMockRecorder {
 	return m.recorder
 }
 
+// FetchByKeys mocks base method.
+func (m *MockMetadataDB) FetchByKeys(ctx context.Context, keys []db.MetadataKey) ([]db.Metadata, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FetchByKeys", ctx, keys)
+	ret0, _ := ret[0].([]db.Metadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FetchByKeys indicates an expected call of FetchByKeys.
+func (mr *MockMetadataDBMockRecorder) FetchByKeys(ctx, keys interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchByKeys", reflect.TypeOf((*MockMetadataDB)(nil).FetchByKeys), ctx, keys)
+}
+
 // FetchByMetadata mocks base method.
 func (m *MockMetadataDB) FetchByMetadata(ctx context.Context, videoID, mime, quality string) (db.Metadata, error) {
 	m.ctrl.T.Helper()
@@ -122,6 +138,360 @@ func (mr *MockMetadataDBMockRecorder) Save(ctx, model interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockMetadataDB)(nil).Save), ctx, model)
 }
 
+// SaveBatch mocks base method.
+func (m *MockMetadataDB) SaveBatch(ctx context.Context, models []db.Metadata) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveBatch", ctx, models)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveBatch indicates an expected call of SaveBatch.
+func (mr *MockMetadataDBMockRecorder) SaveBatch(ctx, models interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveBatch", reflect.TypeOf((*MockMetadataDB)(nil).SaveBatch), ctx, models)
+}
+
+// Touch mocks base method.
+func (m *MockMetadataDB) Touch(ctx context.Context, videoID, mime, quality string, at time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Touch", ctx, videoID, mime, quality, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Touch indicates an expected call of Touch.
+func (mr *MockMetadataDBMockRecorder) Touch(ctx, videoID, mime, quality, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Touch", reflect.TypeOf((*MockMetadataDB)(nil).Touch), ctx, videoID, mime, quality, at)
+}
+
+// MockLinkDB is a mock of LinkDB interface.
+type MockLinkDB struct {
+	ctrl     *gomock.Controller
+	recorder *MockLinkDBMockRecorder
+}
+
+// MockLinkDBMockRecorder is the mock recorder for MockLinkDB.
+type MockLinkDBMockRecorder struct {
+	mock *MockLinkDB
+}
+
+// NewMockLinkDB creates a new mock instance.
+func NewMockLinkDB(ctrl *gomock.Controller) *MockLinkDB {
+	mock := &MockLinkDB{ctrl: ctrl}
+	mock.recorder = &MockLinkDBMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLinkDB) EXPECT() *MockLinkDBMockRecorder {
+	return m.recorder
+}
+
+// ExtendLink mocks base method.
+func (m *MockLinkDB) ExtendLink(ctx context.Context, videoID, mime, quality string, at time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExtendLink", ctx, videoID, mime, quality, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExtendLink indicates an expected call of ExtendLink.
+func (mr *MockLinkDBMockRecorder) ExtendLink(ctx, videoID, mime, quality, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExtendLink", reflect.TypeOf((*MockLinkDB)(nil).ExtendLink), ctx, videoID, mime, quality, at)
+}
+
+// FetchByMetadata mocks base method.
+func (m *MockLinkDB) FetchByMetadata(ctx context.Context, videoID, mime, quality string) (db.Metadata, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FetchByMetadata", ctx, videoID, mime, quality)
+	ret0, _ := ret[0].(db.Metadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FetchByMetadata indicates an expected call of FetchByMetadata.
+func (mr *MockLinkDBMockRecorder) FetchByMetadata(ctx, videoID, mime, quality interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchByMetadata", reflect.TypeOf((*MockLinkDB)(nil).FetchByMetadata), ctx, videoID, mime, quality)
+}
+
+// MockUsageDB is a mock of UsageDB interface.
+type MockUsageDB struct {
+	ctrl     *gomock.Controller
+	recorder *MockUsageDBMockRecorder
+}
+
+// MockUsageDBMockRecorder is the mock recorder for MockUsageDB.
+type MockUsageDBMockRecorder struct {
+	mock *MockUsageDB
+}
+
+// NewMockUsageDB creates a new mock instance.
+func NewMockUsageDB(ctrl *gomock.Controller) *MockUsageDB {
+	mock := &MockUsageDB{ctrl: ctrl}
+	mock.recorder = &MockUsageDBMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUsageDB) EXPECT() *MockUsageDBMockRecorder {
+	return m.recorder
+}
+
+// MostRequested mocks base method.
+func (m *MockUsageDB) MostRequested(ctx context.Context, limit int) ([]db.Metadata, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MostRequested", ctx, limit)
+	ret0, _ := ret[0].([]db.Metadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MostRequested indicates an expected call of MostRequested.
+func (mr *MockUsageDBMockRecorder) MostRequested(ctx, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MostRequested", reflect.TypeOf((*MockUsageDB)(nil).MostRequested), ctx, limit)
+}
+
+// PurgeUnused mocks base method.
+func (m *MockUsageDB) PurgeUnused(ctx context.Context, before time.Time, archive bool) ([]db.MetadataKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeUnused", ctx, before, archive)
+	ret0, _ := ret[0].([]db.MetadataKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeUnused indicates an expected call of PurgeUnused.
+func (mr *MockUsageDBMockRecorder) PurgeUnused(ctx, before, archive interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeUnused", reflect.TypeOf((*MockUsageDB)(nil).PurgeUnused), ctx, before, archive)
+}
+
+// MockUserDB is a mock of UserDB interface.
+type MockUserDB struct {
+	ctrl     *gomock.Controller
+	recorder *MockUserDBMockRecorder
+}
+
+// MockUserDBMockRecorder is the mock recorder for MockUserDB.
+type MockUserDBMockRecorder struct {
+	mock *MockUserDB
+}
+
+// NewMockUserDB creates a new mock instance.
+func NewMockUserDB(ctrl *gomock.Controller) *MockUserDB {
+	mock := &MockUserDB{ctrl: ctrl}
+	mock.recorder = &MockUserDBMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUserDB) EXPECT() *MockUserDBMockRecorder {
+	return m.recorder
+}
+
+// SetBlocked mocks base method.
+func (m *MockUserDB) SetBlocked(ctx context.Context, id int64, blocked bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetBlocked", ctx, id, blocked)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetBlocked indicates an expected call of SetBlocked.
+func (mr *MockUserDBMockRecorder) SetBlocked(ctx, id, blocked interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetBlocked", reflect.TypeOf((*MockUserDB)(nil).SetBlocked), ctx, id, blocked)
+}
+
+// Upsert mocks base method.
+func (m *MockUserDB) Upsert(ctx context.Context, model db.User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Upsert", ctx, model)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Upsert indicates an expected call of Upsert.
+func (mr *MockUserDBMockRecorder) Upsert(ctx, model interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Upsert", reflect.TypeOf((*MockUserDB)(nil).Upsert), ctx, model)
+}
+
+// MockChatDB is a mock of ChatDB interface.
+type MockChatDB struct {
+	ctrl     *gomock.Controller
+	recorder *MockChatDBMockRecorder
+}
+
+// MockChatDBMockRecorder is the mock recorder for MockChatDB.
+type MockChatDBMockRecorder struct {
+	mock *MockChatDB
+}
+
+// NewMockChatDB creates a new mock instance.
+func NewMockChatDB(ctrl *gomock.Controller) *MockChatDB {
+	mock := &MockChatDB{ctrl: ctrl}
+	mock.recorder = &MockChatDBMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockChatDB) EXPECT() *MockChatDBMockRecorder {
+	return m.recorder
+}
+
+// SetBlocked mocks base method.
+func (m *MockChatDB) SetBlocked(ctx context.Context, id int64, blocked bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetBlocked", ctx, id, blocked)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetBlocked indicates an expected call of SetBlocked.
+func (mr *MockChatDBMockRecorder) SetBlocked(ctx, id, blocked interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetBlocked", reflect.TypeOf((*MockChatDB)(nil).SetBlocked), ctx, id, blocked)
+}
+
+// Upsert mocks base method.
+func (m *MockChatDB) Upsert(ctx context.Context, model db.Chat) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Upsert", ctx, model)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Upsert indicates an expected call of Upsert.
+func (mr *MockChatDBMockRecorder) Upsert(ctx, model interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Upsert", reflect.TypeOf((*MockChatDB)(nil).Upsert), ctx, model)
+}
+
+// MockHistoryDB is a mock of HistoryDB interface.
+type MockHistoryDB struct {
+	ctrl     *gomock.Controller
+	recorder *MockHistoryDBMockRecorder
+}
+
+// MockHistoryDBMockRecorder is the mock recorder for MockHistoryDB.
+type MockHistoryDBMockRecorder struct {
+	mock *MockHistoryDB
+}
+
+// NewMockHistoryDB creates a new mock instance.
+func NewMockHistoryDB(ctrl *gomock.Controller) *MockHistoryDB {
+	mock := &MockHistoryDB{ctrl: ctrl}
+	mock.recorder = &MockHistoryDBMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHistoryDB) EXPECT() *MockHistoryDBMockRecorder {
+	return m.recorder
+}
+
+// FetchByID mocks base method.
+func (m *MockHistoryDB) FetchByID(ctx context.Context, id int64) (db.Request, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FetchByID", ctx, id)
+	ret0, _ := ret[0].(db.Request)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FetchByID indicates an expected call of FetchByID.
+func (mr *MockHistoryDBMockRecorder) FetchByID(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchByID", reflect.TypeOf((*MockHistoryDB)(nil).FetchByID), ctx, id)
+}
+
+// ListByUser mocks base method.
+func (m *MockHistoryDB) ListByUser(ctx context.Context, userID int64, limit, offset int) ([]db.Request, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListByUser", ctx, userID, limit, offset)
+	ret0, _ := ret[0].([]db.Request)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListByUser indicates an expected call of ListByUser.
+func (mr *MockHistoryDBMockRecorder) ListByUser(ctx, userID, limit, offset interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListByUser", reflect.TypeOf((*MockHistoryDB)(nil).ListByUser), ctx, userID, limit, offset)
+}
+
+// Save mocks base method.
+func (m *MockHistoryDB) Save(ctx context.Context, model db.Request) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, model)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockHistoryDBMockRecorder) Save(ctx, model interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockHistoryDB)(nil).Save), ctx, model)
+}
+
+// MockUnavailableDB is a mock of UnavailableDB interface.
+type MockUnavailableDB struct {
+	ctrl     *gomock.Controller
+	recorder *MockUnavailableDBMockRecorder
+}
+
+// MockUnavailableDBMockRecorder is the mock recorder for MockUnavailableDB.
+type MockUnavailableDBMockRecorder struct {
+	mock *MockUnavailableDB
+}
+
+// NewMockUnavailableDB creates a new mock instance.
+func NewMockUnavailableDB(ctrl *gomock.Controller) *MockUnavailableDB {
+	mock := &MockUnavailableDB{ctrl: ctrl}
+	mock.recorder = &MockUnavailableDBMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUnavailableDB) EXPECT() *MockUnavailableDBMockRecorder {
+	return m.recorder
+}
+
+// FetchByVideoID mocks base method.
+func (m *MockUnavailableDB) FetchByVideoID(ctx context.Context, videoID string) (db.Unavailable, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FetchByVideoID", ctx, videoID)
+	ret0, _ := ret[0].(db.Unavailable)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FetchByVideoID indicates an expected call of FetchByVideoID.
+func (mr *MockUnavailableDBMockRecorder) FetchByVideoID(ctx, videoID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchByVideoID", reflect.TypeOf((*MockUnavailableDB)(nil).FetchByVideoID), ctx, videoID)
+}
+
+// Save mocks base method.
+func (m *MockUnavailableDB) Save(ctx context.Context, model db.Unavailable) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, model)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockUnavailableDBMockRecorder) Save(ctx, model interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockUnavailableDB)(nil).Save), ctx, model)
+}
+
 // MockTelegramSender is a mock of TelegramSender interface.
 type MockTelegramSender struct {
 	ctrl     *gomock.Controller
@@ -145,6 +515,21 @@ func (m *MockTelegramSender) EXPECT() *MockTelegramSenderMockRecorder {
 	return m.recorder
 }
 
+// AnswerCallbackQuery mocks base method.
+func (m *MockTelegramSender) AnswerCallbackQuery(config telegram_bot_api.CallbackConfig) (telegram_bot_api.APIResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AnswerCallbackQuery", config)
+	ret0, _ := ret[0].(telegram_bot_api.APIResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AnswerCallbackQuery indicates an expected call of AnswerCallbackQuery.
+func (mr *MockTelegramSenderMockRecorder) AnswerCallbackQuery(config interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AnswerCallbackQuery", reflect.TypeOf((*MockTelegramSender)(nil).AnswerCallbackQuery), config)
+}
+
 // Send mocks base method.
 func (m *MockTelegramSender) Send(c telegram_bot_api.Chattable) (telegram_bot_api.Message, error) {
 	m.ctrl.T.Helper()
@@ -373,3 +758,41 @@ func (mr *MockBlobMockRecorder) GetObject(ctx, bucket, key interface{}) *gomock.
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetObject", reflect.TypeOf((*MockBlob)(nil).GetObject), ctx, bucket, key)
 }
+
+// MockURLSigner is a mock of URLSigner interface.
+type MockURLSigner struct {
+	ctrl     *gomock.Controller
+	recorder *MockURLSignerMockRecorder
+}
+
+// MockURLSignerMockRecorder is the mock recorder for MockURLSigner.
+type MockURLSignerMockRecorder struct {
+	mock *MockURLSigner
+}
+
+// NewMockURLSigner creates a new mock instance.
+func NewMockURLSigner(ctrl *gomock.Controller) *MockURLSigner {
+	mock := &MockURLSigner{ctrl: ctrl}
+	mock.recorder = &MockURLSignerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockURLSigner) EXPECT() *MockURLSignerMockRecorder {
+	return m.recorder
+}
+
+// SignedURL mocks base method.
+func (m *MockURLSigner) SignedURL(ctx context.Context, bucket, key, filename string, ttl time.Duration) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SignedURL", ctx, bucket, key, filename, ttl)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SignedURL indicates an expected call of SignedURL.
+func (mr *MockURLSignerMockRecorder) SignedURL(ctx, bucket, key, filename, ttl interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SignedURL", reflect.TypeOf((*MockURLSigner)(nil).SignedURL), ctx, bucket, key, filename, ttl)
+}
@@ -0,0 +1,171 @@
+package bot
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kkdai/youtube/v2"
+	"github.com/robotomize/cribe/internal/db"
+)
+
+const (
+	// descriptionMaxLen bounds the description excerpt kept in the metadata
+	descriptionMaxLen = 1000
+	// captionMaxLen is the telegram limit of a media caption
+	captionMaxLen = 1024
+	// captionChaptersMax bounds the chapters listed in a caption
+	captionChaptersMax = 15
+	// minChapters is the number of timestamps youtube itself needs to split a video into chapters
+	minChapters = 3
+)
+
+// chapterPattern matches a description line starting with a timestamp, optionally in brackets and followed by a dash
+var chapterPattern = regexp.MustCompile(`^[(\[]?((?:\d{1,2}:)?\d{1,2}:\d{2})[)\]]?\s*[-–—:|]?\s*(.+)$`)
+
+// newVideoParams returns the params of the video format stored with its metadata
+func newVideoParams(video *youtube.Video, format *youtube.Format) db.VideoParams {
+	return db.VideoParams{
+		Version:     db.VideoParamsVersion,
+		Title:       video.Title,
+		Width:       format.Width,
+		Height:      format.Height,
+		Duration:    int(video.Duration.Seconds()),
+		Thumb:       videoThumb(video.Thumbnails),
+		Author:      video.Author,
+		ChannelID:   video.ChannelID,
+		ViewCount:   video.ViewCount,
+		Keywords:    video.Keywords,
+		PublishDate: video.PublishDate,
+		Description: truncate(video.Description, descriptionMaxLen),
+		Chapters:    parseChapters(video.Description),
+	}
+}
+
+// videoThumb returns the largest thumbnail fitting the telegram constraint without its query
+func videoThumb(thumbnails youtube.Thumbnails) string {
+	thumbnails = append(youtube.Thumbnails(nil), thumbnails...)
+	// sort preview by telegram constrain
+	sort.Slice(thumbnails, func(i, j int) bool {
+		w1, w2 := thumbnails[i].Width, thumbnails[j].Width
+		h1, h2 := thumbnails[i].Height, thumbnails[j].Height
+
+		return w1 > w2 && h1 > h2 && w1 <= 320 && h1 <= 320
+	})
+
+	var thumb string
+	if len(thumbnails) > 0 {
+		idx := strings.Index(thumbnails[0].URL, "?")
+		if idx > -1 {
+			thumb = thumbnails[0].URL[:idx]
+		}
+	}
+
+	return thumb
+}
+
+// parseChapters reads the chapters listed in the description the way youtube does: the first timestamp
+// is 0:00, there are at least three of them and they go in ascending order. Otherwise there are no chapters
+func parseChapters(description string) []db.Chapter {
+	var chapters []db.Chapter
+	for _, line := range strings.Split(description, "\n") {
+		match := chapterPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+
+		start, ok := parseTimestamp(match[1])
+		if !ok {
+			continue
+		}
+
+		if len(chapters) == 0 && start != 0 {
+			return nil
+		}
+
+		if len(chapters) > 0 && start <= chapters[len(chapters)-1].Start {
+			return nil
+		}
+
+		chapters = append(chapters, db.Chapter{Start: start, Title: strings.TrimSpace(match[2])})
+	}
+
+	if len(chapters) < minChapters {
+		return nil
+	}
+
+	return chapters
+}
+
+// parseTimestamp returns the seconds of a [h:]mm:ss timestamp
+func parseTimestamp(s string) (int, bool) {
+	var seconds int
+	parts := strings.Split(s, ":")
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, false
+		}
+
+		// minutes and seconds of a longer timestamp are two digit below 60
+		if i > 0 && n >= 60 {
+			return 0, false
+		}
+
+		seconds = seconds*60 + n
+	}
+
+	return seconds, true
+}
+
+// videoCaption renders the caption of a sent video: the title, the channel with the publish date and the chapters
+func videoCaption(params db.VideoParams) string {
+	var b strings.Builder
+	b.WriteString(params.Title)
+
+	var byline []string
+	if params.Author != "" {
+		byline = append(byline, params.Author)
+	}
+
+	if !params.PublishDate.IsZero() {
+		byline = append(byline, params.PublishDate.Format("2006-01-02"))
+	}
+
+	if len(byline) > 0 {
+		b.WriteString("\n" + strings.Join(byline, " · "))
+	}
+
+	if len(params.Chapters) > 0 {
+		b.WriteString("\n")
+		for i, chapter := range params.Chapters {
+			if i == captionChaptersMax {
+				b.WriteString("\n…")
+				break
+			}
+
+			b.WriteString("\n" + formatTimestamp(chapter.Start) + " " + chapter.Title)
+		}
+	}
+
+	return truncate(b.String(), captionMaxLen)
+}
+
+func formatTimestamp(seconds int) string {
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// truncate cuts s to at most n runes, marking the cut with an ellipsis
+func truncate(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+
+	return s
+}
@@ -0,0 +1,217 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kkdai/youtube/v2"
+	"github.com/robotomize/cribe/internal/db"
+)
+
+func TestParseChapters(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		description string
+		expected    []db.Chapter
+	}{
+		{
+			name:        "test_chapters",
+			description: "Intro text\n\n0:00 Intro\n1:30 - The middle part\n(12:05) Outro\nhttps://example.com",
+			expected: []db.Chapter{
+				{Start: 0, Title: "Intro"},
+				{Start: 90, Title: "The middle part"},
+				{Start: 725, Title: "Outro"},
+			},
+		},
+		{
+			name:        "test_hours",
+			description: "00:00 Start\n59:59 Almost\n1:02:03 Long",
+			expected: []db.Chapter{
+				{Start: 0, Title: "Start"},
+				{Start: 3599, Title: "Almost"},
+				{Start: 3723, Title: "Long"},
+			},
+		},
+		{
+			name:        "test_not_from_zero",
+			description: "0:10 Intro\n1:30 Middle\n2:00 Outro",
+		},
+		{
+			name:        "test_not_ascending",
+			description: "0:00 Intro\n2:30 Middle\n2:00 Outro",
+		},
+		{
+			name:        "test_too_few",
+			description: "0:00 Intro\n2:30 Outro",
+		},
+		{
+			name:        "test_invalid_seconds",
+			description: "0:00 Intro\n1:75 Middle\n2:00 Outro",
+		},
+		{
+			name: "test_empty",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if got := parseChapters(tc.description); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("parseChapters got: %v, expected: %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestVideoCaption(t *testing.T) {
+	t.Parallel()
+
+	chapters := make([]db.Chapter, 0, captionChaptersMax+1)
+	bounded := "title\n"
+	for i := 0; i <= captionChaptersMax; i++ {
+		chapters = append(chapters, db.Chapter{Start: i * 60, Title: "part"})
+		if i < captionChaptersMax {
+			bounded += fmt.Sprintf("\n%d:00 part", i)
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		params   db.VideoParams
+		expected string
+	}{
+		{
+			name:     "test_title_only",
+			params:   db.VideoParams{Title: "title"},
+			expected: "title",
+		},
+		{
+			name: "test_byline",
+			params: db.VideoParams{
+				Title:       "title",
+				Author:      "channel",
+				PublishDate: time.Date(2021, 10, 19, 0, 0, 0, 0, time.UTC),
+			},
+			expected: "title\nchannel · 2021-10-19",
+		},
+		{
+			name: "test_chapters",
+			params: db.VideoParams{
+				Title:    "title",
+				Chapters: []db.Chapter{{Start: 0, Title: "Intro"}, {Start: 3723, Title: "Outro"}},
+			},
+			expected: "title\n\n0:00 Intro\n1:02:03 Outro",
+		},
+		{
+			name:     "test_chapters_bounded",
+			params:   db.VideoParams{Title: "title", Chapters: chapters},
+			expected: bounded + "\n…",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got := videoCaption(tc.params)
+			if got != tc.expected {
+				t.Errorf("videoCaption got: %q, expected: %q", got, tc.expected)
+			}
+		})
+	}
+
+	long := videoCaption(db.VideoParams{Title: strings.Repeat("x", captionMaxLen*2)})
+	if n := len([]rune(long)); n != captionMaxLen {
+		t.Errorf("caption length got: %d, expected: %d", n, captionMaxLen)
+	}
+}
+
+func TestNewVideoParams(t *testing.T) {
+	t.Parallel()
+
+	video := &youtube.Video{
+		Title:       "title",
+		Author:      "channel",
+		ChannelID:   "UCchannel",
+		ViewCount:   1000,
+		Keywords:    []string{"go", "testing"},
+		Duration:    time.Minute,
+		PublishDate: time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC),
+		Description: "about",
+	}
+
+	expected := db.VideoParams{
+		Version:     db.VideoParamsVersion,
+		Title:       "title",
+		Width:       1280,
+		Height:      720,
+		Duration:    60,
+		Author:      "channel",
+		ChannelID:   "UCchannel",
+		ViewCount:   1000,
+		Keywords:    []string{"go", "testing"},
+		PublishDate: time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC),
+		Description: "about",
+	}
+
+	if got := newVideoParams(video, &youtube.Format{Width: 1280, Height: 720}); !reflect.DeepEqual(got, expected) {
+		t.Errorf("params got: %+v, expected: %+v", got, expected)
+	}
+}
+
+func TestDispatcher_backfillParams(t *testing.T) {
+	t.Parallel()
+
+	video := &youtube.Video{
+		ID:    "video",
+		Title: "title",
+		Formats: youtube.FormatList{
+			{MimeType: "video/mp4", Quality: "hd720", Width: 1280, Height: 720},
+			{MimeType: "video/webm", Quality: "hd720", Width: 1280, Height: 720},
+			{MimeType: "video/mp4", Quality: "medium", Width: 640, Height: 360},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	metadataDB := NewMockMetadataDB(ctrl)
+	metadataDB.
+		EXPECT().
+		FetchByKeys(gomock.Any(), []db.MetadataKey{
+			{VideoID: "video", Mime: "video/mp4", Quality: "hd720"},
+			{VideoID: "video", Mime: "video/webm", Quality: "hd720"},
+			{VideoID: "video", Mime: "video/mp4", Quality: "medium"},
+		}).
+		Return([]db.Metadata{
+			{VideoID: "video", Mime: "video/mp4", Quality: "hd720"},
+			{VideoID: "video", Mime: "video/mp4", Quality: "medium", Params: db.VideoParams{Version: db.VideoParamsVersion}},
+		}, nil)
+	metadataDB.
+		EXPECT().
+		SaveBatch(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, models []db.Metadata) error {
+			// the up to date format is left alone
+			if len(models) != 1 || models[0].Quality != "hd720" {
+				t.Fatalf("saved got: %+v, expected the stale format only", models)
+			}
+
+			if models[0].Params.Version != db.VideoParamsVersion || models[0].Params.Title != "title" ||
+				models[0].Params.Width != 1280 {
+				t.Errorf("backfilled params got: %+v", models[0].Params)
+			}
+
+			return nil
+		})
+
+	d := &Dispatcher{metadataDB: metadataDB}
+	d.backfillParams(
+		context.Background(), db.Metadata{VideoID: "video", Mime: "video/mp4", Quality: "hd720"}, video, &video.Formats[0],
+	)
+}
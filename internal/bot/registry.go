@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/robotomize/cribe/internal/db"
+	"github.com/robotomize/cribe/internal/logging"
+)
+
+// register upserts the author and the chat of the message into the users and chats registry
+func (s *Dispatcher) register(ctx context.Context, message *tgbotapi.Message) error {
+	now := time.Now()
+	if message.From != nil {
+		if err := s.userDB.Upsert(ctx, db.User{
+			ID:           int64(message.From.ID),
+			Username:     message.From.UserName,
+			LanguageCode: message.From.LanguageCode,
+			LastSeenAt:   now,
+		}); err != nil {
+			return fmt.Errorf("upsert user: %w", err)
+		}
+	}
+
+	if message.Chat != nil {
+		if err := s.chatDB.Upsert(ctx, db.Chat{
+			ID:         message.Chat.ID,
+			Type:       message.Chat.Type,
+			Title:      message.Chat.Title,
+			Username:   message.Chat.UserName,
+			LastSeenAt: now,
+		}); err != nil {
+			return fmt.Errorf("upsert chat: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// trackBlocked wraps the sender to mark chats blocked once telegram refuses to deliver to them
+func (s *Dispatcher) trackBlocked(ctx context.Context, sender TelegramSender) TelegramSender {
+	return &blockTrackingSender{TelegramSender: sender, ctx: ctx, users: s.userDB, chats: s.chatDB}
+}
+
+type blockTrackingSender struct {
+	TelegramSender
+	ctx   context.Context
+	users UserDB
+	chats ChatDB
+}
+
+func (b *blockTrackingSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	message, err := b.TelegramSender.Send(c)
+	if err != nil && isForbidden(err) {
+		if chatID, ok := chatIDOf(c); ok {
+			b.markBlocked(chatID)
+		}
+	}
+
+	return message, err
+}
+
+func (b *blockTrackingSender) UploadFileWithContext(
+	ctx context.Context, endpoint string, params map[string]string, fieldname string, file interface{},
+) (tgbotapi.APIResponse, error) {
+	resp, err := b.TelegramSender.UploadFileWithContext(ctx, endpoint, params, fieldname, file)
+	if (err != nil && isForbidden(err)) || (err == nil && resp.ErrorCode == http.StatusForbidden) {
+		if chatID, parseErr := strconv.ParseInt(params["chat_id"], 10, 64); parseErr == nil {
+			b.markBlocked(chatID)
+		}
+	}
+
+	return resp, err
+}
+
+func (b *blockTrackingSender) markBlocked(chatID int64) {
+	logger := logging.FromContext(b.ctx).Named("blockTrackingSender.markBlocked")
+	if err := b.chats.SetBlocked(b.ctx, chatID, true); err != nil && !errors.Is(err, db.ErrNoRowsUpd) {
+		logger.Errorf("set chat blocked: %v", err)
+	}
+
+	// a private chat shares its id with the user
+	if chatID > 0 {
+		if err := b.users.SetBlocked(b.ctx, chatID, true); err != nil && !errors.Is(err, db.ErrNoRowsUpd) {
+			logger.Errorf("set user blocked: %v", err)
+		}
+	}
+}
+
+// isForbidden reports whether telegram refused the request because the bot was blocked or kicked
+func isForbidden(err error) bool {
+	var tgErr tgbotapi.Error
+	if errors.As(err, &tgErr) {
+		return tgErr.Code == http.StatusForbidden
+	}
+
+	return false
+}
+
+func chatIDOf(c tgbotapi.Chattable) (int64, bool) {
+	switch config := c.(type) {
+	case tgbotapi.MessageConfig:
+		return config.ChatID, true
+	case tgbotapi.VideoConfig:
+		return config.ChatID, true
+	case tgbotapi.EditMessageTextConfig:
+		return config.ChatID, true
+	default:
+		return 0, false
+	}
+}
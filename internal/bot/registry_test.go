@@ -0,0 +1,67 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/golang/mock/gomock"
+)
+
+func TestBlockTrackingSender_Send(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		chatID  int64
+		sendErr error
+		chats   int
+		users   int
+	}{
+		{
+			name:   "test_delivered",
+			chatID: 1,
+		},
+		{
+			name:    "test_network_error",
+			chatID:  1,
+			sendErr: errors.New("mock error"),
+		},
+		{
+			name:    "test_private_chat_blocked",
+			chatID:  1,
+			sendErr: tgbotapi.Error{Code: http.StatusForbidden, Message: "Forbidden: bot was blocked by the user"},
+			chats:   1,
+			users:   1,
+		},
+		{
+			name:    "test_group_kicked",
+			chatID:  -1,
+			sendErr: tgbotapi.Error{Code: http.StatusForbidden, Message: "Forbidden: bot was kicked from the group chat"},
+			chats:   1,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ctrl := gomock.NewController(t)
+			telegram := NewMockTelegramSender(ctrl)
+			users := NewMockUserDB(ctrl)
+			chats := NewMockChatDB(ctrl)
+
+			telegram.EXPECT().Send(gomock.Any()).Return(tgbotapi.Message{}, tc.sendErr)
+			chats.EXPECT().SetBlocked(gomock.Any(), tc.chatID, true).Return(nil).Times(tc.chats)
+			users.EXPECT().SetBlocked(gomock.Any(), tc.chatID, true).Return(nil).Times(tc.users)
+
+			d := &Dispatcher{userDB: users, chatDB: chats}
+			sender := d.trackBlocked(context.Background(), telegram)
+			if _, err := sender.Send(tgbotapi.NewMessage(tc.chatID, "hello")); !errors.Is(err, tc.sendErr) {
+				t.Errorf("expected %v to be %v", err, tc.sendErr)
+			}
+		})
+	}
+}
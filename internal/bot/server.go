@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/enescakir/emoji"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
@@ -23,9 +24,29 @@ import (
 
 const SendingMessageError = "Oops, something went wrong, try sending the link again"
 
+// SessionResetMessage tells the user an abandoned conversation was reset
+const SessionResetMessage = "Your previous request took too long and was reset"
+
+// SessionConflictMessage asks the user to repeat a message whose session update lost to a concurrent one
+const SessionConflictMessage = "Your message crossed with another request, please send it again"
+
+// ParsingVideoTimeout is how long a session may stay in ParsingVideoState, a session left there by a crash
+// would otherwise ignore the links of the user until it expires
+const ParsingVideoTimeout = 5 * time.Minute
+
 const (
 	QueueFetching  = "fetching"
 	QueueUploading = "uploading"
+	// QueueExpiring holds shared objects until the link TTL passes, then they are dead-lettered to QueueDeleting
+	QueueExpiring = "expiring"
+	QueueDeleting = "deleting"
+)
+
+const (
+	// BotAPIMaxUploadSize is the upload limit of the public telegram bot api
+	BotAPIMaxUploadSize int64 = 50 * 1024 * 1024
+	// LocalBotAPIMaxUploadSize is the upload limit of a self-hosted telegram bot api server
+	LocalBotAPIMaxUploadSize int64 = 2000 * 1024 * 1024
 )
 
 type JobKind uint8
@@ -41,31 +62,73 @@ type Job struct {
 }
 
 type Options struct {
-	Bucket                    string
-	TelegramPollingTimeout    int
+	Bucket                 string
+	TelegramPollingTimeout int
+	// TelegramUpdatesMaxWorkers is the number of shards the updates are split to by user, every shard is
+	// handled by one worker to keep the updates of a user in order
 	TelegramUpdatesMaxWorkers int
-	FetchingMaxWorker         int
-	UploadingMaxWorker        int
+	// TelegramUpdatesQueueSize bounds the updates waiting in a shard, a full shard holds back the polling
+	TelegramUpdatesQueueSize int
+	FetchingMaxWorker        int
+	UploadingMaxWorker       int
+	MaxUploadSize            int64
+	LinkTTL                  time.Duration
+	// MaxLinkSize is the largest video fetched to be shared with a link
+	MaxLinkSize int64
+	// RetentionPeriod is how long metadata is kept without being accessed, 0 keeps it forever
+	RetentionPeriod time.Duration
+	// RetentionArchive moves the purged metadata to the archive instead of deleting it
+	RetentionArchive bool
+	AdminIDs         []int64
+	// SessionResetNotify tells the users whose conversation timed out that it was reset
+	SessionResetNotify bool
 }
 
 type Option func(*Dispatcher)
 
 func NewDispatcher(env *srvenv.Env, opts ...Option) (*Dispatcher, error) {
 	cfg := env.Config()
+	repositories := env.Repositories()
+
+	if err := fsmStates().Validate(); err != nil {
+		return nil, fmt.Errorf("invalid fsm: %w", err)
+	}
+
+	maxUploadSize := cfg.Telegram.MaxUploadSize
+	if maxUploadSize == 0 {
+		maxUploadSize = BotAPIMaxUploadSize
+		if cfg.Telegram.ProxyAddr != "" {
+			maxUploadSize = LocalBotAPIMaxUploadSize
+		}
+	}
 
 	d := Dispatcher{
 		opts: Options{
 			Bucket:                    cfg.Storage.Bucket,
 			TelegramPollingTimeout:    cfg.Telegram.PollingTimeout,
 			TelegramUpdatesMaxWorkers: cfg.TelegramUpdatesMaxWorkers,
+			TelegramUpdatesQueueSize:  cfg.TelegramUpdatesQueueSize,
 			FetchingMaxWorker:         cfg.FetchingMaxWorkers,
 			UploadingMaxWorker:        cfg.UploadingMaxWorkers,
+			MaxUploadSize:             maxUploadSize,
+			LinkTTL:                   cfg.Storage.SignedURL.TTL,
+			MaxLinkSize:               cfg.Storage.SignedURL.MaxSize,
+			RetentionPeriod:           time.Duration(cfg.MetadataRetentionDays) * 24 * time.Hour,
+			RetentionArchive:          cfg.MetadataRetentionArchive,
+			AdminIDs:                  cfg.Telegram.AdminIDs,
+			SessionResetNotify:        cfg.SessionResetNotify,
 		},
 		env:           env,
-		metadataDB:    db.NewMetadataRepository(env.DB()),
-		youtubeClient: &youtube.Client{},
+		metadataDB:    db.NewMetadataCache(repositories.Metadata, cfg.MetadataCache, env.Redis()),
+		usageDB:       repositories.Metadata,
+		linkDB:        repositories.Metadata,
+		userDB:        repositories.Users,
+		chatDB:        repositories.Chats,
+		historyDB:     repositories.Requests,
+		youtubeClient: newNegativeCache(&youtube.Client{}, repositories.Unavailable, cfg.UnavailableVideoTTL),
 		broker:        NewAMQPBroker(env.AMQP()),
 		storage:       env.Blob(),
+		signer:        env.URLSigner(),
 		Jobs:          make([]Job, 0),
 	}
 
@@ -81,8 +144,14 @@ type Dispatcher struct {
 	opts Options
 
 	metadataDB    MetadataDB
+	usageDB       UsageDB
+	linkDB        LinkDB
+	userDB        UserDB
+	chatDB        ChatDB
+	historyDB     HistoryDB
 	youtubeClient YoutubeClient
 	storage       Blob
+	signer        URLSigner
 	broker        AMQPConnection
 
 	mtx  sync.RWMutex
@@ -94,6 +163,8 @@ func (s *Dispatcher) Run(ctx context.Context, telegram *tgbotapi.BotAPI, cfg srv
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	sender := s.trackBlocked(ctx, telegram)
+
 	updates, err := s.setupTelegramMode(ctx, telegram, cfg.Telegram)
 	if err != nil {
 		return fmt.Errorf("configuring telegram updates: %w", err)
@@ -104,7 +175,7 @@ func (s *Dispatcher) Run(ctx context.Context, telegram *tgbotapi.BotAPI, cfg srv
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if err = s.consumingVideoFetching(ctx, telegram); err != nil {
+			if err = s.consumingVideoFetching(ctx, sender); err != nil {
 				logger.Errorf("consume fetching: %v", err)
 				cancel()
 			}
@@ -115,26 +186,48 @@ func (s *Dispatcher) Run(ctx context.Context, telegram *tgbotapi.BotAPI, cfg srv
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if err = s.consumingVideoUploading(ctx, telegram); err != nil {
+			if err = s.consumingVideoUploading(ctx, sender); err != nil {
 				logger.Errorf("consume uploading: %v", err)
 				cancel()
 			}
 		}()
 	}
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err = s.consumingExpiredObjects(ctx); err != nil {
+			logger.Errorf("consume expired objects: %v", err)
+			cancel()
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.purgingUnused(ctx)
+	}()
+
 	go func() {
 		<-ctx.Done()
 		telegram.StopReceivingUpdates()
 	}()
 
-	for i := 0; i < s.opts.TelegramUpdatesMaxWorkers; i++ {
+	shards := newUpdateShards(s.opts.TelegramUpdatesMaxWorkers, s.opts.TelegramUpdatesQueueSize)
+	for _, queue := range shards.queues {
 		wg.Add(1)
-		go func() {
+		go func(queue <-chan tgbotapi.Update) {
 			defer wg.Done()
-			s.dispatchingMessages(ctx, telegram, updates)
-		}()
+			s.dispatchingMessages(ctx, sender, queue)
+		}(queue)
 	}
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		shards.run(ctx, updates)
+	}()
+
 	wg.Wait()
 
 	if err := s.finalization(); err != nil {
@@ -169,6 +262,9 @@ func (s *Dispatcher) finalization() error {
 			Payload{
 				VideoID: job.VideoID,
 				ChatID:  job.ChatID,
+				UserID:  job.UserID,
+				Mime:    job.Mime,
+				Quality: job.Quality,
 			},
 		)
 		if err != nil {
@@ -255,28 +351,54 @@ func (s *Dispatcher) handleMessage(ctx context.Context, sender TelegramSender, m
 	logger := logging.FromContext(ctx)
 	userID := message.From.ID
 	sessionBackend := s.env.SessionBackend()
-	session := botstate.NewSession(strconv.FormatInt(int64(userID), 10), sessionBackend, provideFSM())
-	if err := session.Load(ctx); err != nil {
+	machine, err := provideFSM()
+	if err != nil {
+		return fmt.Errorf("provide fsm: %w", err)
+	}
+
+	parsingCtx := ParsingCtx{
+		broker:        s.broker,
+		message:       message.Text,
+		chatID:        message.Chat.ID,
+		userID:        int64(userID),
+		logger:        logger,
+		youtubeClient: s.youtubeClient,
+		tg:            sender,
+	}
+
+	session := botstate.NewSession(strconv.FormatInt(int64(userID), 10), sessionBackend, machine)
+	session.AddListener(func(t botstate.Transition, _ ParsingCtx) {
+		logger.Debugf("user %d session: %s -%s-> %s", userID, t.From, t.Event, t.To)
+	})
+	session.SetTimeoutContext(parsingCtx)
+	if err = session.Load(ctx); err != nil {
 		return fmt.Errorf("unable load session: %w", err)
 	}
 
+	if session.TimedOut() != "" && s.opts.SessionResetNotify {
+		if _, err = sender.Send(tgbotapi.NewMessage(message.Chat.ID, SessionResetMessage)); err != nil {
+			logger.Errorf("send message: %v", err)
+		}
+	}
+
 	if session.Current() == botstate.Default {
-		if err := session.SendEvent(
-			ParseVideoEvent, ParsingCtx{
-				ctx:           ctx,
-				broker:        s.broker,
-				message:       message.Text,
-				chatID:        message.Chat.ID,
-				logger:        logger,
-				youtubeClient: s.youtubeClient,
-				tg:            sender,
-			},
-		); err != nil {
+		if err = session.SendEvent(ctx, ParseVideoEvent, parsingCtx); err != nil {
 			return fmt.Errorf("send session event: %w", err)
 		}
 	}
 
-	if err := session.Flush(ctx); err != nil {
+	if err = session.Flush(ctx); err != nil {
+		// the event action has already run and is not safe to repeat, the concurrent update of the session wins
+		// and the user is asked to send the message again
+		if errors.Is(err, botstate.ErrSessionConflict) {
+			logger.Warnf("user %d session: %v", userID, err)
+			if _, err = sender.Send(tgbotapi.NewMessage(message.Chat.ID, SessionConflictMessage)); err != nil {
+				return fmt.Errorf("send message: %w", err)
+			}
+
+			return nil
+		}
+
 		return fmt.Errorf("session flush: %w", err)
 	}
 
@@ -284,33 +406,62 @@ func (s *Dispatcher) handleMessage(ctx context.Context, sender TelegramSender, m
 }
 
 const (
-	StartCommandText = "start"
+	StartCommandText   = "start"
+	HistoryCommandText = "history"
 )
 
 var StartCommandMessage = "Hi, this is a bot" + emoji.Robot.String() + " for downloading videos from youtube\n\n" +
 	"Just send a link to the youtube video and follow the further instructions\n" +
 	"\n*source code:* [github](https://github.com/robotomize/cribe)"
 
-func (s *Dispatcher) dispatchingMessages(ctx context.Context, sender TelegramSender, updates tgbotapi.UpdatesChannel) {
-	logger := logging.FromContext(ctx).Named("Dispatcher.dispatchingMessages")
+// dispatchingMessages handles the updates of one shard in order
+func (s *Dispatcher) dispatchingMessages(ctx context.Context, sender TelegramSender, updates <-chan tgbotapi.Update) {
 	for update := range updates {
-		if update.Message != nil {
-			if update.Message.IsCommand() {
-				cmd := update.Message.Command()
-				if cmd == StartCommandText {
-					config := tgbotapi.NewMessage(update.Message.Chat.ID, StartCommandMessage)
-					config.ParseMode = tgbotapi.ModeMarkdown
-					if _, err := sender.Send(config); err != nil {
-						logger.Errorf("send message: %v", err)
-					}
-				}
-				return
-			}
+		s.dispatchUpdate(ctx, sender, update)
+	}
+}
+
+func (s *Dispatcher) dispatchUpdate(ctx context.Context, sender TelegramSender, update tgbotapi.Update) {
+	logger := logging.FromContext(ctx).Named("Dispatcher.dispatchingMessages")
+	if update.CallbackQuery != nil {
+		if err := s.handleCallback(ctx, sender, update.CallbackQuery); err != nil {
+			logger.Errorf("handle telegram callback: %v", err)
+		}
+
+		return
+	}
+
+	if update.Message == nil {
+		return
+	}
 
-			if err := s.handleMessage(ctx, sender, update.Message); err != nil {
-				logger.Errorf("handle telegram message: %v", err)
+	if err := s.register(ctx, update.Message); err != nil {
+		logger.Errorf("register message sender: %v", err)
+	}
+
+	if update.Message.IsCommand() {
+		switch update.Message.Command() {
+		case StartCommandText:
+			config := tgbotapi.NewMessage(update.Message.Chat.ID, StartCommandMessage)
+			config.ParseMode = tgbotapi.ModeMarkdown
+			if _, err := sender.Send(config); err != nil {
+				logger.Errorf("send message: %v", err)
+			}
+		case HistoryCommandText:
+			if err := s.handleHistoryCommand(ctx, sender, update.Message); err != nil {
+				logger.Errorf("handle history command: %v", err)
+			}
+		case ReportCommandText:
+			if err := s.handleReportCommand(ctx, sender, update.Message); err != nil {
+				logger.Errorf("handle report command: %v", err)
 			}
 		}
+
+		return
+	}
+
+	if err := s.handleMessage(ctx, sender, update.Message); err != nil {
+		logger.Errorf("handle telegram message: %v", err)
 	}
 }
 
@@ -354,16 +505,17 @@ func (s *Dispatcher) consumingVideoFetching(ctx context.Context, sender Telegram
 		s.Jobs = append(
 			s.Jobs, Job{
 				Kind:    JobKindFetching,
-				Payload: Payload{VideoID: payload.VideoID, ChatID: payload.ChatID},
+				Payload: Payload{VideoID: payload.VideoID, ChatID: payload.ChatID, UserID: payload.UserID},
 			},
 		)
 		s.mtx.Unlock()
 
-		if err = s.fetch(ctx, channel, payload); err != nil {
+		if err = s.fetch(ctx, sender, channel, &payload); err != nil {
 			if !errors.Is(err, context.Canceled) {
 				logger.Errorf("fetching video: %v", err)
+				s.recordOutcome(ctx, payload, db.OutcomeFailed)
 
-				if _, err = sender.Send(tgbotapi.NewMessage(payload.ChatID, SendingMessageError)); err != nil {
+				if _, err = sender.Send(tgbotapi.NewMessage(payload.ChatID, errorMessage(err))); err != nil {
 					logger.Errorf("send message: %v", err)
 					continue
 				}
@@ -419,8 +571,14 @@ func (s *Dispatcher) consumingVideoUploading(ctx context.Context, sender Telegra
 		s.mtx.Lock()
 		s.Jobs = append(
 			s.Jobs, Job{
-				Kind:    JobKindUploading,
-				Payload: Payload{VideoID: payload.VideoID, ChatID: payload.ChatID},
+				Kind: JobKindUploading,
+				Payload: Payload{
+					VideoID: payload.VideoID,
+					ChatID:  payload.ChatID,
+					UserID:  payload.UserID,
+					Mime:    payload.Mime,
+					Quality: payload.Quality,
+				},
 			},
 		)
 		s.mtx.Unlock()
@@ -428,6 +586,7 @@ func (s *Dispatcher) consumingVideoUploading(ctx context.Context, sender Telegra
 		if err = s.upload(ctx, sender, payload); err != nil {
 			if !errors.Is(err, context.Canceled) {
 				logger.Errorf("uploading video: %v", err)
+				s.recordOutcome(ctx, payload, db.OutcomeFailed)
 
 				if _, err = sender.Send(tgbotapi.NewMessage(payload.ChatID, SendingMessageError)); err != nil {
 					logger.Errorf("send message: %v", err)
@@ -454,23 +613,27 @@ func (s *Dispatcher) deleteJob(videoID string, kind JobKind) {
 	}
 }
 
-func provideFSM() *botstate.StateMachine {
-	return botstate.NewStateMachine(
-		botstate.States{
-			botstate.Default: botstate.State{
-				Action: &DefaultAction{},
-				Events: botstate.Events{
-					ParseVideoEvent: ParsingVideoState,
-				},
+func provideFSM() (*botstate.StateMachine[ParsingCtx], error) {
+	return botstate.NewStateMachine(fsmStates())
+}
+
+// fsmStates are the states of the conversation with a user, testdata/fsm.dot and testdata/fsm.mmd draw them
+func fsmStates() botstate.States[ParsingCtx] {
+	return botstate.States[ParsingCtx]{
+		botstate.Default: {
+			Action: &DefaultAction{},
+			Events: botstate.Events{
+				ParseVideoEvent: ParsingVideoState,
 			},
-			ParsingVideoState: botstate.State{
-				Action: &ParsingAction{},
-				Events: botstate.Events{
-					GoToDefaultEvent: botstate.Default,
-				},
+		},
+		ParsingVideoState: {
+			Action: &ParsingAction{},
+			Events: botstate.Events{
+				GoToDefaultEvent: botstate.Default,
 			},
+			Timeout: ParsingVideoTimeout,
 		},
-	)
+	}
 }
 
 const (
@@ -484,70 +647,74 @@ type Payload struct {
 	Quality string `json:"quality"`
 	VideoID string `json:"video_id"`
 	ChatID  int64  `json:"chat_id"`
+	UserID  int64  `json:"user_id,omitempty"`
 }
 
 type DefaultAction struct{}
 
-func (p *DefaultAction) Execute(_ botstate.EventContext) botstate.EventType {
-	return botstate.Noop
+func (p *DefaultAction) Execute(_ context.Context, _ ParsingCtx) (botstate.EventType, error) {
+	return botstate.Noop, nil
 }
 
+// ParsingCtx is the event context of the user session machine
 type ParsingCtx struct {
-	ctx           context.Context
 	broker        AMQPConnection
 	tg            TelegramSender
 	youtubeClient YoutubeClient
 	logger        *zap.SugaredLogger
 	message       string
 	chatID        int64
+	userID        int64
 }
 
 type ParsingAction struct{}
 
-func (p *ParsingAction) Execute(eventCtx botstate.EventContext) botstate.EventType {
-	ctx := eventCtx.(ParsingCtx)
-	logger := ctx.logger.Named("ParsingAction.Execute")
+// Execute publishes the video of the message to the fetching queue, failures are reported to the user and the
+// session goes back to Default
+func (p *ParsingAction) Execute(ctx context.Context, eventCtx ParsingCtx) (botstate.EventType, error) {
+	logger := eventCtx.logger.Named("ParsingAction.Execute")
 	nextState := GoToDefaultEvent
 
-	video, err := ctx.youtubeClient.GetVideoContext(ctx.ctx, ctx.message)
+	video, err := eventCtx.youtubeClient.GetVideoContext(ctx, eventCtx.message)
 	if err != nil {
 		logger.Warnf("parsing video metadata: %v", err)
-		if _, err = ctx.tg.Send(tgbotapi.NewMessage(ctx.chatID, SendingMessageError)); err != nil {
+		if _, err = eventCtx.tg.Send(tgbotapi.NewMessage(eventCtx.chatID, errorMessage(err))); err != nil {
 			logger.Errorf("send message: %v", err)
 
-			return nextState
+			return nextState, nil
 		}
 
-		return nextState
+		return nextState, nil
 	}
 
 	encoded, err := json.Marshal(
 		Payload{
 			VideoID: video.ID,
-			ChatID:  ctx.chatID,
+			ChatID:  eventCtx.chatID,
+			UserID:  eventCtx.userID,
 		},
 	)
 	if err != nil {
 		logger.Errorf("json marshal: %v", err)
-		if _, err = ctx.tg.Send(tgbotapi.NewMessage(ctx.chatID, SendingMessageError)); err != nil {
+		if _, err = eventCtx.tg.Send(tgbotapi.NewMessage(eventCtx.chatID, SendingMessageError)); err != nil {
 			logger.Errorf("sending message: %v", err)
 
-			return nextState
+			return nextState, nil
 		}
 
-		return nextState
+		return nextState, nil
 	}
 
-	channel, err := ctx.broker.Chan()
+	channel, err := eventCtx.broker.Chan()
 	if err != nil {
 		logger.Errorf("parsing action, asquire amqp chan: %v", err)
-		if _, err = ctx.tg.Send(tgbotapi.NewMessage(ctx.chatID, SendingMessageError)); err != nil {
+		if _, err = eventCtx.tg.Send(tgbotapi.NewMessage(eventCtx.chatID, SendingMessageError)); err != nil {
 			logger.Errorf("sending message: %v", err)
 
-			return nextState
+			return nextState, nil
 		}
 
-		return nextState
+		return nextState, nil
 	}
 
 	defer channel.Close()
@@ -559,21 +726,21 @@ func (p *ParsingAction) Execute(eventCtx botstate.EventContext) botstate.EventTy
 		},
 	); err != nil {
 		logger.Errorf("publish message to fetching queue: %v", err)
-		if _, err = ctx.tg.Send(tgbotapi.NewMessage(ctx.chatID, SendingMessageError)); err != nil {
+		if _, err = eventCtx.tg.Send(tgbotapi.NewMessage(eventCtx.chatID, SendingMessageError)); err != nil {
 			logger.Errorf("sending message: %v", err)
-			return nextState
+			return nextState, nil
 		}
 
-		return nextState
+		return nextState, nil
 	}
 
-	if _, err = ctx.tg.Send(
-		tgbotapi.NewMessage(ctx.chatID, "Starting to download the video"),
+	if _, err = eventCtx.tg.Send(
+		tgbotapi.NewMessage(eventCtx.chatID, StartDownloadMessage),
 	); err != nil {
 		logger.Errorf("send message: %v", err)
 
-		return nextState
+		return nextState, nil
 	}
 
-	return nextState
+	return nextState, nil
 }
@@ -392,6 +392,15 @@ func TestDispatcher_fetch(t *testing.T) {
 				EXPECT().
 				Save(gomock.Any(), gomock.Any()).
 				Return(tc.saveMetaErr).AnyTimes()
+			deps.metadata.
+				EXPECT().
+				FetchByKeys(gomock.Any(), gomock.Any()).
+				Return([]db.Metadata{tc.metadata}, tc.metadataErr).
+				AnyTimes()
+			deps.metadata.
+				EXPECT().
+				SaveBatch(gomock.Any(), gomock.Any()).
+				Return(tc.saveMetaErr).AnyTimes()
 			deps.storage.
 				EXPECT().
 				CreateObject(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
@@ -423,10 +432,16 @@ func TestDispatcher_fetch(t *testing.T) {
 			d.metadataDB = deps.metadata
 			d.storage = deps.storage
 
-			err := d.fetch(context.Background(), deps.channel, tc.payload)
+			payload := tc.payload
+			err := d.fetch(context.Background(), NewMockTelegramSender(deps.ctrl), deps.channel, &payload)
 			if (err != nil) && tc.err == nil {
 				t.Errorf("got: %t, expected: %t", err != nil, tc.err == nil)
 			}
+
+			// the resolved format is left in the payload for the history
+			if err == nil && payload.Quality != DefaultQuality {
+				t.Errorf("payload quality got: %q, expected: %q", payload.Quality, DefaultQuality)
+			}
 		})
 	}
 }
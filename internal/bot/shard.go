@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"context"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// updateShards routes telegram updates to a fixed set of bounded queues by the sender, so the updates of one
+// user are handled in order by one worker while the updates of different users are handled in parallel
+type updateShards struct {
+	queues []chan tgbotapi.Update
+}
+
+func newUpdateShards(n, size int) *updateShards {
+	if n < 1 {
+		n = 1
+	}
+
+	queues := make([]chan tgbotapi.Update, n)
+	for i := range queues {
+		queues[i] = make(chan tgbotapi.Update, size)
+	}
+
+	return &updateShards{queues: queues}
+}
+
+// run routes the updates until the channel is closed or ctx is done, then closes the queues. A full queue
+// stops the routing until its worker catches up, the telegram poller is held back in turn
+func (u *updateShards) run(ctx context.Context, updates tgbotapi.UpdatesChannel) {
+	defer func() {
+		for _, q := range u.queues {
+			close(q)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+
+			if err := u.route(ctx, update); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// route puts the update to the queue of its shard, it blocks while the queue is full
+func (u *updateShards) route(ctx context.Context, update tgbotapi.Update) error {
+	select {
+	case u.queues[u.shard(updateKey(update))] <- update:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (u *updateShards) shard(key int64) int {
+	return int(uint64(key) % uint64(len(u.queues)))
+}
+
+// updateKey returns the id the updates are ordered by: the sender, sessions are kept per user, or the chat
+// for messages without one
+func updateKey(update tgbotapi.Update) int64 {
+	switch {
+	case update.Message != nil:
+		if update.Message.From != nil {
+			return int64(update.Message.From.ID)
+		}
+
+		if update.Message.Chat != nil {
+			return update.Message.Chat.ID
+		}
+	case update.CallbackQuery != nil:
+		if update.CallbackQuery.From != nil {
+			return int64(update.CallbackQuery.From.ID)
+		}
+	}
+
+	return 0
+}
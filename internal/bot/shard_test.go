@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestUpdateShards_run(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	shards := newUpdateShards(4, 100)
+	updates := make(chan tgbotapi.Update)
+
+	go shards.run(ctx, updates)
+
+	expected := make(map[int][]int)
+	for i := 0; i < 60; i++ {
+		userID := i % 6
+		update := tgbotapi.Update{
+			UpdateID: i,
+			Message:  &tgbotapi.Message{From: &tgbotapi.User{ID: userID}, Chat: &tgbotapi.Chat{ID: -1}},
+		}
+		if userID%2 == 0 {
+			update = tgbotapi.Update{
+				UpdateID:      i,
+				CallbackQuery: &tgbotapi.CallbackQuery{From: &tgbotapi.User{ID: userID}},
+			}
+		}
+
+		expected[userID] = append(expected[userID], i)
+		updates <- update
+	}
+
+	close(updates)
+
+	got := make(map[int][]int)
+	for i, q := range shards.queues {
+		for update := range q {
+			key := int(updateKey(update))
+			if shard := shards.shard(int64(key)); shard != i {
+				t.Errorf("update of %d got shard: %d, expected: %d", key, i, shard)
+			}
+
+			got[key] = append(got[key], update.UpdateID)
+		}
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("updates by user got: %v, expected: %v", got, expected)
+	}
+}
+
+func TestUpdateShards_route(t *testing.T) {
+	t.Parallel()
+
+	shards := newUpdateShards(1, 1)
+	update := tgbotapi.Update{Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}}}
+	if err := shards.route(context.Background(), update); err != nil {
+		t.Fatalf("route: %v", err)
+	}
+
+	// the queue is full, the routing waits for the worker until ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := shards.route(ctx, update); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("route to a full queue got: %v, expected: %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestUpdateKey(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		update   tgbotapi.Update
+		expected int64
+	}{
+		{
+			name: "test_message_sender",
+			update: tgbotapi.Update{
+				Message: &tgbotapi.Message{From: &tgbotapi.User{ID: 7}, Chat: &tgbotapi.Chat{ID: -100}},
+			},
+			expected: 7,
+		},
+		{
+			name:     "test_channel_post_chat",
+			update:   tgbotapi.Update{Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: -100}}},
+			expected: -100,
+		},
+		{
+			name:     "test_callback_sender",
+			update:   tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{From: &tgbotapi.User{ID: 8}}},
+			expected: 8,
+		},
+		{
+			name: "test_other",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if got := updateKey(tc.update); got != tc.expected {
+				t.Errorf("update key got: %d, expected: %d", got, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/robotomize/cribe/internal/db"
+	"github.com/robotomize/cribe/internal/logging"
+	"github.com/streadway/amqp"
+)
+
+// MaxFileIDFailures is the number of file ids of a video telegram may reject in a row before
+// the video is no longer fetched again automatically
+const MaxFileIDFailures = 3
+
+var ErrFileIDRejected = errors.New("telegram rejected the video file id")
+
+// invalidFileIDReasons match the whole descriptions telegram answers a file id it does not know with
+var invalidFileIDReasons = []*regexp.Regexp{
+	regexp.MustCompile(`^Bad Request: wrong file identifier/HTTP URL specified$`),
+	regexp.MustCompile(`^Bad Request: wrong remote file identifier specified(: .+)?$`),
+	regexp.MustCompile(`^Bad Request: FILE_REFERENCE_(\d+_)?EXPIRED$`),
+	regexp.MustCompile(`^Bad Request: FILE_ID_INVALID$`),
+	regexp.MustCompile(`^Bad Request: MEDIA_EMPTY$`),
+}
+
+// shareVideo sends the video by its cached file id. A file id telegram rejects is dropped from the metadata
+// and a fresh fetch of the video is enqueued, so the next upload stores a valid one
+func (s *Dispatcher) shareVideo(ctx context.Context, sender TelegramSender, metadata db.Metadata, payload Payload) error {
+	config := tgbotapi.NewVideoShare(payload.ChatID, metadata.FileID)
+	config.Caption = videoCaption(metadata.Params)
+	if _, err := sender.Send(config); err != nil {
+		if !isInvalidFileID(err) {
+			return fmt.Errorf("send message with video: %w", err)
+		}
+
+		return s.healFileID(ctx, metadata, payload, err)
+	}
+
+	logger := logging.FromContext(ctx).Named("Dispatcher.shareVideo")
+	if metadata.FileIDFailures > 0 {
+		metadata.FileIDFailures = 0
+		if err := s.metadataDB.Save(ctx, metadata); err != nil {
+			logger.Errorf("reset file id failures: %v", err)
+		}
+	}
+
+	DeliveryMetrics.Add("file_id_hits", 1)
+	if err := s.metadataDB.Touch(ctx, metadata.VideoID, metadata.Mime, metadata.Quality, time.Now()); err != nil {
+		logger.Errorf("touch metadata: %v", err)
+	}
+
+	s.recordOutcome(ctx, payload, db.OutcomeDelivered)
+
+	return nil
+}
+
+func (s *Dispatcher) healFileID(ctx context.Context, metadata db.Metadata, payload Payload, cause error) error {
+	logger := logging.FromContext(ctx).Named("Dispatcher.healFileID")
+
+	metadata.FileID = ""
+	metadata.FileIDFailures++
+	if err := s.metadataDB.Save(ctx, metadata); err != nil {
+		return fmt.Errorf("clear rejected file id: %w", err)
+	}
+
+	if metadata.FileIDFailures >= MaxFileIDFailures {
+		return fmt.Errorf(
+			"%w: video %s failed %d times in a row: %v", ErrFileIDRejected, metadata.VideoID, metadata.FileIDFailures, cause,
+		)
+	}
+
+	logger.Warnf("file id of video %s rejected, fetching it again: %v", metadata.VideoID, cause)
+
+	return s.enqueueFetch(payload)
+}
+
+// enqueueFetch publishes a fetch of the payload video, the format is picked by the fetcher again
+func (s *Dispatcher) enqueueFetch(payload Payload) error {
+	encoded, err := json.Marshal(Payload{VideoID: payload.VideoID, ChatID: payload.ChatID, UserID: payload.UserID})
+	if err != nil {
+		return fmt.Errorf("json marshal: %w", err)
+	}
+
+	channel, err := s.broker.Chan()
+	if err != nil {
+		return fmt.Errorf("can not create broker channel: %w", err)
+	}
+
+	defer channel.Close()
+
+	if _, err = channel.QueueDeclare(QueueFetching, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("can not declare broker queue: %w", err)
+	}
+
+	if err = channel.Publish(
+		"", QueueFetching, false, false, amqp.Publishing{
+			ContentType: "application/json",
+			Body:        encoded,
+		},
+	); err != nil {
+		return fmt.Errorf("publish message to fetching queue: %w", err)
+	}
+
+	return nil
+}
+
+func isInvalidFileID(err error) bool {
+	var tgErr tgbotapi.Error
+	if !errors.As(err, &tgErr) || tgErr.Code != http.StatusBadRequest {
+		return false
+	}
+
+	for _, reason := range invalidFileIDReasons {
+		if reason.MatchString(tgErr.Message) {
+			return true
+		}
+	}
+
+	return false
+}
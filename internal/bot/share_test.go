@@ -0,0 +1,177 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/golang/mock/gomock"
+	"github.com/robotomize/cribe/internal/db"
+)
+
+func TestIsInvalidFileID(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name:     "test_wrong_file_identifier",
+			err:      tgbotapi.Error{Code: 400, Message: "Bad Request: wrong file identifier/HTTP URL specified"},
+			expected: true,
+		},
+		{
+			name:     "test_wrong_remote_file_identifier",
+			err:      tgbotapi.Error{Code: 400, Message: "Bad Request: wrong remote file identifier specified: Wrong padding"},
+			expected: true,
+		},
+		{
+			name:     "test_wrapped",
+			err:      fmt.Errorf("send: %w", tgbotapi.Error{Code: 400, Message: "Bad Request: FILE_ID_INVALID"}),
+			expected: true,
+		},
+		{
+			name:     "test_file_reference_expired",
+			err:      tgbotapi.Error{Code: 400, Message: "Bad Request: FILE_REFERENCE_0_EXPIRED"},
+			expected: true,
+		},
+		{
+			name: "test_reason_inside_other_bad_request",
+			err:  tgbotapi.Error{Code: 400, Message: "Bad Request: can't parse entities: wrong file identifier in caption"},
+		},
+		{
+			name: "test_other_bad_request",
+			err:  tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"},
+		},
+		{
+			name: "test_reason_not_bad_request",
+			err:  tgbotapi.Error{Code: 500, Message: "Bad Request: FILE_ID_INVALID"},
+		},
+		{
+			name: "test_forbidden",
+			err:  tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"},
+		},
+		{
+			name: "test_not_telegram",
+			err:  errors.New("wrong file identifier"),
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if got := isInvalidFileID(tc.err); got != tc.expected {
+				t.Errorf("isInvalidFileID(%v) got: %v, expected: %v", tc.err, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestDispatcher_shareVideo(t *testing.T) {
+	t.Parallel()
+
+	rejected := tgbotapi.Error{Code: 400, Message: "Bad Request: wrong file identifier/HTTP URL specified"}
+	testCases := []struct {
+		name     string
+		failures int
+		sendErr  error
+		saved    bool
+		touched  bool
+		enqueued bool
+		expected int
+		err      error
+	}{
+		{
+			name:    "test_shared",
+			touched: true,
+		},
+		{
+			name:     "test_shared_resets_failures",
+			failures: 2,
+			saved:    true,
+			touched:  true,
+		},
+		{
+			name:     "test_rejected_enqueues_fetch",
+			sendErr:  rejected,
+			saved:    true,
+			enqueued: true,
+			expected: 1,
+		},
+		{
+			name:     "test_rejected_too_often",
+			failures: MaxFileIDFailures - 1,
+			sendErr:  rejected,
+			saved:    true,
+			expected: MaxFileIDFailures,
+			err:      ErrFileIDRejected,
+		},
+		{
+			name:    "test_send_error",
+			sendErr: errors.New("mock error"),
+			err:     errors.New("mock error"),
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ctrl := gomock.NewController(t)
+			sender := NewMockTelegramSender(ctrl)
+			metadataDB := NewMockMetadataDB(ctrl)
+			broker := NewMockAMQPConnection(ctrl)
+			channel := NewMockAMQPChannel(ctrl)
+
+			metadata := db.Metadata{VideoID: "video", FileID: "file", FileIDFailures: tc.failures}
+			sender.EXPECT().Send(gomock.Any()).Return(tgbotapi.Message{}, tc.sendErr)
+
+			if tc.saved {
+				metadataDB.
+					EXPECT().
+					Save(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, model db.Metadata) error {
+						if model.FileIDFailures != tc.expected {
+							t.Errorf("saved failures got: %d, expected: %d", model.FileIDFailures, tc.expected)
+						}
+
+						if tc.sendErr != nil && model.FileID != "" {
+							t.Errorf("rejected file id is kept: %q", model.FileID)
+						}
+
+						return nil
+					})
+			}
+
+			if tc.touched {
+				metadataDB.EXPECT().Touch(gomock.Any(), "video", "", "", gomock.Any()).Return(nil)
+			}
+
+			if tc.enqueued {
+				broker.EXPECT().Chan().Return(channel, nil)
+				channel.EXPECT().QueueDeclare(QueueFetching, true, false, false, false, nil)
+				channel.EXPECT().Publish("", QueueFetching, false, false, gomock.Any()).Return(nil)
+				channel.EXPECT().Close().Return(nil)
+			}
+
+			d := &Dispatcher{metadataDB: metadataDB, broker: broker}
+			err := d.shareVideo(context.Background(), sender, metadata, Payload{VideoID: "video", ChatID: 1})
+			if tc.err == nil && err != nil {
+				t.Fatalf("shareVideo: %v", err)
+			}
+
+			if tc.err != nil && err == nil {
+				t.Fatalf("shareVideo got: nil, expected: %v", tc.err)
+			}
+
+			if errors.Is(tc.err, ErrFileIDRejected) && !errors.Is(err, ErrFileIDRejected) {
+				t.Errorf("shareVideo got: %v, expected: %v", err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/kkdai/youtube/v2"
+	"github.com/robotomize/cribe/internal/db"
+	"github.com/robotomize/cribe/internal/logging"
+)
+
+// UnavailableMessages answer links to videos youtube refuses to serve, by reason
+var UnavailableMessages = map[db.UnavailableReason]string{
+	db.ReasonPrivate:       "This video is private, it can not be downloaded",
+	db.ReasonRemoved:       "This video has been removed from YouTube",
+	db.ReasonMembersOnly:   "This video is available to channel members only",
+	db.ReasonRegionBlocked: "This video is not available in the bot's country",
+	db.ReasonAgeRestricted: "This video is age restricted, it can not be downloaded",
+	db.ReasonUnavailable:   "This video is unavailable on YouTube",
+}
+
+// UnavailableError is returned for a video youtube refused to serve, now or recently
+type UnavailableError struct {
+	VideoID string
+	Reason  db.UnavailableReason
+	Details string
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("video %s is unavailable: %s %s", e.VideoID, e.Reason, e.Details)
+}
+
+// errorMessage returns the answer to a failed request, specific when the video is unavailable
+func errorMessage(err error) string {
+	var unavailable *UnavailableError
+	if errors.As(err, &unavailable) {
+		if message, ok := UnavailableMessages[unavailable.Reason]; ok {
+			return message
+		}
+	}
+
+	return SendingMessageError
+}
+
+// newNegativeCache returns the client remembering the videos youtube refuses to serve for ttl, requests for them
+// fail with an UnavailableError without reaching youtube
+func newNegativeCache(client YoutubeClient, store UnavailableDB, ttl time.Duration) *negativeCache {
+	return &negativeCache{client: client, store: store, ttl: ttl, timeFn: time.Now}
+}
+
+var _ YoutubeClient = (*negativeCache)(nil)
+
+type negativeCache struct {
+	client YoutubeClient
+	store  UnavailableDB
+	ttl    time.Duration
+	timeFn func() time.Time
+}
+
+func (c *negativeCache) GetVideoContext(ctx context.Context, url string) (*youtube.Video, error) {
+	logger := logging.FromContext(ctx).Named("negativeCache.GetVideoContext")
+
+	// a link without a video id fails in the client the same way it would here
+	videoID, idErr := youtube.ExtractVideoID(url)
+	if idErr == nil {
+		entry, err := c.store.FetchByVideoID(ctx, videoID)
+		if err == nil {
+			return nil, &UnavailableError{VideoID: videoID, Reason: entry.Reason, Details: entry.Details}
+		}
+
+		if !errors.Is(err, db.ErrNotFound) {
+			logger.Errorf("fetch unavailable video: %v", err)
+		}
+	}
+
+	video, err := c.client.GetVideoContext(ctx, url)
+	if err != nil {
+		reason, details, ok := classifyUnavailable(err)
+		if !ok || idErr != nil {
+			return nil, err
+		}
+
+		now := c.timeFn()
+		if saveErr := c.store.Save(ctx, db.Unavailable{
+			VideoID:   videoID,
+			Reason:    reason,
+			Details:   details,
+			CreatedAt: now,
+			ExpiresAt: now.Add(c.ttl),
+		}); saveErr != nil {
+			logger.Errorf("save unavailable video: %v", saveErr)
+		}
+
+		return nil, fmt.Errorf("%w: %v", &UnavailableError{VideoID: videoID, Reason: reason, Details: details}, err)
+	}
+
+	return video, nil
+}
+
+func (c *negativeCache) GetStreamContext(
+	ctx context.Context, video *youtube.Video, format *youtube.Format,
+) (io.ReadCloser, int64, error) {
+	return c.client.GetStreamContext(ctx, video, format)
+}
+
+// classifyUnavailable tells whether the error means youtube refuses to serve the video, as opposed to a failure
+// worth retrying. The reason is read from the playability status youtube reports, only the statuses known to be
+// permanent are remembered
+func classifyUnavailable(err error) (db.UnavailableReason, string, bool) {
+	var status *youtube.ErrPlayabiltyStatus
+	if !errors.As(err, &status) {
+		return "", "", false
+	}
+
+	reason := strings.ToLower(status.Reason)
+	switch {
+	// youtube asks to sign in when it limits the requests of the bot, not because of the video
+	case strings.Contains(reason, "not a bot"):
+		return "", "", false
+	case strings.Contains(reason, "private"):
+		return db.ReasonPrivate, status.Reason, true
+	case strings.Contains(reason, "members"), strings.Contains(reason, "join this channel"):
+		return db.ReasonMembersOnly, status.Reason, true
+	case strings.Contains(reason, "country"):
+		return db.ReasonRegionBlocked, status.Reason, true
+	case strings.Contains(reason, "confirm your age"), strings.Contains(reason, "inappropriate for some users"):
+		return db.ReasonAgeRestricted, status.Reason, true
+	case strings.Contains(reason, "removed"), strings.Contains(reason, "terminated"),
+		strings.Contains(reason, "no longer available"):
+		return db.ReasonRemoved, status.Reason, true
+	}
+
+	switch status.Status {
+	case "LOGIN_REQUIRED":
+		return db.ReasonPrivate, status.Reason, true
+	case "ERROR", "UNPLAYABLE":
+		return db.ReasonUnavailable, status.Reason, true
+	default:
+		// an offline live stream and a premiere become available by themselves, an unknown status may be
+		// transient
+		return "", "", false
+	}
+}
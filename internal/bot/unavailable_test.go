@@ -0,0 +1,223 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kkdai/youtube/v2"
+	"github.com/robotomize/cribe/internal/db"
+)
+
+func TestClassifyUnavailable(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		err      error
+		expected db.UnavailableReason
+		ok       bool
+	}{
+		{
+			name:     "test_private",
+			err:      &youtube.ErrPlayabiltyStatus{Status: "LOGIN_REQUIRED", Reason: "This video is private"},
+			expected: db.ReasonPrivate,
+			ok:       true,
+		},
+		{
+			name:     "test_age_restricted",
+			err:      &youtube.ErrPlayabiltyStatus{Status: "LOGIN_REQUIRED", Reason: "Sign in to confirm your age"},
+			expected: db.ReasonAgeRestricted,
+			ok:       true,
+		},
+		{
+			name: "test_members_only",
+			err: &youtube.ErrPlayabiltyStatus{
+				Status: "UNPLAYABLE", Reason: "Join this channel to get access to members-only content like this video",
+			},
+			expected: db.ReasonMembersOnly,
+			ok:       true,
+		},
+		{
+			name: "test_region_blocked",
+			err: &youtube.ErrPlayabiltyStatus{
+				Status: "UNPLAYABLE", Reason: "The uploader has not made this video available in your country",
+			},
+			expected: db.ReasonRegionBlocked,
+			ok:       true,
+		},
+		{
+			name: "test_removed",
+			err: fmt.Errorf("wrapped: %w", &youtube.ErrPlayabiltyStatus{
+				Status: "ERROR", Reason: "This video has been removed by the uploader",
+			}),
+			expected: db.ReasonRemoved,
+			ok:       true,
+		},
+		{
+			name:     "test_error_status",
+			err:      &youtube.ErrPlayabiltyStatus{Status: "ERROR", Reason: "Video unavailable"},
+			expected: db.ReasonUnavailable,
+			ok:       true,
+		},
+		{
+			name: "test_not_embeddable",
+			err:  youtube.ErrNotPlayableInEmbed,
+		},
+		{
+			name: "test_unplayable",
+			err: &youtube.ErrPlayabiltyStatus{
+				Status: "UNPLAYABLE", Reason: "Playback on other websites has been disabled by the video owner",
+			},
+			expected: db.ReasonUnavailable,
+			ok:       true,
+		},
+		{
+			name: "test_unrecognized_status",
+			err:  &youtube.ErrPlayabiltyStatus{Status: "CONTENT_CHECK_REQUIRED", Reason: "Try again later"},
+		},
+		{
+			name: "test_rate_limited",
+			err:  &youtube.ErrPlayabiltyStatus{Status: "LOGIN_REQUIRED", Reason: "Sign in to confirm you're not a bot"},
+		},
+		{
+			name: "test_live_offline",
+			err:  &youtube.ErrPlayabiltyStatus{Status: "LIVE_STREAM_OFFLINE", Reason: "Premieres in 10 hours"},
+		},
+		{
+			name: "test_transient",
+			err:  youtube.ErrUnexpectedStatusCode(503),
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			reason, _, ok := classifyUnavailable(tc.err)
+			if ok != tc.ok || reason != tc.expected {
+				t.Errorf("classifyUnavailable got: %q %v, expected: %q %v", reason, ok, tc.expected, tc.ok)
+			}
+		})
+	}
+}
+
+func TestNegativeCache_GetVideoContext(t *testing.T) {
+	t.Parallel()
+
+	const videoID = "rFejpH_tAHM"
+	url := "https://www.youtube.com/watch?v=" + videoID
+	private := &youtube.ErrPlayabiltyStatus{Status: "LOGIN_REQUIRED", Reason: "This video is private"}
+	now := time.Date(2021, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name      string
+		url       string
+		entry     *db.Unavailable
+		clientErr error
+		saved     bool
+		fetched   bool
+		reason    db.UnavailableReason
+	}{
+		{
+			name:    "test_available",
+			url:     url,
+			fetched: true,
+		},
+		{
+			name:   "test_cached",
+			url:    url,
+			entry:  &db.Unavailable{VideoID: videoID, Reason: db.ReasonRemoved},
+			reason: db.ReasonRemoved,
+		},
+		{
+			name:      "test_remembered",
+			url:       url,
+			clientErr: private,
+			fetched:   true,
+			saved:     true,
+			reason:    db.ReasonPrivate,
+		},
+		{
+			name:      "test_transient_not_remembered",
+			url:       url,
+			clientErr: youtube.ErrUnexpectedStatusCode(503),
+			fetched:   true,
+		},
+		{
+			name:      "test_invalid_link",
+			url:       "abc?d",
+			clientErr: youtube.ErrInvalidCharactersInVideoID,
+			fetched:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ctrl := gomock.NewController(t)
+			client := NewMockYoutubeClient(ctrl)
+			store := NewMockUnavailableDB(ctrl)
+
+			if _, err := youtube.ExtractVideoID(tc.url); err == nil {
+				if tc.entry != nil {
+					store.EXPECT().FetchByVideoID(gomock.Any(), videoID).Return(*tc.entry, nil)
+				} else {
+					store.EXPECT().FetchByVideoID(gomock.Any(), videoID).Return(db.Unavailable{}, db.ErrNotFound)
+				}
+			}
+
+			if tc.fetched {
+				var video *youtube.Video
+				if tc.clientErr == nil {
+					video = &youtube.Video{ID: videoID}
+				}
+
+				client.EXPECT().GetVideoContext(gomock.Any(), tc.url).Return(video, tc.clientErr)
+			}
+
+			if tc.saved {
+				store.
+					EXPECT().
+					Save(gomock.Any(), db.Unavailable{
+						VideoID:   videoID,
+						Reason:    db.ReasonPrivate,
+						Details:   private.Reason,
+						CreatedAt: now,
+						ExpiresAt: now.Add(time.Hour),
+					}).
+					Return(nil)
+			}
+
+			c := newNegativeCache(client, store, time.Hour)
+			c.timeFn = func() time.Time { return now }
+
+			_, err := c.GetVideoContext(context.Background(), tc.url)
+
+			var unavailable *UnavailableError
+			if tc.reason != "" {
+				if !errors.As(err, &unavailable) || unavailable.Reason != tc.reason {
+					t.Fatalf("GetVideoContext got: %v, expected reason: %s", err, tc.reason)
+				}
+
+				if errorMessage(err) != UnavailableMessages[tc.reason] {
+					t.Errorf("errorMessage got: %q, expected: %q", errorMessage(err), UnavailableMessages[tc.reason])
+				}
+
+				return
+			}
+
+			if errors.As(err, &unavailable) {
+				t.Fatalf("GetVideoContext got: %v, expected no unavailable error", err)
+			}
+
+			if !errors.Is(err, tc.clientErr) {
+				t.Errorf("GetVideoContext got: %v, expected: %v", err, tc.clientErr)
+			}
+		})
+	}
+}
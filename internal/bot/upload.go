@@ -17,6 +17,7 @@ func (s *Dispatcher) upload(ctx context.Context, sender TelegramSender, payload
 	encoded, err := json.Marshal(Payload{
 		VideoID: payload.VideoID,
 		ChatID:  payload.ChatID,
+		UserID:  payload.UserID,
 	})
 	if err != nil {
 		return fmt.Errorf("unmarshal: %w", err)
@@ -50,16 +51,10 @@ func (s *Dispatcher) upload(ctx context.Context, sender TelegramSender, payload
 	}
 
 	if metadata.FileID != "" {
-		config := tgbotapi.NewVideoShare(payload.ChatID, metadata.FileID)
-		config.Caption = metadata.Params.Title
-		if _, err = sender.Send(config); err != nil {
-			return fmt.Errorf("send message with video: %w", err)
-		}
-
-		return nil
+		return s.shareVideo(ctx, sender, metadata, payload)
 	}
 
-	file, err := s.storage.GetObject(ctx, s.opts.Bucket, payload.VideoID)
+	file, err := s.getObject(ctx, payload)
 	if err != nil {
 		if errors.Is(err, storage.ErrNotFound) {
 			if err = channel.Publish(
@@ -76,13 +71,17 @@ func (s *Dispatcher) upload(ctx context.Context, sender TelegramSender, payload
 		return fmt.Errorf("get object from storage: %w", err)
 	}
 
+	if int64(len(file)) > s.opts.MaxUploadSize {
+		return s.shareLink(ctx, sender, channel, metadata, payload)
+	}
+
 	params := map[string]string{
 		"chat_id":              strconv.Itoa(int(payload.ChatID)),
 		"width":                strconv.Itoa(metadata.Params.Width),
 		"height":               strconv.Itoa(metadata.Params.Height),
 		"duration":             strconv.Itoa(metadata.Params.Duration),
 		"thumb":                metadata.Params.Thumb,
-		"caption":              metadata.Params.Title,
+		"caption":              videoCaption(metadata.Params),
 		"disable_notification": "true",
 	}
 	resp, err := sender.UploadFileWithContext(ctx, "sendVideo", params, "video", tgbotapi.FileBytes{
@@ -113,7 +112,12 @@ func (s *Dispatcher) upload(ctx context.Context, sender TelegramSender, payload
 		return fmt.Errorf("saving metadata: %w", err)
 	}
 
-	if err = s.storage.DeleteObject(ctx, s.opts.Bucket, metadata.VideoID); err != nil {
+	DeliveryMetrics.Add("uploads", 1)
+	s.recordOutcome(ctx, payload, db.OutcomeDelivered)
+
+	if err = s.storage.DeleteObject(
+		ctx, s.opts.Bucket, storage.ObjectKey(metadata.VideoID, metadata.Mime, metadata.Quality),
+	); err != nil {
 		return fmt.Errorf("delete object from storage: %w", err)
 	}
 
@@ -0,0 +1,165 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/robotomize/cribe/internal/db"
+	"github.com/robotomize/cribe/internal/logging"
+	"github.com/robotomize/cribe/internal/storage"
+)
+
+// DeliveryMetrics count the delivered videos, published as delivery. A file id hit sends a video telegram
+// already stores, an upload sends the video to telegram first
+var DeliveryMetrics = expvar.NewMap("delivery")
+
+func init() {
+	DeliveryMetrics.Set("hit_ratio", expvar.Func(func() interface{} {
+		hits := expvarInt(DeliveryMetrics, "file_id_hits")
+
+		return hitRatio(hits, hits+expvarInt(DeliveryMetrics, "uploads"))
+	}))
+}
+
+const (
+	ReportCommandText = "report"
+	// ReportSize is the number of the most requested videos listed by the report
+	ReportSize        = 10
+	ReportEmptyTitle  = "Nothing has been requested yet"
+	reportTitleMaxLen = 48
+)
+
+// retentionInterval is how often the metadata not accessed for the retention period is purged
+const retentionInterval = time.Hour
+
+// purgingUnused purges the unused metadata every retentionInterval until the context is done,
+// it does nothing when the retention is off
+func (s *Dispatcher) purgingUnused(ctx context.Context) {
+	if s.opts.RetentionPeriod <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for {
+		s.purgeUnused(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeUnused purges the metadata not accessed for the retention period and deletes the stored objects of
+// the purged formats. An object that fails to delete is only logged, its metadata is gone already
+func (s *Dispatcher) purgeUnused(ctx context.Context) {
+	logger := logging.FromContext(ctx).Named("Dispatcher.purgeUnused")
+	purged, err := s.usageDB.PurgeUnused(ctx, time.Now().Add(-s.opts.RetentionPeriod), s.opts.RetentionArchive)
+	if err != nil {
+		logger.Errorf("purge unused metadata: %v", err)
+
+		return
+	}
+
+	if len(purged) == 0 {
+		return
+	}
+
+	logger.Infof("purged %d unused metadata, archived: %t", len(purged), s.opts.RetentionArchive)
+	for _, key := range purged {
+		if err = s.storage.DeleteObject(
+			ctx, s.opts.Bucket, storage.ObjectKey(key.VideoID, key.Mime, key.Quality),
+		); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			logger.Errorf("delete purged object: %v", err)
+		}
+	}
+}
+
+// handleReportCommand answers an admin with the usage report, anybody else is ignored
+func (s *Dispatcher) handleReportCommand(ctx context.Context, sender TelegramSender, message *tgbotapi.Message) error {
+	if !s.isAdmin(int64(message.From.ID)) {
+		return nil
+	}
+
+	requested, err := s.usageDB.MostRequested(ctx, ReportSize)
+	if err != nil {
+		return fmt.Errorf("most requested metadata: %w", err)
+	}
+
+	if _, err = sender.Send(tgbotapi.NewMessage(message.Chat.ID, usageReport(requested))); err != nil {
+		return fmt.Errorf("send message: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Dispatcher) isAdmin(userID int64) bool {
+	for _, id := range s.opts.AdminIDs {
+		if id == userID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// usageReport renders the most requested videos and the hit ratios counted since the start of the process
+func usageReport(requested []db.Metadata) string {
+	var b strings.Builder
+	if len(requested) == 0 {
+		b.WriteString(ReportEmptyTitle + "\n")
+	} else {
+		b.WriteString("Most requested videos\n")
+	}
+
+	for i, model := range requested {
+		title := model.Params.Title
+		if title == "" {
+			title = model.VideoID
+		}
+
+		fmt.Fprintf(
+			&b, "%d. %s (%s) %s, %d hits\n", i+1, truncate(title, reportTitleMaxLen), model.Quality, model.VideoID,
+			model.HitCount,
+		)
+	}
+
+	fileIDHits, uploads := expvarInt(DeliveryMetrics, "file_id_hits"), expvarInt(DeliveryMetrics, "uploads")
+	cacheHits := expvarInt(db.MetadataCacheMetrics, "local_hits") + expvarInt(db.MetadataCacheMetrics, "redis_hits")
+	cacheMisses := expvarInt(db.MetadataCacheMetrics, "misses")
+
+	b.WriteString("\nHit ratio since start\n")
+	fmt.Fprintf(
+		&b, "file id: %.1f%% of %d deliveries\n", 100*hitRatio(fileIDHits, fileIDHits+uploads), fileIDHits+uploads,
+	)
+	fmt.Fprintf(
+		&b, "metadata cache: %.1f%% of %d lookups", 100*hitRatio(cacheHits, cacheHits+cacheMisses),
+		cacheHits+cacheMisses,
+	)
+
+	return b.String()
+}
+
+func hitRatio(hits, total int64) float64 {
+	if total == 0 {
+		return 0.0
+	}
+
+	return float64(hits) / float64(total)
+}
+
+func expvarInt(m *expvar.Map, name string) int64 {
+	if v, ok := m.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+
+	return 0
+}
@@ -0,0 +1,153 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/golang/mock/gomock"
+	"github.com/robotomize/cribe/internal/db"
+	"github.com/robotomize/cribe/internal/storage"
+)
+
+func TestUsageReport(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		requested []db.Metadata
+		expected  []string
+	}{
+		{
+			name:     "test_empty",
+			expected: []string{ReportEmptyTitle, "file id: ", "metadata cache: "},
+		},
+		{
+			name: "test_requested",
+			requested: []db.Metadata{
+				{VideoID: "a", Quality: "hd720", HitCount: 12, Params: db.VideoParams{Title: "Go concurrency patterns"}},
+				{VideoID: "b", Quality: "medium", HitCount: 3},
+			},
+			expected: []string{
+				"Most requested videos",
+				"1. Go concurrency patterns (hd720) a, 12 hits",
+				"2. b (medium) b, 3 hits",
+				"file id: ",
+				"metadata cache: ",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			report := usageReport(tc.requested)
+			for _, line := range tc.expected {
+				if !strings.Contains(report, line) {
+					t.Errorf("usageReport got: %q, expected to contain: %q", report, line)
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcher_handleReportCommand(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		userID int
+		sent   bool
+	}{
+		{
+			name:   "test_admin",
+			userID: 1,
+			sent:   true,
+		},
+		{
+			name:   "test_not_admin",
+			userID: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ctrl := gomock.NewController(t)
+			sender := NewMockTelegramSender(ctrl)
+			usageDB := NewMockUsageDB(ctrl)
+
+			if tc.sent {
+				usageDB.
+					EXPECT().
+					MostRequested(gomock.Any(), ReportSize).
+					Return([]db.Metadata{{VideoID: "a", Quality: "hd720", HitCount: 1}}, nil)
+				sender.EXPECT().Send(gomock.Any()).Return(tgbotapi.Message{}, nil)
+			}
+
+			d := &Dispatcher{opts: Options{AdminIDs: []int64{1}}, usageDB: usageDB}
+			if err := d.handleReportCommand(context.Background(), sender, &tgbotapi.Message{
+				From: &tgbotapi.User{ID: tc.userID},
+				Chat: &tgbotapi.Chat{ID: 1},
+			}); err != nil {
+				t.Fatalf("handleReportCommand: %v", err)
+			}
+		})
+	}
+}
+
+func TestDispatcher_purgeUnused(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		purged   []db.MetadataKey
+		purgeErr error
+	}{
+		{
+			name: "test_purged",
+			purged: []db.MetadataKey{
+				{VideoID: "a", Mime: "video/mp4", Quality: "hd720"},
+				{VideoID: "b", Mime: `video/webm; codecs="vp9"`, Quality: "medium"},
+			},
+		},
+		{
+			name: "test_nothing_purged",
+		},
+		{
+			name:     "test_purge_error",
+			purgeErr: errors.New("mock error"),
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ctrl := gomock.NewController(t)
+			usageDB := NewMockUsageDB(ctrl)
+			blob := NewMockBlob(ctrl)
+
+			usageDB.EXPECT().PurgeUnused(gomock.Any(), gomock.Any(), true).Return(tc.purged, tc.purgeErr)
+			for _, key := range tc.purged {
+				// a failed delete does not stop the others
+				blob.
+					EXPECT().
+					DeleteObject(gomock.Any(), "bucket", storage.ObjectKey(key.VideoID, key.Mime, key.Quality)).
+					Return(errors.New("mock error"))
+			}
+
+			d := &Dispatcher{
+				opts:    Options{Bucket: "bucket", RetentionPeriod: time.Hour, RetentionArchive: true},
+				usageDB: usageDB,
+				storage: blob,
+			}
+			d.purgeUnused(context.Background())
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/robotomize/cribe/internal/logging"
+	"github.com/robotomize/cribe/internal/lru"
+)
+
+// MetadataCacheMetrics are the counters of every metadata cache, published as metadata_cache
+var MetadataCacheMetrics = expvar.NewMap("metadata_cache")
+
+// metadataRedisKeyPrefix names hashes of the entry data and generation, the plain string entries of
+// older releases were kept under cribe:metadata:
+const metadataRedisKeyPrefix = "cribe:metadata:v2:"
+
+type CacheConfig struct {
+	// Size is the number of entries kept in process, the cache is off when it is 0
+	Size int `env:"METADATA_CACHE_SIZE,default=10000"`
+	// TTL bounds how long an entry saved by another replica may be served stale from the process
+	TTL time.Duration `env:"METADATA_CACHE_TTL,default=1m"`
+	// RedisTTL is the expiration of entries in the shared redis tier
+	RedisTTL time.Duration `env:"METADATA_CACHE_REDIS_TTL,default=1h"`
+	// Redis enables the shared tier in the redis configured by the REDIS_* variables
+	Redis bool `env:"METADATA_CACHE_REDIS,default=false"`
+}
+
+// fillToken is taken before an entry is read from the store, a fill with it is dropped when the entry was
+// invalidated since. The redis generation is empty when it could not be read
+type fillToken struct {
+	local uint64
+	redis string
+}
+
+type cachedMetadata struct {
+	model   Metadata
+	expires time.Time
+}
+
+// NewMetadataCache returns a read-through cache of the store with an in-process LRU tier and,
+// when client is not nil, a redis tier shared by replicas. Missing records are never cached
+func NewMetadataCache(store MetadataStore, cfg CacheConfig, client redis.UniversalClient) *MetadataCache {
+	return &MetadataCache{
+		store:  store,
+		cfg:    cfg,
+		redis:  client,
+		local:  lru.New[string, cachedMetadata](int64(cfg.Size)),
+		timeFn: time.Now,
+	}
+}
+
+var _ MetadataStore = (*MetadataCache)(nil)
+
+type MetadataCache struct {
+	store  MetadataStore
+	cfg    CacheConfig
+	redis  redis.UniversalClient
+	local  *lru.Cache[string, cachedMetadata]
+	timeFn func() time.Time
+
+	// mtx orders local fills against invalidations, generation counts the invalidations of the process
+	mtx        sync.Mutex
+	generation uint64
+}
+
+func (c *MetadataCache) FetchByMetadata(
+	ctx context.Context, videoID string, mime string, quality string,
+) (Metadata, error) {
+	key := metadataCacheKey(videoID, mime, quality)
+	model, token, ok := c.fetchCached(ctx, key)
+	if ok {
+		return model, nil
+	}
+
+	MetadataCacheMetrics.Add("misses", 1)
+
+	model, err := c.store.FetchByMetadata(ctx, videoID, mime, quality)
+	if err != nil {
+		return model, err
+	}
+
+	c.fill(ctx, key, model, token)
+
+	return model, nil
+}
+
+// FetchByKeys returns the formats of the keys in their order, missing ones are skipped. Cached formats are
+// served from the tiers, the rest is read from the store in a single batch
+func (c *MetadataCache) FetchByKeys(ctx context.Context, keys []MetadataKey) ([]Metadata, error) {
+	found := make(map[MetadataKey]Metadata, len(keys))
+	tokens := make(map[MetadataKey]fillToken)
+	var missing []MetadataKey
+	for _, key := range keys {
+		model, token, ok := c.fetchCached(ctx, metadataCacheKey(key.VideoID, key.Mime, key.Quality))
+		if ok {
+			found[key] = model
+			continue
+		}
+
+		tokens[key] = token
+		missing = append(missing, key)
+	}
+
+	if len(missing) > 0 {
+		MetadataCacheMetrics.Add("misses", int64(len(missing)))
+
+		stored, err := c.store.FetchByKeys(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, model := range stored {
+			key := MetadataKey{VideoID: model.VideoID, Mime: model.Mime, Quality: model.Quality}
+			c.fill(ctx, metadataCacheKey(model.VideoID, model.Mime, model.Quality), model, tokens[key])
+			found[key] = model
+		}
+	}
+
+	models := make([]Metadata, 0, len(found))
+	for _, key := range keys {
+		if model, ok := found[key]; ok {
+			models = append(models, model)
+		}
+	}
+
+	return models, nil
+}
+
+func (c *MetadataCache) Save(ctx context.Context, model Metadata) error {
+	if err := c.store.Save(ctx, model); err != nil {
+		return err
+	}
+
+	c.invalidate(ctx, metadataCacheKey(model.VideoID, model.Mime, model.Quality))
+
+	return nil
+}
+
+// SaveBatch saves the models to the store in a single batch and drops their entries
+func (c *MetadataCache) SaveBatch(ctx context.Context, models []Metadata) error {
+	if err := c.store.SaveBatch(ctx, models); err != nil {
+		return err
+	}
+
+	for _, model := range models {
+		c.invalidate(ctx, metadataCacheKey(model.VideoID, model.Mime, model.Quality))
+	}
+
+	return nil
+}
+
+func (c *MetadataCache) Delete(ctx context.Context, videoID string, mime string, quality string) error {
+	if err := c.store.Delete(ctx, videoID, mime, quality); err != nil {
+		return err
+	}
+
+	c.invalidate(ctx, metadataCacheKey(videoID, mime, quality))
+
+	return nil
+}
+
+// Touch passes through to the store. Cached entries are kept, the usage columns they carry may lag behind
+func (c *MetadataCache) Touch(
+	ctx context.Context, videoID string, mime string, quality string, at time.Time,
+) error {
+	return c.store.Touch(ctx, videoID, mime, quality, at)
+}
+
+// invalidate drops the entry from both tiers and bumps its generation, so a fill with the data read
+// before is dropped. The store is already changed at this point, so a redis failure is only logged:
+// the entry then lives until RedisTTL and the store write is not failed for it
+func (c *MetadataCache) invalidate(ctx context.Context, key string) {
+	MetadataCacheMetrics.Add("invalidations", 1)
+	c.mtx.Lock()
+	c.generation++
+	c.local.Remove(key)
+	c.mtx.Unlock()
+	if c.redis != nil {
+		err := invalidateScript.Run(ctx, c.redis, []string{key}, c.cfg.RedisTTL.Milliseconds()).Err()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			logging.FromContext(ctx).Named("MetadataCache.invalidate").Errorf("redis invalidate: %v", err)
+		}
+	}
+}
+
+// fetchCached returns the entry from the local tier or, when it is not there, from the redis one. On a miss
+// it returns the token to fill the entry with
+func (c *MetadataCache) fetchCached(ctx context.Context, key string) (Metadata, fillToken, bool) {
+	c.mtx.Lock()
+	entry, ok := c.local.Get(key)
+	token := fillToken{local: c.generation}
+	c.mtx.Unlock()
+	if ok && c.timeFn().Before(entry.expires) {
+		MetadataCacheMetrics.Add("local_hits", 1)
+
+		return entry.model, token, true
+	}
+
+	if c.redis != nil {
+		var model Metadata
+		model, token.redis, ok = c.fetchRedis(ctx, key)
+		if ok {
+			MetadataCacheMetrics.Add("redis_hits", 1)
+			c.fillLocal(key, model, token)
+
+			return model, token, true
+		}
+	}
+
+	return Metadata{}, token, false
+}
+
+// fill caches the model read from the store in both tiers unless the entry was invalidated after
+// the token was taken
+func (c *MetadataCache) fill(ctx context.Context, key string, model Metadata, token fillToken) {
+	c.fillLocal(key, model, token)
+	if c.redis == nil || token.redis == "" {
+		return
+	}
+
+	encoded, err := json.Marshal(model)
+	if err != nil {
+		return
+	}
+
+	err = fillScript.Run(ctx, c.redis, []string{key}, encoded, token.redis, c.cfg.RedisTTL.Milliseconds()).Err()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		logging.FromContext(ctx).Named("MetadataCache.fill").Warnf("redis fill: %v", err)
+	}
+}
+
+func (c *MetadataCache) fillLocal(key string, model Metadata, token fillToken) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.generation != token.local {
+		MetadataCacheMetrics.Add("dropped_fills", 1)
+
+		return
+	}
+
+	c.local.Add(key, cachedMetadata{model: model, expires: c.timeFn().Add(c.cfg.TTL)})
+}
+
+// fetchRedis returns the entry and the generation of its hash, a missing hash has generation 0
+func (c *MetadataCache) fetchRedis(ctx context.Context, key string) (Metadata, string, bool) {
+	var model Metadata
+	fields, err := c.redis.HMGet(ctx, key, metadataRedisFieldData, metadataRedisFieldGeneration).Result()
+	if err != nil {
+		logging.FromContext(ctx).Named("MetadataCache.fetchRedis").Warnf("redis get: %v", err)
+
+		return model, "", false
+	}
+
+	generation := "0"
+	if s, ok := fields[1].(string); ok {
+		generation = s
+	}
+
+	data, ok := fields[0].(string)
+	if !ok {
+		return model, generation, false
+	}
+
+	if err = json.Unmarshal([]byte(data), &model); err != nil {
+		return model, generation, false
+	}
+
+	return model, generation, true
+}
+
+const (
+	metadataRedisFieldData       = "data"
+	metadataRedisFieldGeneration = "generation"
+)
+
+// fillScript stores the data when the generation field still equals ARGV[2], a missing hash has
+// generation 0
+var fillScript = redis.NewScript(`
+local generation = redis.call('HGET', KEYS[1], 'generation') or '0'
+if generation ~= ARGV[2] then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'data', ARGV[1])
+if tonumber(ARGV[3]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+end
+return 1
+`)
+
+// invalidateScript drops the data and bumps the generation, the hash outlives the data so in-flight
+// fills of other replicas still see the new generation
+var invalidateScript = redis.NewScript(`
+redis.call('HINCRBY', KEYS[1], 'generation', 1)
+redis.call('HDEL', KEYS[1], 'data')
+if tonumber(ARGV[1]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+func metadataCacheKey(videoID, mime, quality string) string {
+	return fmt.Sprintf("%s%s\x00%s\x00%s", metadataRedisKeyPrefix, videoID, mime, quality)
+}
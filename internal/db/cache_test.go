@@ -0,0 +1,272 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type countingStore struct {
+	mtx     sync.Mutex
+	fetches int
+	records map[string]Metadata
+}
+
+func newCountingStore() *countingStore {
+	return &countingStore{records: make(map[string]Metadata)}
+}
+
+func (c *countingStore) FetchByMetadata(_ context.Context, videoID string, mime string, quality string) (Metadata, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.fetches++
+	model, ok := c.records[videoID+mime+quality]
+	if !ok {
+		return model, ErrNotFound
+	}
+
+	return model, nil
+}
+
+func (c *countingStore) FetchByKeys(_ context.Context, keys []MetadataKey) ([]Metadata, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.fetches++
+	var models []Metadata
+	for _, key := range keys {
+		if model, ok := c.records[key.VideoID+key.Mime+key.Quality]; ok {
+			models = append(models, model)
+		}
+	}
+
+	return models, nil
+}
+
+func (c *countingStore) Save(_ context.Context, model Metadata) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.records[model.VideoID+model.Mime+model.Quality] = model
+
+	return nil
+}
+
+func (c *countingStore) SaveBatch(_ context.Context, models []Metadata) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for _, model := range models {
+		c.records[model.VideoID+model.Mime+model.Quality] = model
+	}
+
+	return nil
+}
+
+func (c *countingStore) Delete(_ context.Context, videoID string, mime string, quality string) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	delete(c.records, videoID+mime+quality)
+
+	return nil
+}
+
+func (c *countingStore) Touch(_ context.Context, _ string, _ string, _ string, _ time.Time) error {
+	return nil
+}
+
+func (c *countingStore) count() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.fetches
+}
+
+func TestMetadataCache_FetchByMetadata(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := newCountingStore()
+	cache := NewMetadataCache(store, CacheConfig{Size: 10, TTL: time.Minute}, nil)
+
+	if _, err := cache.FetchByMetadata(ctx, "video", "mime", "hd720"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got: %v, expected: %v", err, ErrNotFound)
+	}
+
+	if _, err := cache.FetchByMetadata(ctx, "video", "mime", "hd720"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got: %v, expected: %v", err, ErrNotFound)
+	}
+
+	if got, want := store.count(), 2; got != want {
+		t.Errorf("got: %d fetches, expected: %d, missing records must not be cached", got, want)
+	}
+
+	if err := cache.Save(ctx, Metadata{VideoID: "video", Mime: "mime", Quality: "hd720"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.FetchByMetadata(ctx, "video", "mime", "hd720"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := store.count(), 3; got != want {
+		t.Errorf("got: %d fetches, expected: %d", got, want)
+	}
+
+	if err := cache.Save(ctx, Metadata{VideoID: "video", Mime: "mime", Quality: "hd720", FileID: "file"}); err != nil {
+		t.Fatal(err)
+	}
+
+	model, err := cache.FetchByMetadata(ctx, "video", "mime", "hd720")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if model.FileID != "file" {
+		t.Errorf("got: %q, expected the saved file id", model.FileID)
+	}
+
+	if err = cache.Delete(ctx, "video", "mime", "hd720"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = cache.FetchByMetadata(ctx, "video", "mime", "hd720"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got: %v, expected: %v", err, ErrNotFound)
+	}
+}
+
+func TestMetadataCache_TTL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := newCountingStore()
+	if err := store.Save(ctx, Metadata{VideoID: "video"}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	cache := NewMetadataCache(store, CacheConfig{Size: 10, TTL: time.Minute}, nil)
+	cache.timeFn = func() time.Time { return now }
+
+	for _, after := range []time.Duration{0, 30 * time.Second, 2 * time.Minute} {
+		now = now.Add(after)
+		if _, err := cache.FetchByMetadata(ctx, "video", "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := store.count(), 2; got != want {
+		t.Errorf("got: %d fetches, expected: %d", got, want)
+	}
+}
+
+func TestMetadataCache_Batch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := newCountingStore()
+	cache := NewMetadataCache(store, CacheConfig{Size: 10, TTL: time.Minute}, nil)
+
+	if err := cache.SaveBatch(ctx, []Metadata{
+		{VideoID: "a", Mime: "mime", Quality: "hd720"},
+		{VideoID: "b", Mime: "mime", Quality: "hd720"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cache.FetchByMetadata(ctx, "a", "mime", "hd720"); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []MetadataKey{
+		{VideoID: "b", Mime: "mime", Quality: "hd720"},
+		{VideoID: "missing", Mime: "mime", Quality: "hd720"},
+		{VideoID: "a", Mime: "mime", Quality: "hd720"},
+	}
+
+	// a is cached, b and the missing one are read in a single batch
+	models, err := cache.FetchByKeys(ctx, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(models) != 2 || models[0].VideoID != "b" || models[1].VideoID != "a" {
+		t.Errorf("got: %+v, expected b and a in the order of the keys", models)
+	}
+
+	if got, want := store.count(), 2; got != want {
+		t.Errorf("got: %d fetches, expected: %d", got, want)
+	}
+
+	if _, err = cache.FetchByKeys(ctx, keys[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := store.count(), 2; got != want {
+		t.Errorf("got: %d fetches, expected: %d, batched entries must be cached", got, want)
+	}
+
+	if err = cache.SaveBatch(ctx, []Metadata{{VideoID: "b", Mime: "mime", Quality: "hd720", FileID: "file"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if models, err = cache.FetchByKeys(ctx, keys[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(models) != 1 || models[0].FileID != "file" {
+		t.Errorf("got: %+v, expected the saved file id", models)
+	}
+}
+
+// racingStore runs onFetch after reading the record, like a write landing while the read is in flight
+type racingStore struct {
+	*countingStore
+	onFetch func()
+}
+
+func (r *racingStore) FetchByMetadata(ctx context.Context, videoID string, mime string, quality string) (Metadata, error) {
+	model, err := r.countingStore.FetchByMetadata(ctx, videoID, mime, quality)
+	if r.onFetch != nil {
+		onFetch := r.onFetch
+		r.onFetch = nil
+		onFetch()
+	}
+
+	return model, err
+}
+
+func TestMetadataCache_StaleFill(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := &racingStore{countingStore: newCountingStore()}
+	if err := store.Save(ctx, Metadata{VideoID: "video", FileID: "stale"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewMetadataCache(store, CacheConfig{Size: 10, TTL: time.Minute}, nil)
+	store.onFetch = func() {
+		if err := cache.Save(ctx, Metadata{VideoID: "video", FileID: "fresh"}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	model, err := cache.FetchByMetadata(ctx, "video", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if model.FileID != "stale" {
+		t.Fatalf("got: %q, expected the record read before the save", model.FileID)
+	}
+
+	if model, err = cache.FetchByMetadata(ctx, "video", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if model.FileID != "fresh" {
+		t.Errorf("got: %q, expected the saved file id, the stale read must not be cached", model.FileID)
+	}
+}
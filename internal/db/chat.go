@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func NewChatRepository(DB *DB) *ChatRepository {
+	return &ChatRepository{DB: DB}
+}
+
+type ChatRepository struct {
+	*DB
+}
+
+func (c *ChatRepository) FetchByID(ctx context.Context, id int64) (Chat, error) {
+	var model Chat
+	row := c.Pool.QueryRow(ctx, `
+		SELECT
+			id, type, title, username, blocked, requests_count, first_seen_at, last_seen_at
+		FROM
+			chats
+		WHERE id = $1
+	`, id)
+	if err := row.Scan(
+		&model.ID, &model.Type, &model.Title, &model.Username, &model.Blocked, &model.RequestsCount,
+		&model.FirstSeenAt, &model.LastSeenAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model, fmt.Errorf("fetch chat: %w", ErrNotFound)
+		}
+
+		return model, fmt.Errorf("fetch chat: %w", err)
+	}
+
+	return model, nil
+}
+
+// Upsert records a request from the chat the same way UserRepository.Upsert does for users
+func (c *ChatRepository) Upsert(ctx context.Context, model Chat) error {
+	if _, err := c.Pool.Exec(
+		ctx, `INSERT
+				INTO chats (id, type, title, username, blocked, requests_count, first_seen_at, last_seen_at)
+				VALUES ($1, $2, $3, $4, FALSE, 1, $5, $5)
+				ON CONFLICT (id)
+				DO UPDATE SET type = EXCLUDED.type, title = EXCLUDED.title, username = EXCLUDED.username,
+					blocked = FALSE, requests_count = chats.requests_count + 1, last_seen_at = EXCLUDED.last_seen_at`,
+		model.ID, model.Type, model.Title, model.Username, model.LastSeenAt,
+	); err != nil {
+		return fmt.Errorf("upsert chat: %w", err)
+	}
+
+	return nil
+}
+
+func (c *ChatRepository) SetBlocked(ctx context.Context, id int64, blocked bool) error {
+	result, err := c.Pool.Exec(ctx, `UPDATE chats SET blocked = $2 WHERE id = $1`, id, blocked)
+	if err != nil {
+		return fmt.Errorf("update chat: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("update chat: %w", ErrNoRowsUpd)
+	}
+
+	return nil
+}
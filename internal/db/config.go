@@ -5,7 +5,15 @@ import (
 	"strconv"
 )
 
+const (
+	TypePostgres = "postgres"
+	TypeEmbedded = "embedded"
+)
+
 type Config struct {
+	// Type is the backend of the repositories, the embedded one keeps everything in the file at Path
+	Type         string `env:"DB_TYPE,default=postgres" json:",omitempty"`
+	Path         string `env:"DB_PATH,default=cribe.db" json:",omitempty"`
 	Name         string `env:"DB_NAME,default=cribe" json:",omitempty"`
 	User         string `env:"DB_USER,default=postgres" json:",omitempty"`
 	Host         string `env:"DB_HOST,default=localhost" json:",omitempty"`
@@ -15,6 +23,7 @@ type Config struct {
 	Password     string `env:"DB_PASSWORD,default=postgres" json:"-"`
 	PoolMinConns int    `env:"DB_POOL_MIN_CONNS,default=10" json:",omitempty"`
 	PoolMaxConns int    `env:"DB_POOL_MAX_CONNS,default=50" json:",omitempty"`
+	AutoMigrate  bool   `env:"DB_AUTO_MIGRATE,default=false" json:",omitempty"`
 }
 
 func (c Config) ConnectionURL() string {
@@ -32,9 +32,20 @@ func NewFromEnv(ctx context.Context, cfg *Config) (*DB, error) {
 		return nil, fmt.Errorf("parse DSN: %w", err)
 	}
 
-	// set BeforeAcquire helper func for pinging
-	pgxConfig.BeforeAcquire = func(ctx context.Context, conn *pgx.Conn) bool {
-		return conn.Ping(ctx) == nil
+	required, err := SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	// broken connections are found by the periodic health check of the pool, a ping on every acquire costs
+	// a round trip per query. The statements are prepared against the schema, so an outdated one fails here
+	// with ErrSchemaOutdated rather than with an opaque prepare error
+	pgxConfig.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		if err := checkSchemaVersion(ctx, conn, required); err != nil {
+			return err
+		}
+
+		return prepareStatements(ctx, conn)
 	}
 
 	pool, err := pgxpool.ConnectConfig(ctx, pgxConfig)
@@ -45,6 +56,26 @@ func NewFromEnv(ctx context.Context, cfg *Config) (*DB, error) {
 	return &DB{Pool: pool}, nil
 }
 
+// preparedStatements are prepared on every connection of the pool, the hot queries run by their names
+var preparedStatements = map[string]string{}
+
+// prepare registers the statement to be prepared on every connection and returns its name
+func prepare(name, sql string) string {
+	preparedStatements[name] = sql
+
+	return name
+}
+
+func prepareStatements(ctx context.Context, conn *pgx.Conn) error {
+	for name, sql := range preparedStatements {
+		if _, err := conn.Prepare(ctx, name, sql); err != nil {
+			return fmt.Errorf("prepare %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
 func (db *DB) Close() {
 	db.Pool.Close()
 }
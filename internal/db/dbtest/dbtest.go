@@ -0,0 +1,840 @@
+// Package dbtest is the conformance suite every backend of the db repositories passes
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/robotomize/cribe/internal/db"
+)
+
+// Factory returns repositories backed by an empty store
+type Factory func(t *testing.T) db.Repositories
+
+// TestRepositories runs the conformance suite, every subtest gets repositories of its own
+func TestRepositories(t *testing.T, newRepositories Factory) {
+	t.Run("metadata", func(t *testing.T) { testMetadata(t, newRepositories(t)) })
+	t.Run("metadata_catalog", func(t *testing.T) { testMetadataCatalog(t, newRepositories(t)) })
+	t.Run("metadata_batch", func(t *testing.T) { testMetadataBatch(t, newRepositories(t)) })
+	t.Run("metadata_usage", func(t *testing.T) { testMetadataUsage(t, newRepositories(t)) })
+	t.Run("metadata_link", func(t *testing.T) { testMetadataLink(t, newRepositories(t)) })
+	t.Run("users", func(t *testing.T) { testUsers(t, newRepositories(t)) })
+	t.Run("chats", func(t *testing.T) { testChats(t, newRepositories(t)) })
+	t.Run("concurrent_upserts", func(t *testing.T) { testConcurrentUpserts(t, newRepositories(t)) })
+	t.Run("requests", func(t *testing.T) { testRequests(t, newRepositories(t)) })
+	t.Run("unavailable", func(t *testing.T) { testUnavailable(t, newRepositories(t)) })
+}
+
+// now is the base time of the suite, stores keep microseconds at most
+var now = time.Date(2021, 10, 19, 12, 0, 0, 0, time.UTC)
+
+func testMetadata(t *testing.T, repos db.Repositories) {
+	ctx := context.Background()
+	store := repos.Metadata
+
+	if _, err := store.FetchByMetadata(ctx, "video", "video/mp4", "hd720"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("fetch missing metadata got: %v, expected: %v", err, db.ErrNotFound)
+	}
+
+	model := db.Metadata{
+		VideoID: "video",
+		Quality: "hd720",
+		Mime:    "video/mp4",
+		Params: db.VideoParams{
+			Version:     db.VideoParamsVersion,
+			Title:       "title",
+			Width:       1280,
+			Height:      720,
+			Duration:    60,
+			Author:      "channel",
+			ChannelID:   "UCchannel",
+			ViewCount:   1000,
+			Keywords:    []string{"go", "testing"},
+			PublishDate: time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC),
+			Chapters:    []db.Chapter{{Start: 0, Title: "intro"}},
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := store.Save(ctx, model); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	got, err := store.FetchByMetadata(ctx, "video", "video/mp4", "hd720")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+
+	// a new format counts as accessed when it is saved
+	model.LastAccessedAt = now
+	assertMetadata(t, got, model)
+
+	// an update keeps the creation time and the usage
+	updated := model
+	updated.FileID = "file"
+	updated.FileIDFailures = 1
+	updated.Params.Title = "new title"
+	updated.CreatedAt = now.Add(time.Hour)
+	updated.UpdatedAt = now.Add(time.Hour)
+	if err = store.Save(ctx, updated); err != nil {
+		t.Fatalf("save update: %v", err)
+	}
+
+	if got, err = store.FetchByMetadata(ctx, "video", "video/mp4", "hd720"); err != nil {
+		t.Fatalf("fetch updated: %v", err)
+	}
+
+	updated.CreatedAt = now
+	assertMetadata(t, got, updated)
+
+	if err = store.Delete(ctx, "video", "video/mp4", "hd720"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if err = store.Delete(ctx, "video", "video/mp4", "hd720"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("delete missing got: %v, expected: %v", err, db.ErrNotFound)
+	}
+
+	if _, err = store.FetchByMetadata(ctx, "video", "video/mp4", "hd720"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("fetch deleted got: %v, expected: %v", err, db.ErrNotFound)
+	}
+}
+
+func testMetadataCatalog(t *testing.T, repos db.Repositories) {
+	ctx := context.Background()
+	store := repos.Metadata
+
+	models := []db.Metadata{
+		{
+			VideoID: "a", Quality: "hd720", Mime: "video/mp4",
+			Params:    db.VideoParams{Title: "Go concurrency patterns", Author: "golang"},
+			CreatedAt: now, UpdatedAt: now,
+		},
+		{
+			VideoID: "a", Quality: "medium", Mime: "video/mp4",
+			Params:    db.VideoParams{Title: "Go concurrency patterns", Author: "golang"},
+			CreatedAt: now, UpdatedAt: now,
+		},
+		{
+			VideoID: "b", Quality: "hd720", Mime: "video/mp4",
+			Params:    db.VideoParams{Title: "Cooking pasta", Description: "no concurrency here, only pasta"},
+			CreatedAt: now.Add(time.Minute), UpdatedAt: now.Add(time.Minute),
+		},
+		{
+			VideoID: "c", Quality: "hd720", Mime: "video/mp4",
+			Params: db.VideoParams{
+				Title: "Rust ownership", Author: "rustlang", ChannelID: "UCrust", Keywords: []string{"borrow checker"},
+			},
+			CreatedAt: now.Add(2 * time.Minute), UpdatedAt: now.Add(2 * time.Minute),
+		},
+	}
+	for _, model := range models {
+		if err := store.Save(ctx, model); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+
+	formats, err := store.FetchByVideoID(ctx, "a")
+	if err != nil {
+		t.Fatalf("fetch by video: %v", err)
+	}
+
+	assertKeys(t, "fetch by video", formats, []string{"a/hd720", "a/medium"})
+
+	listed, err := store.List(ctx, 2, 0)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	assertKeys(t, "list first page", listed, []string{"c/hd720", "b/hd720"})
+
+	if listed, err = store.List(ctx, 2, 2); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	assertKeys(t, "list second page", listed, []string{"a/hd720", "a/medium"})
+
+	found, err := store.Search(ctx, "Concurrency", 10, 0)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	assertKeys(t, "search title first", found, []string{"a/hd720", "a/medium", "b/hd720"})
+
+	if found, err = store.Search(ctx, "rustlang", 10, 0); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	assertKeys(t, "search author", found, []string{"c/hd720"})
+
+	if found, err = store.Search(ctx, "borrow", 10, 0); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	assertKeys(t, "search keywords", found, []string{"c/hd720"})
+
+	if found, err = store.Search(ctx, "pasta concurrency", 10, 0); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	assertKeys(t, "search all words", found, []string{"b/hd720"})
+
+	if found, err = store.Search(ctx, "haskell", 10, 0); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	assertKeys(t, "search nothing", found, nil)
+
+	if found, err = store.Search(ctx, "concurrency", 2, 1); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	assertKeys(t, "search second page", found, []string{"a/medium", "b/hd720"})
+
+	if formats, err = store.FetchByVideoID(ctx, "unknown"); err != nil {
+		t.Fatalf("fetch by unknown video: %v", err)
+	}
+
+	assertKeys(t, "fetch by unknown video", formats, nil)
+
+	if listed, err = store.List(ctx, 2, 4); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	assertKeys(t, "list past the end", listed, nil)
+
+	// a delete removes a single format of the video
+	if err = store.Delete(ctx, "a", "video/mp4", "medium"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if err = store.Delete(ctx, "a", "video/mp4", "medium"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("delete deleted got: %v, expected: %v", err, db.ErrNotFound)
+	}
+
+	if formats, err = store.FetchByVideoID(ctx, "a"); err != nil {
+		t.Fatalf("fetch by video: %v", err)
+	}
+
+	assertKeys(t, "fetch by video after delete", formats, []string{"a/hd720"})
+
+	if listed, err = store.List(ctx, 10, 0); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	assertKeys(t, "list after delete", listed, []string{"c/hd720", "b/hd720", "a/hd720"})
+
+	if found, err = store.Search(ctx, "concurrency", 10, 0); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	assertKeys(t, "search after delete", found, []string{"a/hd720", "b/hd720"})
+}
+
+func testMetadataBatch(t *testing.T, repos db.Repositories) {
+	ctx := context.Background()
+	store := repos.Metadata
+
+	if err := store.SaveBatch(ctx, nil); err != nil {
+		t.Fatalf("save empty batch: %v", err)
+	}
+
+	if err := store.Save(ctx, db.Metadata{
+		VideoID: "b", Quality: "hd720", Mime: "video/mp4", CreatedAt: now, UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	later := now.Add(time.Hour)
+	if err := store.SaveBatch(ctx, []db.Metadata{
+		{VideoID: "a", Quality: "hd720", Mime: "video/mp4", FileID: "a", CreatedAt: later, UpdatedAt: later},
+		{VideoID: "b", Quality: "hd720", Mime: "video/mp4", FileID: "b", CreatedAt: later, UpdatedAt: later},
+		{VideoID: "c", Quality: "medium", Mime: "video/mp4", FileID: "c", CreatedAt: later, UpdatedAt: later},
+	}); err != nil {
+		t.Fatalf("save batch: %v", err)
+	}
+
+	found, err := store.FetchByKeys(ctx, []db.MetadataKey{
+		{VideoID: "c", Mime: "video/mp4", Quality: "medium"},
+		{VideoID: "missing", Mime: "video/mp4", Quality: "hd720"},
+		{VideoID: "a", Mime: "video/mp4", Quality: "hd720"},
+		{VideoID: "b", Mime: "video/mp4", Quality: "hd720"},
+	})
+	if err != nil {
+		t.Fatalf("fetch by keys: %v", err)
+	}
+
+	assertKeys(t, "fetch by keys", found, []string{"c/medium", "a/hd720", "b/hd720"})
+
+	// a batch updates stored formats the way a single save does
+	if len(found) == 3 {
+		assertMetadata(t, found[2], db.Metadata{
+			VideoID: "b", Quality: "hd720", Mime: "video/mp4", FileID: "b",
+			LastAccessedAt: now, CreatedAt: now, UpdatedAt: later,
+		})
+	}
+
+	if found, err = store.FetchByKeys(ctx, nil); err != nil {
+		t.Fatalf("fetch by no keys: %v", err)
+	}
+
+	assertKeys(t, "fetch by no keys", found, nil)
+}
+
+func testMetadataUsage(t *testing.T, repos db.Repositories) {
+	ctx := context.Background()
+	store := repos.Metadata
+
+	if err := store.Touch(ctx, "a", "video/mp4", "hd720", now); !errors.Is(err, db.ErrNoRowsUpd) {
+		t.Fatalf("touch missing metadata got: %v, expected: %v", err, db.ErrNoRowsUpd)
+	}
+
+	old := now.Add(-30 * 24 * time.Hour)
+	for _, model := range []db.Metadata{
+		{VideoID: "a", Quality: "hd720", Mime: "video/mp4", FileID: "a", CreatedAt: old, UpdatedAt: old},
+		{VideoID: "b", Quality: "hd720", Mime: "video/mp4", FileID: "b", CreatedAt: old, UpdatedAt: old},
+		{VideoID: "c", Quality: "hd720", Mime: "video/mp4", FileID: "c", CreatedAt: old, UpdatedAt: old},
+		{VideoID: "d", Quality: "hd720", Mime: "video/mp4", CreatedAt: now, UpdatedAt: now},
+	} {
+		if err := store.Save(ctx, model); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+
+	for _, touch := range []struct {
+		videoID string
+		at      time.Time
+	}{
+		{videoID: "a", at: now},
+		{videoID: "b", at: now.Add(-time.Hour)},
+		{videoID: "b", at: now.Add(-2 * time.Hour)},
+		{videoID: "a", at: now.Add(-time.Minute)},
+		{videoID: "a", at: now.Add(-time.Minute)},
+	} {
+		if err := store.Touch(ctx, touch.videoID, "video/mp4", "hd720", touch.at); err != nil {
+			t.Fatalf("touch: %v", err)
+		}
+	}
+
+	// an earlier access never moves the last one back
+	touched, err := store.FetchByMetadata(ctx, "a", "video/mp4", "hd720")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+
+	if touched.HitCount != 3 || !touched.LastAccessedAt.Equal(now) {
+		t.Errorf("touched metadata got: %d %v, expected: %d %v", touched.HitCount, touched.LastAccessedAt, 3, now)
+	}
+
+	// a save keeps the usage
+	touched.FileID = "new"
+	touched.UpdatedAt = now
+	if err = store.Save(ctx, touched); err != nil {
+		t.Fatalf("save touched: %v", err)
+	}
+
+	requested, err := store.MostRequested(ctx, 10)
+	if err != nil {
+		t.Fatalf("most requested: %v", err)
+	}
+
+	assertKeys(t, "most requested", requested, []string{"a/hd720", "b/hd720"})
+
+	if requested, err = store.MostRequested(ctx, 1); err != nil {
+		t.Fatalf("most requested: %v", err)
+	}
+
+	assertKeys(t, "most requested limited", requested, []string{"a/hd720"})
+	if len(requested) == 1 && requested[0].HitCount != 3 {
+		t.Errorf("most requested hit count got: %d, expected: %d", requested[0].HitCount, 3)
+	}
+
+	// c was neither served nor saved for a month, d is new
+	purged, err := store.PurgeUnused(ctx, now.Add(-7*24*time.Hour), true)
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+
+	if expected := []db.MetadataKey{{VideoID: "c", Mime: "video/mp4", Quality: "hd720"}}; !reflect.DeepEqual(
+		purged, expected,
+	) {
+		t.Errorf("purged got: %+v, expected: %+v", purged, expected)
+	}
+
+	if _, err = store.FetchByMetadata(ctx, "c", "video/mp4", "hd720"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("fetch purged got: %v, expected: %v", err, db.ErrNotFound)
+	}
+
+	if purged, err = store.PurgeUnused(ctx, now.Add(-30*time.Minute), false); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+
+	if expected := []db.MetadataKey{{VideoID: "b", Mime: "video/mp4", Quality: "hd720"}}; !reflect.DeepEqual(
+		purged, expected,
+	) {
+		t.Errorf("purged got: %+v, expected: %+v", purged, expected)
+	}
+
+	listed, err := store.List(ctx, 10, 0)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	assertKeys(t, "left after purge", listed, []string{"d/hd720", "a/hd720"})
+}
+
+func testMetadataLink(t *testing.T, repos db.Repositories) {
+	ctx := context.Background()
+	store := repos.Metadata
+
+	if err := store.ExtendLink(ctx, "a", "video/mp4", "hd720", now); !errors.Is(err, db.ErrNoRowsUpd) {
+		t.Fatalf("extend link of missing metadata got: %v, expected: %v", err, db.ErrNoRowsUpd)
+	}
+
+	if err := store.Save(ctx, db.Metadata{
+		VideoID: "a", Quality: "hd720", Mime: "video/mp4", CreatedAt: now, UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	saved, err := store.FetchByMetadata(ctx, "a", "video/mp4", "hd720")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+
+	if !saved.LinkExpiresAt.IsZero() {
+		t.Errorf("link expiry of new metadata got: %v, expected zero", saved.LinkExpiresAt)
+	}
+
+	expires := now.Add(time.Hour)
+	for _, at := range []time.Time{now.Add(30 * time.Minute), expires, now.Add(45 * time.Minute)} {
+		if err = store.ExtendLink(ctx, "a", "video/mp4", "hd720", at); err != nil {
+			t.Fatalf("extend link: %v", err)
+		}
+	}
+
+	// an unrelated save neither moves the link expiry nor resets it
+	saved.FileID = "a"
+	saved.UpdatedAt = now.Add(2 * time.Hour)
+	if err = store.Save(ctx, saved); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	extended, err := store.FetchByMetadata(ctx, "a", "video/mp4", "hd720")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+
+	if !extended.LinkExpiresAt.Equal(expires) {
+		t.Errorf("link expiry got: %v, expected: %v", extended.LinkExpiresAt, expires)
+	}
+}
+
+func testUsers(t *testing.T, repos db.Repositories) {
+	ctx := context.Background()
+	store := repos.Users
+
+	if _, err := store.FetchByID(ctx, 1); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("fetch missing user got: %v, expected: %v", err, db.ErrNotFound)
+	}
+
+	if err := store.SetBlocked(ctx, 1, true); !errors.Is(err, db.ErrNoRowsUpd) {
+		t.Fatalf("block missing user got: %v, expected: %v", err, db.ErrNoRowsUpd)
+	}
+
+	if err := store.Upsert(ctx, db.User{ID: 1, Username: "old", LanguageCode: "en", LastSeenAt: now}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+
+	if err := store.SetBlocked(ctx, 1, true); err != nil {
+		t.Fatalf("block: %v", err)
+	}
+
+	blocked, err := store.FetchByID(ctx, 1)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+
+	if !blocked.Blocked {
+		t.Errorf("user is not blocked")
+	}
+
+	later := now.Add(time.Hour)
+	if err = store.Upsert(ctx, db.User{ID: 1, Username: "new", LanguageCode: "ru", LastSeenAt: later}); err != nil {
+		t.Fatalf("upsert again: %v", err)
+	}
+
+	got, err := store.FetchByID(ctx, 1)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+
+	if got.Username != "new" || got.LanguageCode != "ru" || got.Blocked || got.RequestsCount != 2 {
+		t.Errorf("upserted user got: %+v", got)
+	}
+
+	if !got.FirstSeenAt.Equal(now) || !got.LastSeenAt.Equal(later) {
+		t.Errorf("user seen times got: %v, %v, expected: %v, %v", got.FirstSeenAt, got.LastSeenAt, now, later)
+	}
+}
+
+func testChats(t *testing.T, repos db.Repositories) {
+	ctx := context.Background()
+	store := repos.Chats
+
+	if _, err := store.FetchByID(ctx, -1); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("fetch missing chat got: %v, expected: %v", err, db.ErrNotFound)
+	}
+
+	if err := store.SetBlocked(ctx, -1, true); !errors.Is(err, db.ErrNoRowsUpd) {
+		t.Fatalf("block missing chat got: %v, expected: %v", err, db.ErrNoRowsUpd)
+	}
+
+	if err := store.Upsert(ctx, db.Chat{ID: -1, Type: "group", Title: "old", LastSeenAt: now}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+
+	if err := store.SetBlocked(ctx, -1, true); err != nil {
+		t.Fatalf("block: %v", err)
+	}
+
+	later := now.Add(time.Hour)
+	if err := store.Upsert(ctx, db.Chat{ID: -1, Type: "supergroup", Title: "new", LastSeenAt: later}); err != nil {
+		t.Fatalf("upsert again: %v", err)
+	}
+
+	got, err := store.FetchByID(ctx, -1)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+
+	if got.Type != "supergroup" || got.Title != "new" || got.Blocked || got.RequestsCount != 2 {
+		t.Errorf("upserted chat got: %+v", got)
+	}
+
+	if !got.FirstSeenAt.Equal(now) || !got.LastSeenAt.Equal(later) {
+		t.Errorf("chat seen times got: %v, %v, expected: %v, %v", got.FirstSeenAt, got.LastSeenAt, now, later)
+	}
+}
+
+// testConcurrentUpserts checks that every upsert is counted when requests of the same user and chat race,
+// each upsert is a single atomic statement
+func testConcurrentUpserts(t *testing.T, repos db.Repositories) {
+	ctx := context.Background()
+
+	const upserts = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*upserts)
+	for i := 0; i < upserts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			seen := now.Add(time.Duration(i) * time.Second)
+			if err := repos.Users.Upsert(ctx, db.User{ID: 1, Username: "user", LastSeenAt: seen}); err != nil {
+				errs <- fmt.Errorf("upsert user: %w", err)
+			}
+
+			if err := repos.Chats.Upsert(ctx, db.Chat{ID: 1, Type: "private", LastSeenAt: seen}); err != nil {
+				errs <- fmt.Errorf("upsert chat: %w", err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	user, err := repos.Users.FetchByID(ctx, 1)
+	if err != nil {
+		t.Fatalf("fetch user: %v", err)
+	}
+
+	if user.RequestsCount != upserts {
+		t.Errorf("user requests got: %d, expected: %d", user.RequestsCount, upserts)
+	}
+
+	chat, err := repos.Chats.FetchByID(ctx, 1)
+	if err != nil {
+		t.Fatalf("fetch chat: %v", err)
+	}
+
+	if chat.RequestsCount != upserts {
+		t.Errorf("chat requests got: %d, expected: %d", chat.RequestsCount, upserts)
+	}
+
+	// an explicit unblock is an update as well
+	for _, blocked := range []bool{true, false} {
+		if err = repos.Users.SetBlocked(ctx, 1, blocked); err != nil {
+			t.Fatalf("set user blocked %t: %v", blocked, err)
+		}
+
+		if err = repos.Chats.SetBlocked(ctx, 1, blocked); err != nil {
+			t.Fatalf("set chat blocked %t: %v", blocked, err)
+		}
+	}
+
+	if user, err = repos.Users.FetchByID(ctx, 1); err != nil || user.Blocked {
+		t.Errorf("unblocked user got: %+v, %v", user, err)
+	}
+
+	if chat, err = repos.Chats.FetchByID(ctx, 1); err != nil || chat.Blocked {
+		t.Errorf("unblocked chat got: %+v, %v", chat, err)
+	}
+}
+
+func testRequests(t *testing.T, repos db.Repositories) {
+	ctx := context.Background()
+	store := repos.Requests
+
+	if _, err := store.FetchByID(ctx, 1); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("fetch missing request got: %v, expected: %v", err, db.ErrNotFound)
+	}
+
+	if err := repos.Metadata.Save(ctx, db.Metadata{
+		VideoID: "a", Quality: "hd720", Mime: "video/mp4", Params: db.VideoParams{Title: "title a"},
+		CreatedAt: now, UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("save metadata: %v", err)
+	}
+
+	for i, request := range []db.Request{
+		{UserID: 1, ChatID: 1, VideoID: "a", Mime: "video/mp4", Quality: "hd720", Outcome: db.OutcomeFailed},
+		{UserID: 1, ChatID: 1, VideoID: "b", Mime: "video/mp4", Quality: "hd720", Outcome: db.OutcomeDelivered},
+		{UserID: 2, ChatID: 2, VideoID: "a", Mime: "video/mp4", Quality: "hd720", Outcome: db.OutcomeDelivered},
+		// a repeated request updates the first one
+		{UserID: 1, ChatID: 3, VideoID: "a", Mime: "video/mp4", Quality: "hd720", Outcome: db.OutcomeLink},
+	} {
+		request.CreatedAt = now.Add(time.Duration(i) * time.Minute)
+		request.UpdatedAt = request.CreatedAt
+		if err := store.Save(ctx, request); err != nil {
+			t.Fatalf("save request: %v", err)
+		}
+	}
+
+	history, err := store.ListByUser(ctx, 1, 10, 0)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	if len(history) != 2 {
+		t.Fatalf("history length got: %d, expected: 2", len(history))
+	}
+
+	latest := history[0]
+	if latest.VideoID != "a" || latest.ChatID != 3 || latest.Outcome != db.OutcomeLink || latest.Title != "title a" {
+		t.Errorf("latest request got: %+v", latest)
+	}
+
+	if !latest.CreatedAt.Equal(now) || !latest.UpdatedAt.Equal(now.Add(3*time.Minute)) {
+		t.Errorf("latest request times got: %v, %v", latest.CreatedAt, latest.UpdatedAt)
+	}
+
+	if history[1].VideoID != "b" || history[1].Title != "" {
+		t.Errorf("earlier request got: %+v", history[1])
+	}
+
+	paged, err := store.ListByUser(ctx, 1, 1, 1)
+	if err != nil {
+		t.Fatalf("list page: %v", err)
+	}
+
+	if len(paged) != 1 || paged[0].ID != history[1].ID {
+		t.Errorf("second page got: %+v, expected: %+v", paged, history[1:])
+	}
+
+	got, err := store.FetchByID(ctx, latest.ID)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+
+	if got.ID != latest.ID || got.UserID != 1 || got.Title != "title a" || got.Outcome != db.OutcomeLink {
+		t.Errorf("fetched request got: %+v, expected: %+v", got, latest)
+	}
+
+	testUnresolvedRequests(t, store)
+}
+
+// testUnresolvedRequests checks that outcomes recorded before the format was resolved never duplicate the
+// request of the video
+func testUnresolvedRequests(t *testing.T, store db.RequestStore) {
+	ctx := context.Background()
+
+	// expected is the history after the step, created is the step the request was first made at
+	type entry struct {
+		mime, quality string
+		outcome       db.RequestOutcome
+		created       int
+	}
+
+	for i, step := range []struct {
+		request  db.Request
+		expected []entry
+	}{
+		{
+			request:  db.Request{UserID: 3, ChatID: 3, VideoID: "c", Outcome: db.OutcomeFailed},
+			expected: []entry{{outcome: db.OutcomeFailed}},
+		},
+		{
+			request:  db.Request{UserID: 3, ChatID: 3, VideoID: "c", Outcome: db.OutcomeFailed},
+			expected: []entry{{outcome: db.OutcomeFailed}},
+		},
+		// the first outcome of a format replaces the unresolved one
+		{
+			request: db.Request{
+				UserID: 3, ChatID: 3, VideoID: "c", Mime: "video/mp4", Quality: "hd720", Outcome: db.OutcomeDelivered,
+			},
+			expected: []entry{{mime: "video/mp4", quality: "hd720", outcome: db.OutcomeDelivered}},
+		},
+		// a later unresolved outcome leaves the request of the format alone
+		{
+			request: db.Request{UserID: 3, ChatID: 3, VideoID: "c", Outcome: db.OutcomeFailed},
+			expected: []entry{
+				{outcome: db.OutcomeFailed, created: 3},
+				{mime: "video/mp4", quality: "hd720", outcome: db.OutcomeDelivered},
+			},
+		},
+	} {
+		step.request.CreatedAt = now.Add(time.Duration(i) * time.Minute)
+		step.request.UpdatedAt = step.request.CreatedAt
+		if err := store.Save(ctx, step.request); err != nil {
+			t.Fatalf("save request %d: %v", i, err)
+		}
+
+		history, err := store.ListByUser(ctx, 3, 10, 0)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+
+		if len(history) != len(step.expected) {
+			t.Fatalf("history length after save %d got: %d, expected: %d", i, len(history), len(step.expected))
+		}
+
+		for n, expected := range step.expected {
+			got := history[n]
+			if got.VideoID != "c" || got.Mime != expected.mime || got.Quality != expected.quality ||
+				got.Outcome != expected.outcome {
+				t.Errorf("request %d after save %d got: %+v, expected: %+v", n, i, got, expected)
+			}
+
+			// the request keeps the time it was first made at
+			if created := now.Add(time.Duration(expected.created) * time.Minute); !got.CreatedAt.Equal(created) {
+				t.Errorf("request %d created after save %d got: %v, expected: %v", n, i, got.CreatedAt, created)
+			}
+		}
+
+		if !history[0].UpdatedAt.Equal(step.request.UpdatedAt) {
+			t.Errorf("request updated after save %d got: %v, expected: %v", i, history[0].UpdatedAt, step.request.UpdatedAt)
+		}
+	}
+}
+
+func testUnavailable(t *testing.T, repos db.Repositories) {
+	ctx := context.Background()
+	store := repos.Unavailable
+
+	if _, err := store.FetchByVideoID(ctx, "video"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("fetch missing entry got: %v, expected: %v", err, db.ErrNotFound)
+	}
+
+	// expiration is checked against the clock of the store
+	created := time.Now().Add(-time.Minute).Truncate(time.Microsecond)
+	if err := store.Save(ctx, db.Unavailable{
+		VideoID: "expired", Reason: db.ReasonRemoved, CreatedAt: created, ExpiresAt: created.Add(time.Second),
+	}); err != nil {
+		t.Fatalf("save expired: %v", err)
+	}
+
+	if _, err := store.FetchByVideoID(ctx, "expired"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("fetch expired entry got: %v, expected: %v", err, db.ErrNotFound)
+	}
+
+	model := db.Unavailable{
+		VideoID:   "video",
+		Reason:    db.ReasonPrivate,
+		Details:   "This video is private",
+		CreatedAt: created,
+		ExpiresAt: created.Add(time.Hour),
+	}
+	if err := store.Save(ctx, model); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	model.Reason = db.ReasonRegionBlocked
+	model.Details = ""
+	if err := store.Save(ctx, model); err != nil {
+		t.Fatalf("save again: %v", err)
+	}
+
+	got, err := store.FetchByVideoID(ctx, "video")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+
+	if got.VideoID != model.VideoID || got.Reason != model.Reason || got.Details != model.Details ||
+		!got.CreatedAt.Equal(model.CreatedAt) || !got.ExpiresAt.Equal(model.ExpiresAt) {
+		t.Errorf("entry got: %+v, expected: %+v", got, model)
+	}
+
+	if err = store.Delete(ctx, "video"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if err = store.Delete(ctx, "video"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("delete missing got: %v, expected: %v", err, db.ErrNotFound)
+	}
+}
+
+func assertMetadata(t *testing.T, got, expected db.Metadata) {
+	t.Helper()
+
+	if !got.CreatedAt.Equal(expected.CreatedAt) || !got.UpdatedAt.Equal(expected.UpdatedAt) {
+		t.Errorf(
+			"metadata times got: %v, %v, expected: %v, %v",
+			got.CreatedAt, got.UpdatedAt, expected.CreatedAt, expected.UpdatedAt,
+		)
+	}
+
+	if !got.LastAccessedAt.Equal(expected.LastAccessedAt) {
+		t.Errorf("metadata last accessed got: %v, expected: %v", got.LastAccessedAt, expected.LastAccessedAt)
+	}
+
+	got.CreatedAt, got.UpdatedAt, got.LastAccessedAt = expected.CreatedAt, expected.UpdatedAt, expected.LastAccessedAt
+	if !got.Params.PublishDate.Equal(expected.Params.PublishDate) {
+		t.Errorf("publish date got: %v, expected: %v", got.Params.PublishDate, expected.Params.PublishDate)
+	}
+
+	got.Params.PublishDate = expected.Params.PublishDate
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("metadata got: %+v, expected: %+v", got, expected)
+	}
+}
+
+func assertKeys(t *testing.T, name string, models []db.Metadata, expected []string) {
+	t.Helper()
+
+	keys := make([]string, 0, len(models))
+	for _, model := range models {
+		keys = append(keys, model.VideoID+"/"+model.Quality)
+	}
+
+	if len(keys) != len(expected) {
+		t.Errorf("%s got: %v, expected: %v", name, keys, expected)
+
+		return
+	}
+
+	for i := range keys {
+		if keys[i] != expected[i] {
+			t.Errorf("%s got: %v, expected: %v", name, keys, expected)
+
+			return
+		}
+	}
+}
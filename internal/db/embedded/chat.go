@@ -0,0 +1,83 @@
+package embedded
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/robotomize/cribe/internal/db"
+	bolt "go.etcd.io/bbolt"
+)
+
+func NewChatRepository(d *DB) *ChatRepository {
+	return &ChatRepository{DB: d}
+}
+
+var _ db.ChatStore = (*ChatRepository)(nil)
+
+type ChatRepository struct {
+	*DB
+}
+
+func (c *ChatRepository) FetchByID(_ context.Context, id int64) (db.Chat, error) {
+	var model db.Chat
+	if err := c.bolt.View(func(tx *bolt.Tx) error {
+		return get(tx.Bucket(bucketChats), idKey(id), &model)
+	}); err != nil {
+		return model, fmt.Errorf("fetch chat: %w", err)
+	}
+
+	return model, nil
+}
+
+// Upsert records a request from the chat the way db.ChatRepository.Upsert does
+func (c *ChatRepository) Upsert(_ context.Context, model db.Chat) error {
+	if err := c.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketChats)
+
+		var stored db.Chat
+		if err := get(b, idKey(model.ID), &stored); err != nil {
+			if !errors.Is(err, db.ErrNotFound) {
+				return err
+			}
+
+			stored = db.Chat{ID: model.ID, FirstSeenAt: model.LastSeenAt}
+		}
+
+		stored.Type = model.Type
+		stored.Title = model.Title
+		stored.Username = model.Username
+		stored.Blocked = false
+		stored.RequestsCount++
+		stored.LastSeenAt = model.LastSeenAt
+
+		return put(b, idKey(model.ID), stored)
+	}); err != nil {
+		return fmt.Errorf("upsert chat: %w", err)
+	}
+
+	return nil
+}
+
+func (c *ChatRepository) SetBlocked(_ context.Context, id int64, blocked bool) error {
+	if err := c.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketChats)
+
+		var stored db.Chat
+		if err := get(b, idKey(id), &stored); err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				return db.ErrNoRowsUpd
+			}
+
+			return err
+		}
+
+		stored.Blocked = blocked
+
+		return put(b, idKey(id), stored)
+	}); err != nil {
+		return fmt.Errorf("update chat: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+// Package embedded implements the repositories of the db package on top of a single bbolt file, for
+// deployments without Postgres. Every store keeps its records JSON encoded in a bucket of its own
+package embedded
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/robotomize/cribe/internal/db"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketMetadata        = []byte("metadata")
+	bucketMetadataArchive = []byte("metadata_archive")
+	bucketUsers           = []byte("users")
+	bucketChats           = []byte("chats")
+	bucketRequests        = []byte("requests")
+	bucketUserRequests    = []byte("user_requests")
+	bucketRequestKeys     = []byte("request_keys")
+	bucketUnavailable     = []byte("unavailable_videos")
+)
+
+// Open opens the database file, creating it and its buckets when missing
+func Open(path string) (*DB, error) {
+	bdb, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open bolt: %w", err)
+	}
+
+	if err = bdb.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{
+			bucketMetadata, bucketUsers, bucketChats, bucketRequests, bucketUserRequests, bucketRequestKeys,
+			bucketUnavailable, bucketMetadataArchive,
+		} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return fmt.Errorf("create bucket %s: %w", name, err)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		_ = bdb.Close()
+
+		return nil, fmt.Errorf("init buckets: %w", err)
+	}
+
+	return &DB{bolt: bdb}, nil
+}
+
+type DB struct {
+	bolt *bolt.DB
+}
+
+func (d *DB) Close() error {
+	return d.bolt.Close()
+}
+
+// NewRepositories returns the repositories backed by the file
+func NewRepositories(d *DB) db.Repositories {
+	return db.Repositories{
+		Metadata:    NewMetadataRepository(d),
+		Users:       NewUserRepository(d),
+		Chats:       NewChatRepository(d),
+		Requests:    NewRequestRepository(d),
+		Unavailable: NewUnavailableRepository(d),
+	}
+}
+
+func idKey(id int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+
+	return key
+}
+
+func get(b *bolt.Bucket, key []byte, v interface{}) error {
+	raw := b.Get(key)
+	if raw == nil {
+		return db.ErrNotFound
+	}
+
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("json unmarshal: %w", err)
+	}
+
+	return nil
+}
+
+func put(b *bolt.Bucket, key []byte, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("json marshal: %w", err)
+	}
+
+	if err = b.Put(key, raw); err != nil {
+		return fmt.Errorf("put: %w", err)
+	}
+
+	return nil
+}
+
+// page returns the limit items of s starting at offset
+func page[T any](s []T, limit, offset int) []T {
+	if offset >= len(s) {
+		return nil
+	}
+
+	s = s[offset:]
+	if limit < len(s) {
+		s = s[:limit]
+	}
+
+	return s
+}
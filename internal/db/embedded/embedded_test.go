@@ -0,0 +1,28 @@
+package embedded
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/robotomize/cribe/internal/db"
+	"github.com/robotomize/cribe/internal/db/dbtest"
+)
+
+func TestRepositories(t *testing.T) {
+	t.Parallel()
+
+	dbtest.TestRepositories(t, func(t *testing.T) db.Repositories {
+		d, err := Open(filepath.Join(t.TempDir(), "cribe.db"))
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+
+		t.Cleanup(func() {
+			if err := d.Close(); err != nil {
+				t.Errorf("close: %v", err)
+			}
+		})
+
+		return NewRepositories(d)
+	})
+}
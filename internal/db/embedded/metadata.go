@@ -0,0 +1,465 @@
+package embedded
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/robotomize/cribe/internal/db"
+	bolt "go.etcd.io/bbolt"
+)
+
+// search weights of the fields, they follow the A, B and C weights of the Postgres search vector, keywords
+// weigh as much as the author
+const (
+	weightTitle       = 1.0
+	weightAuthor      = 0.4
+	weightDescription = 0.2
+)
+
+func NewMetadataRepository(d *DB) *MetadataRepository {
+	return &MetadataRepository{DB: d}
+}
+
+var _ db.MetadataCatalog = (*MetadataRepository)(nil)
+
+type MetadataRepository struct {
+	*DB
+}
+
+func (m *MetadataRepository) FetchByMetadata(
+	_ context.Context, videoID string, mime string, quality string,
+) (db.Metadata, error) {
+	var model db.Metadata
+	if err := m.bolt.View(func(tx *bolt.Tx) error {
+		return get(tx.Bucket(bucketMetadata), metadataKey(videoID, mime, quality), &model)
+	}); err != nil {
+		return model, fmt.Errorf("fetch metadata: %w", err)
+	}
+
+	return model, nil
+}
+
+// FetchByVideoID returns every stored format of the video
+func (m *MetadataRepository) FetchByVideoID(_ context.Context, videoID string) ([]db.Metadata, error) {
+	var models []db.Metadata
+	if err := m.bolt.View(func(tx *bolt.Tx) error {
+		prefix := []byte(videoID + "\x00")
+		c := tx.Bucket(bucketMetadata).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var model db.Metadata
+			if err := json.Unmarshal(v, &model); err != nil {
+				return fmt.Errorf("json unmarshal: %w", err)
+			}
+
+			models = append(models, model)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("fetch metadata by video: %w", err)
+	}
+
+	sort.Slice(models, func(i, j int) bool {
+		if models[i].Quality != models[j].Quality {
+			return models[i].Quality < models[j].Quality
+		}
+
+		return models[i].Mime < models[j].Mime
+	})
+
+	return models, nil
+}
+
+// List returns a page of metadata, the most recently created first
+func (m *MetadataRepository) List(_ context.Context, limit, offset int) ([]db.Metadata, error) {
+	models, err := m.all()
+	if err != nil {
+		return nil, fmt.Errorf("list metadata: %w", err)
+	}
+
+	sort.Slice(models, func(i, j int) bool {
+		return newerMetadata(models[i], models[j])
+	})
+
+	return page(models, limit, offset), nil
+}
+
+// Search returns a page of metadata whose title, author, keywords or description contain all words of the
+// query, title matches rank first
+func (m *MetadataRepository) Search(_ context.Context, query string, limit, offset int) ([]db.Metadata, error) {
+	words := searchWords(query)
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	models, err := m.all()
+	if err != nil {
+		return nil, fmt.Errorf("search metadata: %w", err)
+	}
+
+	type match struct {
+		model db.Metadata
+		rank  float64
+	}
+
+	var matches []match
+	for _, model := range models {
+		if rank, ok := searchRank(model.Params, words); ok {
+			matches = append(matches, match{model: model, rank: rank})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].rank != matches[j].rank {
+			return matches[i].rank > matches[j].rank
+		}
+
+		return newerMetadata(matches[i].model, matches[j].model)
+	})
+
+	var found []db.Metadata
+	for _, match := range page(matches, limit, offset) {
+		found = append(found, match.model)
+	}
+
+	return found, nil
+}
+
+// Delete removes a single format of the video, db.ErrNotFound is returned when there is no such format
+func (m *MetadataRepository) Delete(_ context.Context, videoID string, mime string, quality string) error {
+	if err := m.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketMetadata)
+		key := metadataKey(videoID, mime, quality)
+		if b.Get(key) == nil {
+			return db.ErrNotFound
+		}
+
+		return b.Delete(key)
+	}); err != nil {
+		return fmt.Errorf("delete metadata: %w", err)
+	}
+
+	return nil
+}
+
+// FetchByKeys returns the stored formats of the keys in their order, missing ones are skipped
+func (m *MetadataRepository) FetchByKeys(_ context.Context, keys []db.MetadataKey) ([]db.Metadata, error) {
+	var models []db.Metadata
+	if err := m.bolt.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketMetadata)
+		for _, key := range keys {
+			var model db.Metadata
+			if err := get(b, metadataKey(key.VideoID, key.Mime, key.Quality), &model); err != nil {
+				if errors.Is(err, db.ErrNotFound) {
+					continue
+				}
+
+				return err
+			}
+
+			models = append(models, model)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("fetch metadata by keys: %w", err)
+	}
+
+	return models, nil
+}
+
+// Save inserts the metadata or updates the stored format, the creation time of a stored one is kept
+func (m *MetadataRepository) Save(_ context.Context, model db.Metadata) error {
+	if err := m.bolt.Update(func(tx *bolt.Tx) error {
+		return saveMetadata(tx.Bucket(bucketMetadata), model)
+	}); err != nil {
+		return fmt.Errorf("insert metadata: %w", err)
+	}
+
+	return nil
+}
+
+// SaveBatch saves all models in a single transaction
+func (m *MetadataRepository) SaveBatch(_ context.Context, models []db.Metadata) error {
+	if err := m.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketMetadata)
+		for _, model := range models {
+			if err := saveMetadata(b, model); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("insert metadata batch: %w", err)
+	}
+
+	return nil
+}
+
+// Touch records that the cached file id of the format was served at the time, db.ErrNoRowsUpd is returned
+// when there is no such format
+func (m *MetadataRepository) Touch(
+	_ context.Context, videoID string, mime string, quality string, at time.Time,
+) error {
+	if err := m.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketMetadata)
+		key := metadataKey(videoID, mime, quality)
+
+		var stored db.Metadata
+		if err := get(b, key, &stored); err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				return db.ErrNoRowsUpd
+			}
+
+			return err
+		}
+
+		stored.HitCount++
+		if at.After(stored.LastAccessedAt) {
+			stored.LastAccessedAt = at
+		}
+
+		return put(b, key, stored)
+	}); err != nil {
+		return fmt.Errorf("touch metadata: %w", err)
+	}
+
+	return nil
+}
+
+// ExtendLink records a download link to the stored object valid until at, a link expiring later is kept.
+// db.ErrNoRowsUpd is returned when there is no such format
+func (m *MetadataRepository) ExtendLink(
+	_ context.Context, videoID string, mime string, quality string, at time.Time,
+) error {
+	if err := m.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketMetadata)
+		key := metadataKey(videoID, mime, quality)
+
+		var stored db.Metadata
+		if err := get(b, key, &stored); err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				return db.ErrNoRowsUpd
+			}
+
+			return err
+		}
+
+		if !at.After(stored.LinkExpiresAt) {
+			return nil
+		}
+
+		stored.LinkExpiresAt = at
+
+		return put(b, key, stored)
+	}); err != nil {
+		return fmt.Errorf("extend metadata link: %w", err)
+	}
+
+	return nil
+}
+
+// MostRequested returns the formats whose file id was served the most
+func (m *MetadataRepository) MostRequested(_ context.Context, limit int) ([]db.Metadata, error) {
+	models, err := m.all()
+	if err != nil {
+		return nil, fmt.Errorf("most requested metadata: %w", err)
+	}
+
+	var requested []db.Metadata
+	for _, model := range models {
+		if model.HitCount > 0 {
+			requested = append(requested, model)
+		}
+	}
+
+	sort.Slice(requested, func(i, j int) bool {
+		a, b := requested[i], requested[j]
+		if a.HitCount != b.HitCount {
+			return a.HitCount > b.HitCount
+		}
+
+		if !a.LastAccessedAt.Equal(b.LastAccessedAt) {
+			return a.LastAccessedAt.After(b.LastAccessedAt)
+		}
+
+		return metadataKeyLess(a, b)
+	})
+
+	return page(requested, limit, 0), nil
+}
+
+// PurgeUnused removes the formats neither served nor saved since before, moving them to the archive when asked to.
+// It returns the keys of the removed formats
+func (m *MetadataRepository) PurgeUnused(_ context.Context, before time.Time, archive bool) ([]db.MetadataKey, error) {
+	var purged []db.MetadataKey
+	if err := m.bolt.Update(func(tx *bolt.Tx) error {
+		b, archived := tx.Bucket(bucketMetadata), tx.Bucket(bucketMetadataArchive)
+		archivedAt := time.Now()
+
+		var keys [][]byte
+		if err := b.ForEach(func(k, v []byte) error {
+			var model db.Metadata
+			if err := json.Unmarshal(v, &model); err != nil {
+				return fmt.Errorf("json unmarshal: %w", err)
+			}
+
+			if !model.LastAccessedAt.Before(before) || !model.UpdatedAt.Before(before) {
+				return nil
+			}
+
+			keys = append(keys, k)
+			purged = append(purged, db.MetadataKey{VideoID: model.VideoID, Mime: model.Mime, Quality: model.Quality})
+			if !archive {
+				return nil
+			}
+
+			seq, err := archived.NextSequence()
+			if err != nil {
+				return fmt.Errorf("next sequence: %w", err)
+			}
+
+			return put(archived, idKey(int64(seq)), archivedMetadata{Metadata: model, ArchivedAt: archivedAt})
+		}); err != nil {
+			return err
+		}
+
+		// a bucket must not be changed while it is iterated
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return fmt.Errorf("delete: %w", err)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("purge metadata: %w", err)
+	}
+
+	return purged, nil
+}
+
+func (m *MetadataRepository) all() ([]db.Metadata, error) {
+	var models []db.Metadata
+	if err := m.bolt.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMetadata).ForEach(func(_, v []byte) error {
+			var model db.Metadata
+			if err := json.Unmarshal(v, &model); err != nil {
+				return fmt.Errorf("json unmarshal: %w", err)
+			}
+
+			models = append(models, model)
+
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+// saveMetadata puts the model keeping the creation time and the usage of a stored one
+func saveMetadata(b *bolt.Bucket, model db.Metadata) error {
+	key := metadataKey(model.VideoID, model.Mime, model.Quality)
+
+	var stored db.Metadata
+	if err := get(b, key, &stored); err == nil {
+		model.CreatedAt = stored.CreatedAt
+		model.HitCount = stored.HitCount
+		model.LastAccessedAt = stored.LastAccessedAt
+		model.LinkExpiresAt = stored.LinkExpiresAt
+	} else {
+		model.HitCount = 0
+		model.LastAccessedAt = model.UpdatedAt
+		model.LinkExpiresAt = time.Time{}
+	}
+
+	return put(b, key, model)
+}
+
+func metadataKey(videoID, mime, quality string) []byte {
+	return []byte(videoID + "\x00" + mime + "\x00" + quality)
+}
+
+// newerMetadata orders metadata the way the Postgres repository lists it
+func newerMetadata(a, b db.Metadata) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+
+	return metadataKeyLess(a, b)
+}
+
+func metadataKeyLess(a, b db.Metadata) bool {
+	if a.VideoID != b.VideoID {
+		return a.VideoID < b.VideoID
+	}
+
+	if a.Mime != b.Mime {
+		return a.Mime < b.Mime
+	}
+
+	return a.Quality < b.Quality
+}
+
+// archivedMetadata is a purged format kept in the archive bucket
+type archivedMetadata struct {
+	db.Metadata
+	ArchivedAt time.Time
+}
+
+// searchWords splits text into lower case words the way the simple text search configuration does
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchRank returns the rank of the params when they contain every query word
+func searchRank(params db.VideoParams, words []string) (float64, bool) {
+	fields := []struct {
+		words  map[string]struct{}
+		weight float64
+	}{
+		{words: wordSet(params.Title), weight: weightTitle},
+		{words: wordSet(params.Author), weight: weightAuthor},
+		{words: wordSet(strings.Join(params.Keywords, " ")), weight: weightAuthor},
+		{words: wordSet(params.Description), weight: weightDescription},
+	}
+
+	var rank float64
+	for _, word := range words {
+		var best float64
+		for _, field := range fields {
+			if _, ok := field.words[word]; ok && field.weight > best {
+				best = field.weight
+			}
+		}
+
+		if best == 0 {
+			return 0, false
+		}
+
+		rank += best
+	}
+
+	return rank, true
+}
+
+func wordSet(text string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, word := range searchWords(text) {
+		set[word] = struct{}{}
+	}
+
+	return set
+}
@@ -0,0 +1,206 @@
+package embedded
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/robotomize/cribe/internal/db"
+	bolt "go.etcd.io/bbolt"
+)
+
+func NewRequestRepository(d *DB) *RequestRepository {
+	return &RequestRepository{DB: d}
+}
+
+var _ db.RequestStore = (*RequestRepository)(nil)
+
+// RequestRepository keeps the download history of users. Requests are stored by id, the user index
+// lists the ids of every user and the format index makes a repeated request update the stored one
+type RequestRepository struct {
+	*DB
+}
+
+func (r *RequestRepository) FetchByID(_ context.Context, id int64) (db.Request, error) {
+	var model db.Request
+	if err := r.bolt.View(func(tx *bolt.Tx) error {
+		if err := get(tx.Bucket(bucketRequests), idKey(id), &model); err != nil {
+			return err
+		}
+
+		model.Title = requestTitle(tx, model)
+
+		return nil
+	}); err != nil {
+		return model, fmt.Errorf("fetch request: %w", err)
+	}
+
+	return model, nil
+}
+
+// ListByUser returns a page of the user history, the most recently updated requests first
+func (r *RequestRepository) ListByUser(_ context.Context, userID int64, limit, offset int) ([]db.Request, error) {
+	var models []db.Request
+	if err := r.bolt.View(func(tx *bolt.Tx) error {
+		requests := tx.Bucket(bucketRequests)
+		prefix := idKey(userID)
+		c := tx.Bucket(bucketUserRequests).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			var model db.Request
+			if err := get(requests, k[len(prefix):], &model); err != nil {
+				return err
+			}
+
+			models = append(models, model)
+		}
+
+		sort.Slice(models, func(i, j int) bool {
+			if !models[i].UpdatedAt.Equal(models[j].UpdatedAt) {
+				return models[i].UpdatedAt.After(models[j].UpdatedAt)
+			}
+
+			return models[i].ID > models[j].ID
+		})
+
+		models = page(models, limit, offset)
+		for i := range models {
+			models[i].Title = requestTitle(tx, models[i])
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("list requests: %w", err)
+	}
+
+	return models, nil
+}
+
+// Save records the outcome of the request, a repeated request of the same format updates the stored one.
+// An outcome without a format, such as a failure before the format was resolved, updates the requests of the
+// video instead and gives way to the first outcome of a format
+func (r *RequestRepository) Save(_ context.Context, model db.Request) error {
+	if err := r.bolt.Update(func(tx *bolt.Tx) error {
+		if model.Mime == "" && model.Quality == "" {
+			return saveUnresolvedRequest(tx, model)
+		}
+
+		keys := tx.Bucket(bucketRequestKeys)
+		if id := keys.Get(requestKey(model.UserID, model.VideoID, "", "")); id != nil {
+			superseded, err := deleteRequest(tx, id)
+			if err != nil {
+				return err
+			}
+
+			model.CreatedAt = superseded.CreatedAt
+		}
+
+		formatKey := requestKey(model.UserID, model.VideoID, model.Mime, model.Quality)
+		if id := keys.Get(formatKey); id != nil {
+			return updateRequest(tx, id, model)
+		}
+
+		return insertRequest(tx, formatKey, model)
+	}); err != nil {
+		return fmt.Errorf("save request: %w", err)
+	}
+
+	return nil
+}
+
+// saveUnresolvedRequest updates the request of the video without a format, the requests of its formats are
+// left alone
+func saveUnresolvedRequest(tx *bolt.Tx, model db.Request) error {
+	formatKey := requestKey(model.UserID, model.VideoID, "", "")
+	if id := tx.Bucket(bucketRequestKeys).Get(formatKey); id != nil {
+		return updateRequest(tx, id, model)
+	}
+
+	return insertRequest(tx, formatKey, model)
+}
+
+func insertRequest(tx *bolt.Tx, formatKey []byte, model db.Request) error {
+	requests := tx.Bucket(bucketRequests)
+	seq, err := requests.NextSequence()
+	if err != nil {
+		return fmt.Errorf("next sequence: %w", err)
+	}
+
+	model.ID = int64(seq)
+	if err = tx.Bucket(bucketRequestKeys).Put(formatKey, idKey(model.ID)); err != nil {
+		return fmt.Errorf("put: %w", err)
+	}
+
+	if err = tx.Bucket(bucketUserRequests).Put(userRequestKey(model.UserID, model.ID), []byte{}); err != nil {
+		return fmt.Errorf("put: %w", err)
+	}
+
+	// the title is read from the metadata, it is never stored with the request
+	model.Title = ""
+
+	return put(requests, idKey(model.ID), model)
+}
+
+func updateRequest(tx *bolt.Tx, id []byte, model db.Request) error {
+	requests := tx.Bucket(bucketRequests)
+
+	var stored db.Request
+	if err := get(requests, id, &stored); err != nil {
+		return err
+	}
+
+	stored.ChatID = model.ChatID
+	stored.Outcome = model.Outcome
+	stored.UpdatedAt = model.UpdatedAt
+
+	return put(requests, id, stored)
+}
+
+// deleteRequest removes the request with its format and user index entries and returns it
+func deleteRequest(tx *bolt.Tx, id []byte) (db.Request, error) {
+	requests := tx.Bucket(bucketRequests)
+
+	var stored db.Request
+	if err := get(requests, id, &stored); err != nil {
+		return stored, err
+	}
+
+	if err := tx.Bucket(bucketRequestKeys).Delete(
+		requestKey(stored.UserID, stored.VideoID, stored.Mime, stored.Quality),
+	); err != nil {
+		return stored, fmt.Errorf("delete: %w", err)
+	}
+
+	if err := tx.Bucket(bucketUserRequests).Delete(userRequestKey(stored.UserID, stored.ID)); err != nil {
+		return stored, fmt.Errorf("delete: %w", err)
+	}
+
+	if err := requests.Delete(id); err != nil {
+		return stored, fmt.Errorf("delete: %w", err)
+	}
+
+	return stored, nil
+}
+
+func requestKey(userID int64, videoID, mime, quality string) []byte {
+	return []byte(strconv.FormatInt(userID, 10) + "\x00" + videoID + "\x00" + mime + "\x00" + quality)
+}
+
+func userRequestKey(userID, id int64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(userID))
+	binary.BigEndian.PutUint64(key[8:], uint64(id))
+
+	return key
+}
+
+func requestTitle(tx *bolt.Tx, model db.Request) string {
+	var metadata db.Metadata
+	if err := get(tx.Bucket(bucketMetadata), metadataKey(model.VideoID, model.Mime, model.Quality), &metadata); err != nil {
+		return ""
+	}
+
+	return metadata.Params.Title
+}
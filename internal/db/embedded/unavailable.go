@@ -0,0 +1,69 @@
+package embedded
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/robotomize/cribe/internal/db"
+	bolt "go.etcd.io/bbolt"
+)
+
+func NewUnavailableRepository(d *DB) *UnavailableRepository {
+	return &UnavailableRepository{DB: d, timeFn: time.Now}
+}
+
+var _ db.UnavailableStore = (*UnavailableRepository)(nil)
+
+// UnavailableRepository keeps the videos youtube refused to serve
+type UnavailableRepository struct {
+	*DB
+	timeFn func() time.Time
+}
+
+// FetchByVideoID returns the entry of the video, db.ErrNotFound is returned for an expired one
+func (u *UnavailableRepository) FetchByVideoID(_ context.Context, videoID string) (db.Unavailable, error) {
+	var model db.Unavailable
+	if err := u.bolt.View(func(tx *bolt.Tx) error {
+		if err := get(tx.Bucket(bucketUnavailable), []byte(videoID), &model); err != nil {
+			return err
+		}
+
+		if !model.ExpiresAt.After(u.timeFn()) {
+			return db.ErrNotFound
+		}
+
+		return nil
+	}); err != nil {
+		return db.Unavailable{}, fmt.Errorf("fetch unavailable video: %w", err)
+	}
+
+	return model, nil
+}
+
+// Save inserts the entry or replaces the one of the video
+func (u *UnavailableRepository) Save(_ context.Context, model db.Unavailable) error {
+	if err := u.bolt.Update(func(tx *bolt.Tx) error {
+		return put(tx.Bucket(bucketUnavailable), []byte(model.VideoID), model)
+	}); err != nil {
+		return fmt.Errorf("save unavailable video: %w", err)
+	}
+
+	return nil
+}
+
+// Delete forgets the video, db.ErrNotFound is returned when there is no entry
+func (u *UnavailableRepository) Delete(_ context.Context, videoID string) error {
+	if err := u.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketUnavailable)
+		if b.Get([]byte(videoID)) == nil {
+			return db.ErrNotFound
+		}
+
+		return b.Delete([]byte(videoID))
+	}); err != nil {
+		return fmt.Errorf("delete unavailable video: %w", err)
+	}
+
+	return nil
+}
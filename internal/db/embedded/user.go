@@ -0,0 +1,82 @@
+package embedded
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/robotomize/cribe/internal/db"
+	bolt "go.etcd.io/bbolt"
+)
+
+func NewUserRepository(d *DB) *UserRepository {
+	return &UserRepository{DB: d}
+}
+
+var _ db.UserStore = (*UserRepository)(nil)
+
+type UserRepository struct {
+	*DB
+}
+
+func (u *UserRepository) FetchByID(_ context.Context, id int64) (db.User, error) {
+	var model db.User
+	if err := u.bolt.View(func(tx *bolt.Tx) error {
+		return get(tx.Bucket(bucketUsers), idKey(id), &model)
+	}); err != nil {
+		return model, fmt.Errorf("fetch user: %w", err)
+	}
+
+	return model, nil
+}
+
+// Upsert records a request of the user the way db.UserRepository.Upsert does
+func (u *UserRepository) Upsert(_ context.Context, model db.User) error {
+	if err := u.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketUsers)
+
+		var stored db.User
+		if err := get(b, idKey(model.ID), &stored); err != nil {
+			if !errors.Is(err, db.ErrNotFound) {
+				return err
+			}
+
+			stored = db.User{ID: model.ID, FirstSeenAt: model.LastSeenAt}
+		}
+
+		stored.Username = model.Username
+		stored.LanguageCode = model.LanguageCode
+		stored.Blocked = false
+		stored.RequestsCount++
+		stored.LastSeenAt = model.LastSeenAt
+
+		return put(b, idKey(model.ID), stored)
+	}); err != nil {
+		return fmt.Errorf("upsert user: %w", err)
+	}
+
+	return nil
+}
+
+func (u *UserRepository) SetBlocked(_ context.Context, id int64, blocked bool) error {
+	if err := u.bolt.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketUsers)
+
+		var stored db.User
+		if err := get(b, idKey(id), &stored); err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				return db.ErrNoRowsUpd
+			}
+
+			return err
+		}
+
+		stored.Blocked = blocked
+
+		return put(b, idKey(id), stored)
+	}); err != nil {
+		return fmt.Errorf("update user: %w", err)
+	}
+
+	return nil
+}
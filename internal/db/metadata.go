@@ -4,10 +4,50 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v4"
 )
 
+const metadataColumns = `video_id, quality, mime, file_id, file_id_failures, params, hit_count, last_accessed_at,
+	link_expires_at, created_at, updated_at`
+
+// every statement of the repository is a single one, so it runs on the pool without a transaction
+var (
+	stmtFetchMetadata = prepare("fetch_metadata", `
+		SELECT `+metadataColumns+`
+		FROM
+			metadata
+		WHERE video_id = $1 AND quality = $2 AND mime = $3
+	`)
+	stmtFetchMetadataByVideo = prepare("fetch_metadata_by_video", `
+		SELECT `+metadataColumns+`
+		FROM
+			metadata
+		WHERE video_id = $1
+		ORDER BY quality, mime
+	`)
+	stmtSaveMetadata = prepare("save_metadata", `
+		INSERT
+		INTO metadata (
+			video_id, quality, mime, file_id, file_id_failures, params, created_at, updated_at, last_accessed_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+		ON CONFLICT (video_id, mime, quality)
+		DO UPDATE SET file_id = $4, file_id_failures = $5, updated_at = $8, params = $6
+	`)
+	stmtTouchMetadata = prepare("touch_metadata", `
+		UPDATE metadata
+		SET hit_count = hit_count + 1, last_accessed_at = GREATEST(last_accessed_at, $4)
+		WHERE video_id = $1 AND quality = $2 AND mime = $3
+	`)
+	stmtExtendLinkMetadata = prepare("extend_link_metadata", `
+		UPDATE metadata
+		SET link_expires_at = GREATEST(link_expires_at, $4)
+		WHERE video_id = $1 AND quality = $2 AND mime = $3
+	`)
+)
+
 func NewMetadataRepository(DB *DB) *MetadataRepository {
 	return &MetadataRepository{DB: DB}
 }
@@ -19,56 +59,318 @@ type MetadataRepository struct {
 func (m *MetadataRepository) FetchByMetadata(
 	ctx context.Context, videoID string, mime string, quality string,
 ) (Metadata, error) {
-	var model Metadata
-	if err := m.InTx(ctx, pgx.ReadCommitted, func(tx pgx.Tx) error {
-		row := tx.QueryRow(ctx, `
-			SELECT
-				video_id, quality, mime, file_id, params, created_at, updated_at
-			FROM
-				metadata
-			WHERE video_id = $1 AND quality = $2 AND mime = $3
-		`, videoID, quality, mime)
-		if err := row.Scan(
-			&model.VideoID, &model.Quality, &model.Mime, &model.FileID, &model.Params, &model.CreatedAt, &model.UpdatedAt,
-		); err != nil {
-			if errors.Is(err, pgx.ErrNoRows) {
-				return ErrNotFound
+	model, err := scanMetadataRow(m.Pool.QueryRow(ctx, stmtFetchMetadata, videoID, quality, mime))
+	if err != nil {
+		return model, fmt.Errorf("fetch metadata: %w", err)
+	}
+
+	return model, nil
+}
+
+// FetchByVideoID returns every stored format of the video
+func (m *MetadataRepository) FetchByVideoID(ctx context.Context, videoID string) ([]Metadata, error) {
+	rows, err := m.Pool.Query(ctx, stmtFetchMetadataByVideo, videoID)
+	if err != nil {
+		return nil, fmt.Errorf("fetch metadata by video: query: %w", err)
+	}
+
+	models, err := scanMetadata(rows)
+	if err != nil {
+		return nil, fmt.Errorf("fetch metadata by video: %w", err)
+	}
+
+	return models, nil
+}
+
+// FetchByKeys returns the stored formats of the keys in their order, missing ones are skipped.
+// The lookups are sent in a single batch
+func (m *MetadataRepository) FetchByKeys(ctx context.Context, keys []MetadataKey) ([]Metadata, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	batch := &pgx.Batch{}
+	for _, key := range keys {
+		batch.Queue(stmtFetchMetadata, key.VideoID, key.Quality, key.Mime)
+	}
+
+	results := m.Pool.SendBatch(ctx, batch)
+	defer results.Close()
+
+	models := make([]Metadata, 0, len(keys))
+	for range keys {
+		model, err := scanMetadataRow(results.QueryRow())
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
 			}
 
-			return fmt.Errorf("transaction: %w", err)
+			return nil, fmt.Errorf("fetch metadata by keys: %w", err)
 		}
 
-		return nil
-	}); err != nil {
-		return model, fmt.Errorf("fetch metadata: %w", err)
+		models = append(models, model)
 	}
 
-	return model, nil
+	return models, nil
+}
+
+// List returns a page of metadata, the most recently created first
+func (m *MetadataRepository) List(ctx context.Context, limit, offset int) ([]Metadata, error) {
+	rows, err := m.Pool.Query(ctx, `
+		SELECT `+metadataColumns+`
+		FROM
+			metadata
+		ORDER BY created_at DESC, video_id, mime, quality
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("list metadata: query: %w", err)
+	}
+
+	models, err := scanMetadata(rows)
+	if err != nil {
+		return nil, fmt.Errorf("list metadata: %w", err)
+	}
+
+	return models, nil
+}
+
+// Search returns a page of metadata whose title, author, keywords or description match all words of the
+// query, title matches rank first
+func (m *MetadataRepository) Search(ctx context.Context, query string, limit, offset int) ([]Metadata, error) {
+	rows, err := m.Pool.Query(ctx, `
+		SELECT `+metadataColumns+`
+		FROM
+			metadata, plainto_tsquery('simple', $1) AS query
+		WHERE search_tsv @@ query
+		ORDER BY ts_rank(search_tsv, query) DESC, created_at DESC, video_id, mime, quality
+		LIMIT $2 OFFSET $3
+	`, query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("search metadata: query: %w", err)
+	}
+
+	models, err := scanMetadata(rows)
+	if err != nil {
+		return nil, fmt.Errorf("search metadata: %w", err)
+	}
+
+	return models, nil
+}
+
+// Delete removes a single format of the video, ErrNotFound is returned when there is no such format
+func (m *MetadataRepository) Delete(ctx context.Context, videoID string, mime string, quality string) error {
+	result, err := m.Pool.Exec(
+		ctx, `DELETE FROM metadata WHERE video_id = $1 AND quality = $2 AND mime = $3`, videoID, quality, mime,
+	)
+	if err != nil {
+		return fmt.Errorf("delete metadata: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("delete metadata: %w", ErrNotFound)
+	}
+
+	return nil
 }
 
 func (m *MetadataRepository) Save(ctx context.Context, model Metadata) error {
+	result, err := m.Pool.Exec(ctx, stmtSaveMetadata, saveMetadataArgs(model)...)
+	if err != nil {
+		return fmt.Errorf("insert metadata: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("insert metadata: %w", ErrKeyConflict)
+	}
+
+	return nil
+}
+
+// SaveBatch saves all models or none of them, the statements are sent in a single batch
+func (m *MetadataRepository) SaveBatch(ctx context.Context, models []Metadata) error {
+	if len(models) == 0 {
+		return nil
+	}
+
 	if err := m.InTx(ctx, pgx.ReadCommitted, func(tx pgx.Tx) error {
-		result, err := tx.Exec(
-			ctx, `INSERT 
-					INTO metadata (video_id, quality, mime, file_id, params, created_at, updated_at)
-					VALUES ($1, $2, $3, $4, $5, $6, $7) 
-					ON CONFLICT (video_id, mime, quality) 
-					DO UPDATE SET file_id = $8, updated_at = $9, params = $10`,
-			model.VideoID, model.Quality, model.Mime, model.FileID, model.Params, model.CreatedAt,
-			model.UpdatedAt, model.FileID, model.UpdatedAt, model.Params,
-		)
-		if err != nil {
-			return fmt.Errorf("transaction: %w", err)
+		batch := &pgx.Batch{}
+		for _, model := range models {
+			batch.Queue(stmtSaveMetadata, saveMetadataArgs(model)...)
 		}
 
-		if result.RowsAffected() == 0 {
-			return ErrKeyConflict
+		results := tx.SendBatch(ctx, batch)
+		for range models {
+			result, err := results.Exec()
+			if err != nil {
+				_ = results.Close()
+
+				return fmt.Errorf("transaction: %w", err)
+			}
+
+			if result.RowsAffected() == 0 {
+				_ = results.Close()
+
+				return ErrKeyConflict
+			}
 		}
 
-		return nil
+		return results.Close()
 	}); err != nil {
-		return fmt.Errorf("insert metadata: %w", err)
+		return fmt.Errorf("insert metadata batch: %w", err)
+	}
+
+	return nil
+}
+
+// Touch records that the cached file id of the format was served at the time, ErrNoRowsUpd is returned
+// when there is no such format
+func (m *MetadataRepository) Touch(
+	ctx context.Context, videoID string, mime string, quality string, at time.Time,
+) error {
+	result, err := m.Pool.Exec(ctx, stmtTouchMetadata, videoID, quality, mime, at)
+	if err != nil {
+		return fmt.Errorf("touch metadata: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("touch metadata: %w", ErrNoRowsUpd)
+	}
+
+	return nil
+}
+
+// ExtendLink records a download link to the stored object valid until at, a link expiring later is kept.
+// ErrNoRowsUpd is returned when there is no such format
+func (m *MetadataRepository) ExtendLink(
+	ctx context.Context, videoID string, mime string, quality string, at time.Time,
+) error {
+	result, err := m.Pool.Exec(ctx, stmtExtendLinkMetadata, videoID, quality, mime, at)
+	if err != nil {
+		return fmt.Errorf("extend metadata link: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("extend metadata link: %w", ErrNoRowsUpd)
 	}
 
 	return nil
 }
+
+// MostRequested returns the formats whose file id was served the most
+func (m *MetadataRepository) MostRequested(ctx context.Context, limit int) ([]Metadata, error) {
+	rows, err := m.Pool.Query(ctx, `
+		SELECT `+metadataColumns+`
+		FROM
+			metadata
+		WHERE hit_count > 0
+		ORDER BY hit_count DESC, last_accessed_at DESC, video_id, mime, quality
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("most requested metadata: query: %w", err)
+	}
+
+	models, err := scanMetadata(rows)
+	if err != nil {
+		return nil, fmt.Errorf("most requested metadata: %w", err)
+	}
+
+	return models, nil
+}
+
+// PurgeUnused removes the formats neither served nor saved since before, moving them to the archive when asked to.
+// It returns the keys of the removed formats
+func (m *MetadataRepository) PurgeUnused(
+	ctx context.Context, before time.Time, archive bool,
+) ([]MetadataKey, error) {
+	query := `DELETE FROM metadata WHERE last_accessed_at < $1 AND updated_at < $1 RETURNING video_id, mime, quality`
+	if archive {
+		// a single statement, the rows are never deleted without being archived
+		query = `WITH purged AS (
+					DELETE FROM metadata WHERE last_accessed_at < $1 AND updated_at < $1 RETURNING *
+				), archived AS (
+					INSERT
+					INTO metadata_archive (
+						video_id, quality, mime, file_id, params, hit_count, last_accessed_at, created_at, updated_at
+					)
+					SELECT
+						video_id, quality, mime, file_id, params, hit_count, last_accessed_at, created_at, updated_at
+					FROM purged
+				)
+				SELECT video_id, mime, quality FROM purged`
+	}
+
+	rows, err := m.Pool.Query(ctx, query, before)
+	if err != nil {
+		return nil, fmt.Errorf("purge metadata: query: %w", err)
+	}
+
+	defer rows.Close()
+
+	var keys []MetadataKey
+	for rows.Next() {
+		var key MetadataKey
+		if err = rows.Scan(&key.VideoID, &key.Mime, &key.Quality); err != nil {
+			return nil, fmt.Errorf("purge metadata: scan: %w", err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("purge metadata: rows: %w", err)
+	}
+
+	return keys, nil
+}
+
+func saveMetadataArgs(model Metadata) []interface{} {
+	return []interface{}{
+		model.VideoID, model.Quality, model.Mime, model.FileID, model.FileIDFailures, model.Params, model.CreatedAt,
+		model.UpdatedAt,
+	}
+}
+
+func scanMetadataRow(row pgx.Row) (Metadata, error) {
+	var (
+		model         Metadata
+		linkExpiresAt *time.Time
+	)
+	if err := row.Scan(
+		&model.VideoID, &model.Quality, &model.Mime, &model.FileID, &model.FileIDFailures, &model.Params,
+		&model.HitCount, &model.LastAccessedAt, &linkExpiresAt, &model.CreatedAt, &model.UpdatedAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model, ErrNotFound
+		}
+
+		return model, fmt.Errorf("scan: %w", err)
+	}
+
+	if linkExpiresAt != nil {
+		model.LinkExpiresAt = *linkExpiresAt
+	}
+
+	return model, nil
+}
+
+func scanMetadata(rows pgx.Rows) ([]Metadata, error) {
+	defer rows.Close()
+
+	var models []Metadata
+	for rows.Next() {
+		model, err := scanMetadataRow(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		models = append(models, model)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+
+	return models, nil
+}
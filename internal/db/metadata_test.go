@@ -0,0 +1,158 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/robotomize/cribe/internal/db"
+)
+
+// playlistSize is the number of formats looked up at once by the batch benchmarks
+const playlistSize = 50
+
+// The benchmarks run against the Postgres of TestRepositories, for example
+//
+//	DB_TEST_POSTGRES=1 go test ./internal/db -run '^$' -bench Metadata
+//
+// The InTx ones run the statements the way the repository did before, in a transaction of their own
+func BenchmarkMetadata_FetchByMetadata(b *testing.B) {
+	ctx := context.Background()
+	database, keys := benchmarkMetadata(b)
+	repo := db.NewMetadataRepository(database)
+
+	b.Run("pool", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			key := keys[i%len(keys)]
+			if _, err := repo.FetchByMetadata(ctx, key.VideoID, key.Mime, key.Quality); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("in_tx", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			key := keys[i%len(keys)]
+			if err := fetchInTx(ctx, database, key); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkMetadata_FetchByKeys(b *testing.B) {
+	ctx := context.Background()
+	database, keys := benchmarkMetadata(b)
+	repo := db.NewMetadataRepository(database)
+
+	b.Run("batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := repo.FetchByKeys(ctx, keys); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("pool", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, key := range keys {
+				if _, err := repo.FetchByMetadata(ctx, key.VideoID, key.Mime, key.Quality); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("in_tx", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, key := range keys {
+				if err := fetchInTx(ctx, database, key); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkMetadata_SaveBatch(b *testing.B) {
+	ctx := context.Background()
+	database, _ := benchmarkMetadata(b)
+	repo := db.NewMetadataRepository(database)
+	models := playlistMetadata("save")
+
+	b.Run("batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := repo.SaveBatch(ctx, models); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("pool", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, model := range models {
+				if err := repo.Save(ctx, model); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+// benchmarkMetadata stores a playlist of formats and returns their keys
+func benchmarkMetadata(b *testing.B) (*db.DB, []db.MetadataKey) {
+	b.Helper()
+
+	database := testDB(b)
+	truncate(b, database)
+
+	models := playlistMetadata("fetch")
+	if err := db.NewMetadataRepository(database).SaveBatch(context.Background(), models); err != nil {
+		b.Fatalf("save: %v", err)
+	}
+
+	keys := make([]db.MetadataKey, 0, len(models))
+	for _, model := range models {
+		keys = append(keys, db.MetadataKey{VideoID: model.VideoID, Mime: model.Mime, Quality: model.Quality})
+	}
+
+	return database, keys
+}
+
+func playlistMetadata(prefix string) []db.Metadata {
+	now := time.Now()
+	models := make([]db.Metadata, 0, playlistSize)
+	for i := 0; i < playlistSize; i++ {
+		models = append(models, db.Metadata{
+			VideoID:   fmt.Sprintf("%s-%d", prefix, i),
+			Quality:   "hd720",
+			Mime:      "video/mp4",
+			FileID:    fmt.Sprintf("file-%d", i),
+			Params:    db.VideoParams{Version: db.VideoParamsVersion, Title: fmt.Sprintf("video %d", i)},
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+	}
+
+	return models
+}
+
+func fetchInTx(ctx context.Context, database *db.DB, key db.MetadataKey) error {
+	return database.InTx(ctx, pgx.ReadCommitted, func(tx pgx.Tx) error {
+		var model db.Metadata
+
+		return tx.QueryRow(ctx, `
+			SELECT
+				video_id, quality, mime, file_id, file_id_failures, params, hit_count, last_accessed_at,
+				created_at, updated_at
+			FROM
+				metadata
+			WHERE video_id = $1 AND quality = $2 AND mime = $3
+		`, key.VideoID, key.Quality, key.Mime).Scan(
+			&model.VideoID, &model.Quality, &model.Mime, &model.FileID, &model.FileIDFailures, &model.Params,
+			&model.HitCount, &model.LastAccessedAt, &model.CreatedAt, &model.UpdatedAt,
+		)
+	})
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v4"
+	"github.com/robotomize/cribe/migrations"
+)
+
+// ErrSchemaOutdated is returned when the schema is behind the migrations embedded into the binary
+var ErrSchemaOutdated = errors.New("database schema is outdated, run the migrations or set DB_AUTO_MIGRATE")
+
+// NewMigrate returns a migrate instance running the migrations embedded into the binary.
+// Every change of the schema version takes the postgres advisory lock of the migrations table,
+// so replicas starting at the same time apply migrations one at a time
+func NewMigrate(cfg *Config) (*migrate.Migrate, error) {
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("open embedded migrations: %w", err)
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", source, cfg.ConnectionURL())
+	if err != nil {
+		return nil, fmt.Errorf("create migrate: %w", err)
+	}
+
+	return m, nil
+}
+
+// MigrateUp applies all pending migrations, an up to date schema is not an error
+func MigrateUp(cfg *Config) error {
+	m, err := NewMigrate(cfg)
+	if err != nil {
+		return err
+	}
+
+	defer m.Close()
+
+	if err = m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("migrate up: %w", err)
+	}
+
+	return nil
+}
+
+// SchemaVersion returns the version of the latest migration embedded into the binary, the statements of the
+// repositories are written against it
+func SchemaVersion() (uint, error) {
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		return 0, fmt.Errorf("open embedded migrations: %w", err)
+	}
+
+	defer source.Close()
+
+	version, err := source.First()
+	if err != nil {
+		return 0, fmt.Errorf("first migration: %w", err)
+	}
+
+	for {
+		next, err := source.Next(version)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return version, nil
+			}
+
+			return 0, fmt.Errorf("next migration: %w", err)
+		}
+
+		version = next
+	}
+}
+
+// checkSchemaVersion fails with ErrSchemaOutdated when the schema of the connection is behind the required
+// version or its last migration failed. A newer schema is accepted, replicas are upgraded one at a time
+func checkSchemaVersion(ctx context.Context, conn *pgx.Conn, required uint) error {
+	var migrated bool
+	if err := conn.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&migrated); err != nil {
+		return fmt.Errorf("check schema version: %w", err)
+	}
+
+	if !migrated {
+		return fmt.Errorf("schema is not migrated, required version %d: %w", required, ErrSchemaOutdated)
+	}
+
+	var (
+		version int64
+		dirty   bool
+	)
+	if err := conn.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(
+		&version, &dirty,
+	); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("check schema version: %w", err)
+	}
+
+	if dirty {
+		return fmt.Errorf("migration %d of the schema failed, fix it by hand: %w", version, ErrSchemaOutdated)
+	}
+
+	if version < int64(required) {
+		return fmt.Errorf("schema version %d is behind %d: %w", version, required, ErrSchemaOutdated)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/robotomize/cribe/internal/db"
+	"github.com/robotomize/cribe/migrations"
+)
+
+func TestSchemaVersion(t *testing.T) {
+	t.Parallel()
+
+	ups, err := fs.Glob(migrations.FS, "*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		t.Fatalf("schema version: %v", err)
+	}
+
+	// migrations are numbered from 1 without gaps, see the migrations package
+	if int(version) != len(ups) {
+		t.Errorf("schema version got: %d, expected: %d", version, len(ups))
+	}
+}
+
+func TestNew_OutdatedSchema(t *testing.T) {
+	database := testDB(t)
+
+	if _, err := database.Pool.Exec(context.Background(), `UPDATE schema_migrations SET version = version - 1`); err != nil {
+		t.Fatalf("downgrade schema version: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if _, err := database.Pool.Exec(
+			context.Background(), `UPDATE schema_migrations SET version = version + 1`,
+		); err != nil {
+			t.Errorf("restore schema version: %v", err)
+		}
+	})
+
+	cfg := testConfig(t)
+	outdated, err := db.New(&cfg)
+	if err == nil {
+		outdated.Close()
+		t.Fatal("expected an outdated schema to be rejected")
+	}
+
+	if !errors.Is(err, db.ErrSchemaOutdated) || !strings.Contains(err.Error(), "is behind") {
+		t.Errorf("new got: %v, expected: %v", err, db.ErrSchemaOutdated)
+	}
+}
@@ -2,20 +2,128 @@ package db
 
 import "time"
 
+// VideoParamsVersion is the version of the params the fetcher writes now, older params are backfilled lazily
+const VideoParamsVersion = 1
+
 type VideoParams struct {
+	// Version is 0 for params saved before the channel and description were captured
+	Version  int    `json:"version,omitempty"`
 	Title    string `json:"title"`
 	Width    int    `json:"width"`
 	Height   int    `json:"height"`
 	Duration int    `json:"duration"`
 	Thumb    string `json:"thumb"`
+	Author   string `json:"author,omitempty"`
+	// ChannelID is the youtube id of the channel of the video
+	ChannelID string `json:"channel_id,omitempty"`
+	// ViewCount is the number of views when the video was fetched
+	ViewCount int64    `json:"view_count,omitempty"`
+	Keywords  []string `json:"keywords,omitempty"`
+	// PublishDate is the day the video was published, youtube reports no time
+	PublishDate time.Time `json:"publish_date"`
+	// Description is an excerpt of the video description
+	Description string    `json:"description,omitempty"`
+	Chapters    []Chapter `json:"chapters,omitempty"`
+}
+
+// Chapter is a section of the video listed in its description
+type Chapter struct {
+	// Start is the offset of the chapter in seconds
+	Start int    `json:"start"`
+	Title string `json:"title"`
+}
+
+// MetadataKey identifies a single format of a video
+type MetadataKey struct {
+	VideoID string
+	Mime    string
+	Quality string
 }
 
 type Metadata struct {
-	VideoID   string
-	Quality   string
-	Mime      string
-	FileID    string
-	Params    VideoParams
+	VideoID string
+	Quality string
+	Mime    string
+	FileID  string
+	// FileIDFailures counts file ids of the video telegram has rejected since the last successful share
+	FileIDFailures int
+	Params         VideoParams
+	// HitCount is the number of times the cached file id was served, it is only changed by Touch
+	HitCount int64
+	// LastAccessedAt is the last time the cached file id was served, Save only sets it for a new record
+	LastAccessedAt time.Time
+	// LinkExpiresAt is when the last download link to the stored object expires, it is only changed by ExtendLink.
+	// The metadata cache does not track it, read it from the catalog
+	LinkExpiresAt time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// User is a telegram user who has sent the bot at least one update
+type User struct {
+	ID            int64
+	Username      string
+	LanguageCode  string
+	Blocked       bool
+	RequestsCount int64
+	FirstSeenAt   time.Time
+	LastSeenAt    time.Time
+}
+
+// Chat is a telegram chat the bot has received at least one update from
+type Chat struct {
+	ID            int64
+	Type          string
+	Title         string
+	Username      string
+	Blocked       bool
+	RequestsCount int64
+	FirstSeenAt   time.Time
+	LastSeenAt    time.Time
+}
+
+type RequestOutcome string
+
+const (
+	OutcomeDelivered RequestOutcome = "delivered"
+	OutcomeLink      RequestOutcome = "link"
+	OutcomeTooLarge  RequestOutcome = "too_large"
+	OutcomeFailed    RequestOutcome = "failed"
+)
+
+// Request is the latest outcome of a user asking for a video format
+type Request struct {
+	ID      int64
+	UserID  int64
+	ChatID  int64
+	VideoID string
+	Mime    string
+	Quality string
+	Outcome RequestOutcome
+	// Title is read from the video metadata, it is empty when the video was never fetched
+	Title     string
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
+
+// UnavailableReason is why youtube refuses to serve a video
+type UnavailableReason string
+
+const (
+	ReasonPrivate       UnavailableReason = "private"
+	ReasonRemoved       UnavailableReason = "removed"
+	ReasonMembersOnly   UnavailableReason = "members_only"
+	ReasonRegionBlocked UnavailableReason = "region_blocked"
+	ReasonAgeRestricted UnavailableReason = "age_restricted"
+	ReasonUnavailable   UnavailableReason = "unavailable"
+)
+
+// Unavailable is a negative metadata entry: a video youtube refused to serve, remembered until ExpiresAt
+type Unavailable struct {
+	VideoID string
+	Reason  UnavailableReason
+	// Details is the reason youtube gave
+	Details   string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
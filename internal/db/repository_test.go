@@ -0,0 +1,70 @@
+package db_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/robotomize/cribe/internal/db"
+	"github.com/robotomize/cribe/internal/db/dbtest"
+	"github.com/sethvargo/go-envconfig"
+)
+
+// TestRepositories runs the conformance suite against the Postgres configured by the DB_* variables,
+// it truncates every table so it only runs when DB_TEST_POSTGRES is set
+func TestRepositories(t *testing.T) {
+	database := testDB(t)
+
+	dbtest.TestRepositories(t, func(t *testing.T) db.Repositories {
+		truncate(t, database)
+
+		return db.NewRepositories(database)
+	})
+}
+
+// testDB connects to the migrated Postgres configured by the DB_* variables, the test is skipped
+// when DB_TEST_POSTGRES is not set
+func testDB(tb testing.TB) *db.DB {
+	tb.Helper()
+
+	cfg := testConfig(tb)
+	if err := db.MigrateUp(&cfg); err != nil {
+		tb.Fatalf("migrate: %v", err)
+	}
+
+	database, err := db.New(&cfg)
+	if err != nil {
+		tb.Fatalf("setup db: %v", err)
+	}
+
+	tb.Cleanup(database.Close)
+
+	return database
+}
+
+// testConfig returns the config of the Postgres under test, the test is skipped when DB_TEST_POSTGRES is not set
+func testConfig(tb testing.TB) db.Config {
+	tb.Helper()
+
+	if os.Getenv("DB_TEST_POSTGRES") == "" {
+		tb.Skip("DB_TEST_POSTGRES is not set")
+	}
+
+	var cfg db.Config
+	if err := envconfig.Process(context.Background(), &cfg); err != nil {
+		tb.Fatalf("env processing: %v", err)
+	}
+
+	return cfg
+}
+
+func truncate(tb testing.TB, database *db.DB) {
+	tb.Helper()
+
+	if _, err := database.Pool.Exec(
+		context.Background(),
+		`TRUNCATE metadata, metadata_archive, users, chats, requests, unavailable_videos RESTART IDENTITY`,
+	); err != nil {
+		tb.Fatalf("truncate: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func NewRequestRepository(DB *DB) *RequestRepository {
+	return &RequestRepository{DB: DB}
+}
+
+// RequestRepository keeps the download history of users
+type RequestRepository struct {
+	*DB
+}
+
+func (r *RequestRepository) FetchByID(ctx context.Context, id int64) (Request, error) {
+	rows, err := r.Pool.Query(ctx, `
+		SELECT
+			r.id, r.user_id, r.chat_id, r.video_id, r.mime, r.quality, r.outcome,
+			COALESCE(m.params ->> 'title', ''), r.created_at, r.updated_at
+		FROM
+			requests r
+			LEFT JOIN metadata m ON m.video_id = r.video_id AND m.mime = r.mime AND m.quality = r.quality
+		WHERE r.id = $1
+	`, id)
+	if err != nil {
+		return Request{}, fmt.Errorf("fetch request: query: %w", err)
+	}
+
+	models, err := scanRequests(rows)
+	if err != nil {
+		return Request{}, fmt.Errorf("fetch request: %w", err)
+	}
+
+	if len(models) == 0 {
+		return Request{}, fmt.Errorf("fetch request: %w", ErrNotFound)
+	}
+
+	return models[0], nil
+}
+
+// ListByUser returns a page of the user history, the most recently updated requests first
+func (r *RequestRepository) ListByUser(ctx context.Context, userID int64, limit, offset int) ([]Request, error) {
+	rows, err := r.Pool.Query(ctx, `
+		SELECT
+			r.id, r.user_id, r.chat_id, r.video_id, r.mime, r.quality, r.outcome,
+			COALESCE(m.params ->> 'title', ''), r.created_at, r.updated_at
+		FROM
+			requests r
+			LEFT JOIN metadata m ON m.video_id = r.video_id AND m.mime = r.mime AND m.quality = r.quality
+		WHERE r.user_id = $1
+		ORDER BY r.updated_at DESC, r.id DESC
+		LIMIT $2 OFFSET $3
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("list requests: query: %w", err)
+	}
+
+	models, err := scanRequests(rows)
+	if err != nil {
+		return nil, fmt.Errorf("list requests: %w", err)
+	}
+
+	return models, nil
+}
+
+// Save records the outcome of the request, a repeated request of the same format updates the existing row.
+// An outcome without a format, such as a failure before the format was resolved, is kept in the row of the
+// video without a format and gives way to the first outcome of a format
+func (r *RequestRepository) Save(ctx context.Context, model Request) error {
+	var err error
+	if model.Mime == "" && model.Quality == "" {
+		_, err = r.Pool.Exec(
+			ctx, `INSERT
+				INTO requests (user_id, chat_id, video_id, mime, quality, outcome, created_at, updated_at)
+				VALUES ($1, $2, $3, '', '', $4, $5, $6)
+				ON CONFLICT (user_id, video_id, mime, quality)
+				DO UPDATE SET chat_id = EXCLUDED.chat_id, outcome = EXCLUDED.outcome, updated_at = EXCLUDED.updated_at`,
+			model.UserID, model.ChatID, model.VideoID, model.Outcome, model.CreatedAt, model.UpdatedAt,
+		)
+	} else {
+		_, err = r.Pool.Exec(
+			ctx, `WITH superseded AS (
+					DELETE FROM requests WHERE user_id = $1 AND video_id = $3 AND mime = '' AND quality = ''
+					RETURNING created_at
+				)
+				INSERT
+				INTO requests (user_id, chat_id, video_id, mime, quality, outcome, created_at, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6, COALESCE((SELECT MIN(created_at) FROM superseded), $7), $8)
+				ON CONFLICT (user_id, video_id, mime, quality)
+				DO UPDATE SET chat_id = EXCLUDED.chat_id, outcome = EXCLUDED.outcome, updated_at = EXCLUDED.updated_at`,
+			model.UserID, model.ChatID, model.VideoID, model.Mime, model.Quality, model.Outcome,
+			model.CreatedAt, model.UpdatedAt,
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("save request: %w", err)
+	}
+
+	return nil
+}
+
+func scanRequests(rows pgx.Rows) ([]Request, error) {
+	defer rows.Close()
+
+	var models []Request
+	for rows.Next() {
+		var model Request
+		if err := rows.Scan(
+			&model.ID, &model.UserID, &model.ChatID, &model.VideoID, &model.Mime, &model.Quality, &model.Outcome,
+			&model.Title, &model.CreatedAt, &model.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+
+		models = append(models, model)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+
+	return models, nil
+}
@@ -0,0 +1,77 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/robotomize/cribe/pkg/botstate"
+)
+
+// TestPostgresSessions checks the postgres session backend against the sessions table of the migrations
+func TestPostgresSessions(t *testing.T) {
+	database := testDB(t)
+	ctx := context.Background()
+	if _, err := database.Pool.Exec(ctx, `TRUNCATE sessions`); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+
+	backend := botstate.NewPostgres(database.Pool, botstate.PostgresConfig{Expiration: time.Hour})
+	defer backend.Close()
+
+	if _, err := backend.Get(ctx, "1"); !errors.Is(err, botstate.ErrSessionNotFound) {
+		t.Fatalf("get of a missing session got: %v, expected: %v", err, botstate.ErrSessionNotFound)
+	}
+
+	version, err := backend.CompareAndSet(ctx, "1", []byte("first"), 0)
+	if err != nil || version != 1 {
+		t.Fatalf("compare and set of a new session got: %d %v, expected: 1", version, err)
+	}
+
+	if _, err = backend.CompareAndSet(ctx, "1", []byte("stale"), 0); !errors.Is(err, botstate.ErrSessionConflict) {
+		t.Errorf("compare and set of a stale version got: %v, expected: %v", err, botstate.ErrSessionConflict)
+	}
+
+	if err = backend.Set(ctx, "1", []byte("second")); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	v, version, err := backend.GetVersioned(ctx, "1")
+	if err != nil || string(v) != "second" || version != 2 {
+		t.Fatalf("get versioned got: %q %d %v, expected: %q 2", v, version, err, "second")
+	}
+
+	if version, err = backend.CompareAndSet(ctx, "1", []byte("third"), version); err != nil || version != 3 {
+		t.Errorf("compare and set got: %d %v, expected: 3", version, err)
+	}
+
+	if err = backend.Delete(ctx, "1"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if _, err = backend.Get(ctx, "1"); !errors.Is(err, botstate.ErrSessionNotFound) {
+		t.Errorf("get of a deleted session got: %v, expected: %v", err, botstate.ErrSessionNotFound)
+	}
+
+	expiring := botstate.NewPostgres(database.Pool, botstate.PostgresConfig{Expiration: time.Millisecond})
+	defer expiring.Close()
+
+	if err = expiring.Set(ctx, "2", []byte("state")); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if _, err = expiring.Get(ctx, "2"); !errors.Is(err, botstate.ErrSessionNotFound) {
+		t.Errorf("get of an expired session got: %v, expected: %v", err, botstate.ErrSessionNotFound)
+	}
+
+	// an expired session is replaced as a missing one
+	if version, err = expiring.CompareAndSet(ctx, "2", []byte("new"), 0); err != nil || version != 1 {
+		t.Errorf("compare and set of an expired session got: %d %v, expected: 1", version, err)
+	}
+
+	if err = expiring.DeleteExpired(ctx); err != nil {
+		t.Errorf("delete expired: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// MetadataStore keeps video metadata by format, it is what the metadata cache reads through to
+type MetadataStore interface {
+	FetchByMetadata(ctx context.Context, videoID string, mime string, quality string) (Metadata, error)
+	// FetchByKeys returns the stored formats of the keys in their order, missing ones are skipped
+	FetchByKeys(ctx context.Context, keys []MetadataKey) ([]Metadata, error)
+	Save(ctx context.Context, model Metadata) error
+	// SaveBatch saves all models or none of them
+	SaveBatch(ctx context.Context, models []Metadata) error
+	Delete(ctx context.Context, videoID string, mime string, quality string) error
+	Touch(ctx context.Context, videoID string, mime string, quality string, at time.Time) error
+}
+
+// MetadataCatalog is a MetadataStore that also lists, searches and purges the stored metadata
+type MetadataCatalog interface {
+	MetadataStore
+	FetchByVideoID(ctx context.Context, videoID string) ([]Metadata, error)
+	List(ctx context.Context, limit, offset int) ([]Metadata, error)
+	Search(ctx context.Context, query string, limit, offset int) ([]Metadata, error)
+	MostRequested(ctx context.Context, limit int) ([]Metadata, error)
+	// PurgeUnused removes the formats unused since before and returns their keys, their stored objects are
+	// left to the caller
+	PurgeUnused(ctx context.Context, before time.Time, archive bool) ([]MetadataKey, error)
+	// ExtendLink records a download link to the stored object valid until at, a link expiring later is kept
+	ExtendLink(ctx context.Context, videoID string, mime string, quality string, at time.Time) error
+}
+
+type UserStore interface {
+	FetchByID(ctx context.Context, id int64) (User, error)
+	Upsert(ctx context.Context, model User) error
+	SetBlocked(ctx context.Context, id int64, blocked bool) error
+}
+
+type ChatStore interface {
+	FetchByID(ctx context.Context, id int64) (Chat, error)
+	Upsert(ctx context.Context, model Chat) error
+	SetBlocked(ctx context.Context, id int64, blocked bool) error
+}
+
+type RequestStore interface {
+	FetchByID(ctx context.Context, id int64) (Request, error)
+	ListByUser(ctx context.Context, userID int64, limit, offset int) ([]Request, error)
+	// Save records the outcome of the request of a format. An outcome without a format is kept apart from the
+	// requests of the formats of the video and gives way to the first outcome of a format
+	Save(ctx context.Context, model Request) error
+}
+
+// UnavailableStore keeps the negative metadata entries, expired entries are never returned
+type UnavailableStore interface {
+	FetchByVideoID(ctx context.Context, videoID string) (Unavailable, error)
+	Save(ctx context.Context, model Unavailable) error
+	Delete(ctx context.Context, videoID string) error
+}
+
+// Repositories are the stores of the bot. Every backend provides all of them and passes the same
+// conformance suite, see the dbtest package
+type Repositories struct {
+	Metadata    MetadataCatalog
+	Users       UserStore
+	Chats       ChatStore
+	Requests    RequestStore
+	Unavailable UnavailableStore
+}
+
+// NewRepositories returns the repositories backed by Postgres
+func NewRepositories(DB *DB) Repositories {
+	return Repositories{
+		Metadata:    NewMetadataRepository(DB),
+		Users:       NewUserRepository(DB),
+		Chats:       NewChatRepository(DB),
+		Requests:    NewRequestRepository(DB),
+		Unavailable: NewUnavailableRepository(DB),
+	}
+}
+
+var (
+	_ MetadataCatalog  = (*MetadataRepository)(nil)
+	_ UserStore        = (*UserRepository)(nil)
+	_ ChatStore        = (*ChatRepository)(nil)
+	_ RequestStore     = (*RequestRepository)(nil)
+	_ UnavailableStore = (*UnavailableRepository)(nil)
+)
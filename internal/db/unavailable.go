@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func NewUnavailableRepository(DB *DB) *UnavailableRepository {
+	return &UnavailableRepository{DB: DB}
+}
+
+// UnavailableRepository keeps the videos youtube refused to serve
+type UnavailableRepository struct {
+	*DB
+}
+
+// FetchByVideoID returns the entry of the video, ErrNotFound is returned for an expired one
+func (u *UnavailableRepository) FetchByVideoID(ctx context.Context, videoID string) (Unavailable, error) {
+	var model Unavailable
+	row := u.Pool.QueryRow(ctx, `
+		SELECT
+			video_id, reason, details, created_at, expires_at
+		FROM
+			unavailable_videos
+		WHERE video_id = $1 AND expires_at > NOW()
+	`, videoID)
+	if err := row.Scan(
+		&model.VideoID, &model.Reason, &model.Details, &model.CreatedAt, &model.ExpiresAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model, fmt.Errorf("fetch unavailable video: %w", ErrNotFound)
+		}
+
+		return model, fmt.Errorf("fetch unavailable video: %w", err)
+	}
+
+	return model, nil
+}
+
+// Save inserts the entry or replaces the one of the video
+func (u *UnavailableRepository) Save(ctx context.Context, model Unavailable) error {
+	if _, err := u.Pool.Exec(
+		ctx, `INSERT
+				INTO unavailable_videos (video_id, reason, details, created_at, expires_at)
+				VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (video_id)
+				DO UPDATE SET reason = EXCLUDED.reason, details = EXCLUDED.details,
+					created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at`,
+		model.VideoID, model.Reason, model.Details, model.CreatedAt, model.ExpiresAt,
+	); err != nil {
+		return fmt.Errorf("save unavailable video: %w", err)
+	}
+
+	return nil
+}
+
+// Delete forgets the video, ErrNotFound is returned when there is no entry
+func (u *UnavailableRepository) Delete(ctx context.Context, videoID string) error {
+	result, err := u.Pool.Exec(ctx, `DELETE FROM unavailable_videos WHERE video_id = $1`, videoID)
+	if err != nil {
+		return fmt.Errorf("delete unavailable video: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("delete unavailable video: %w", ErrNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func NewUserRepository(DB *DB) *UserRepository {
+	return &UserRepository{DB: DB}
+}
+
+type UserRepository struct {
+	*DB
+}
+
+func (u *UserRepository) FetchByID(ctx context.Context, id int64) (User, error) {
+	var model User
+	row := u.Pool.QueryRow(ctx, `
+		SELECT
+			id, username, language_code, blocked, requests_count, first_seen_at, last_seen_at
+		FROM
+			users
+		WHERE id = $1
+	`, id)
+	if err := row.Scan(
+		&model.ID, &model.Username, &model.LanguageCode, &model.Blocked, &model.RequestsCount,
+		&model.FirstSeenAt, &model.LastSeenAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model, fmt.Errorf("fetch user: %w", ErrNotFound)
+		}
+
+		return model, fmt.Errorf("fetch user: %w", err)
+	}
+
+	return model, nil
+}
+
+// Upsert records a request of the user: the profile and last seen time are refreshed, the request counter
+// is incremented and the blocked flag is cleared, since the user is talking to the bot again
+func (u *UserRepository) Upsert(ctx context.Context, model User) error {
+	if _, err := u.Pool.Exec(
+		ctx, `INSERT
+				INTO users (id, username, language_code, blocked, requests_count, first_seen_at, last_seen_at)
+				VALUES ($1, $2, $3, FALSE, 1, $4, $4)
+				ON CONFLICT (id)
+				DO UPDATE SET username = EXCLUDED.username, language_code = EXCLUDED.language_code,
+					blocked = FALSE, requests_count = users.requests_count + 1, last_seen_at = EXCLUDED.last_seen_at`,
+		model.ID, model.Username, model.LanguageCode, model.LastSeenAt,
+	); err != nil {
+		return fmt.Errorf("upsert user: %w", err)
+	}
+
+	return nil
+}
+
+func (u *UserRepository) SetBlocked(ctx context.Context, id int64, blocked bool) error {
+	result, err := u.Pool.Exec(ctx, `UPDATE users SET blocked = $2 WHERE id = $1`, id, blocked)
+	if err != nil {
+		return fmt.Errorf("update user: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("update user: %w", ErrNoRowsUpd)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+// Package lru implements a size bounded least recently used cache
+package lru
+
+import (
+	"container/list"
+	"sync"
+)
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+	size  int64
+}
+
+// Option configures the cache
+type Option[K comparable, V any] func(*Cache[K, V])
+
+// WithSizeFunc sets how much of the capacity a value takes, every value takes 1 by default
+func WithSizeFunc[K comparable, V any](f func(V) int64) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.sizeOf = f
+	}
+}
+
+// WithEvictFunc sets the callback run for every value leaving the cache, it is called with the cache locked
+func WithEvictFunc[K comparable, V any](f func(K, V)) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.onEvict = f
+	}
+}
+
+// New returns a cache holding values up to the total size of capacity
+func New[K comparable, V any](capacity int64, opts ...Option[K, V]) *Cache[K, V] {
+	c := &Cache[K, V]{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[K]*list.Element),
+		sizeOf:   func(V) int64 { return 1 },
+	}
+
+	for _, o := range opts {
+		o(c)
+	}
+
+	return c
+}
+
+type Cache[K comparable, V any] struct {
+	mtx      sync.Mutex
+	capacity int64
+	size     int64
+	ll       *list.List
+	items    map[K]*list.Element
+	sizeOf   func(V) int64
+	onEvict  func(K, V)
+}
+
+// Get returns the value and marks it as recently used
+func (c *Cache[K, V]) Get(k K) (V, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if el, ok := c.items[k]; ok {
+		c.ll.MoveToFront(el)
+
+		return el.Value.(*entry[K, V]).value, true
+	}
+
+	var zero V
+
+	return zero, false
+}
+
+// Add stores the value evicting the least recently used ones to fit it.
+// It reports false when the value alone is larger than the capacity and was not stored
+func (c *Cache[K, V]) Add(k K, v V) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	size := c.sizeOf(v)
+	if size > c.capacity {
+		c.remove(k)
+
+		return false
+	}
+
+	if el, ok := c.items[k]; ok {
+		e := el.Value.(*entry[K, V])
+		c.size += size - e.size
+		e.value, e.size = v, size
+		c.ll.MoveToFront(el)
+	} else {
+		c.items[k] = c.ll.PushFront(&entry[K, V]{key: k, value: v, size: size})
+		c.size += size
+	}
+
+	for c.size > c.capacity {
+		c.removeElement(c.ll.Back())
+	}
+
+	return true
+}
+
+// Remove drops the value, the evict callback is run for it
+func (c *Cache[K, V]) Remove(k K) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.remove(k)
+}
+
+// Len returns the number of cached values
+func (c *Cache[K, V]) Len() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.ll.Len()
+}
+
+// Capacity returns the total size the cache holds at most
+func (c *Cache[K, V]) Capacity() int64 {
+	return c.capacity
+}
+
+// Size returns the total size of cached values
+func (c *Cache[K, V]) Size() int64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.size
+}
+
+func (c *Cache[K, V]) remove(k K) {
+	if el, ok := c.items[k]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *Cache[K, V]) removeElement(el *list.Element) {
+	e := c.ll.Remove(el).(*entry[K, V])
+	delete(c.items, e.key)
+	c.size -= e.size
+	if c.onEvict != nil {
+		c.onEvict(e.key, e.value)
+	}
+}
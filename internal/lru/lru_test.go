@@ -0,0 +1,62 @@
+package lru
+
+import (
+	"testing"
+)
+
+func TestCache_Eviction(t *testing.T) {
+	t.Parallel()
+
+	var evicted []string
+	c := New[string, int](3, WithEvictFunc[string, int](func(k string, _ int) { evicted = append(evicted, k) }))
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Add("c", 3)
+
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+
+	c.Add("d", 4)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected least recently used b to be evicted")
+	}
+
+	if got, want := c.Len(), 3; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Errorf("expected evicted %v to be [b]", evicted)
+	}
+}
+
+func TestCache_Size(t *testing.T) {
+	t.Parallel()
+
+	c := New[string, []byte](10, WithSizeFunc[string, []byte](func(v []byte) int64 { return int64(len(v)) }))
+
+	if !c.Add("a", make([]byte, 4)) || !c.Add("b", make([]byte, 4)) {
+		t.Fatal("expected values to fit")
+	}
+
+	if c.Add("huge", make([]byte, 11)) {
+		t.Error("expected value larger than capacity to be rejected")
+	}
+
+	c.Add("a", make([]byte, 6))
+	if got, want := c.Size(), int64(10); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	c.Add("c", make([]byte, 1))
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+
+	c.Remove("a")
+	if got, want := c.Size(), int64(1); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+}
@@ -10,6 +10,33 @@ import (
 type RedisConfig struct {
 	Expiration time.Duration `env:"REDIS_EXPIRATION,default=86400s"`
 	Addr       string        `env:"REDIS_ADDR,default=localhost:6380"`
+	// Addrs are the Sentinel or Cluster nodes, REDIS_ADDR is used when they are empty
+	Addrs              []string      `env:"REDIS_ADDRS"`
+	MasterName         string        `env:"REDIS_SENTINEL_MASTER"`
+	SentinelPassword   string        `env:"REDIS_SENTINEL_PASSWORD"`
+	Cluster            bool          `env:"REDIS_CLUSTER,default=false"`
+	Username           string        `env:"REDIS_USERNAME"`
+	Password           string        `env:"REDIS_PASSWORD"`
+	DB                 int           `env:"REDIS_DB,default=0"`
+	MaxRetries         int           `env:"REDIS_MAX_RETRIES"`
+	MinRetryBackoff    time.Duration `env:"REDIS_MIN_RETRY_BACKOFF"`
+	MaxRetryBackoff    time.Duration `env:"REDIS_MAX_RETRY_BACKOFF"`
+	DialTimeout        time.Duration `env:"REDIS_DIAL_TIMEOUT"`
+	ReadTimeout        time.Duration `env:"REDIS_READ_TIMEOUT"`
+	WriteTimeout       time.Duration `env:"REDIS_WRITE_TIMEOUT"`
+	PoolSize           int           `env:"REDIS_POOL_SIZE"`
+	MinIdleConns       int           `env:"REDIS_MIN_IDLE_CONNS"`
+	MaxConnAge         time.Duration `env:"REDIS_MAX_CONN_AGE"`
+	PoolTimeout        time.Duration `env:"REDIS_POOL_TIMEOUT"`
+	IdleTimeout        time.Duration `env:"REDIS_IDLE_TIMEOUT"`
+	IdleCheckFrequency time.Duration `env:"REDIS_IDLE_CHECK_FREQUENCY"`
+	MaxRedirects       int           `env:"REDIS_CLUSTER_MAX_REDIRECTS"`
+	ReadOnly           bool          `env:"REDIS_CLUSTER_READ_ONLY,default=false"`
+	RouteByLatency     bool          `env:"REDIS_CLUSTER_ROUTE_BY_LATENCY,default=false"`
+	RouteRandomly      bool          `env:"REDIS_CLUSTER_ROUTE_RANDOMLY,default=false"`
+	TLS                bool          `env:"REDIS_TLS,default=false"`
+	TLSServerName      string        `env:"REDIS_TLS_SERVER_NAME"`
+	TLSSkipVerify      bool          `env:"REDIS_TLS_SKIP_VERIFY,default=false"`
 }
 
 type TelegramConfig struct {
@@ -19,6 +46,10 @@ type TelegramConfig struct {
 	WebHookAddr    string `env:"TELEGRAM_WEBHOOK_ADDR"`
 	Token          string `env:"TELEGRAM_TOKEN"`
 	PollingTimeout int    `env:"TELEGRAM_POLLING_TIMEOUT,default=10"`
+	// MaxUploadSize is the largest video sent to telegram in bytes, 0 picks the limit of the api in use
+	MaxUploadSize int64 `env:"TELEGRAM_MAX_UPLOAD_SIZE"`
+	// AdminIDs are the users allowed to run the admin commands
+	AdminIDs []int64 `env:"TELEGRAM_ADMIN_IDS"`
 }
 
 type AMQPConfig struct {
@@ -27,20 +58,32 @@ type AMQPConfig struct {
 }
 
 type StorageConfig struct {
-	Type   string `env:"STORAGE_TYPE,default=fs"`
-	Bucket string `env:"UPLOAD_BUCKET_NAME,default=/tmp"`
-	S3     storage.S3Config
+	Type       string `env:"STORAGE_TYPE,default=fs"`
+	Bucket     string `env:"UPLOAD_BUCKET_NAME,default=/tmp"`
+	S3         storage.S3Config
+	Encryption storage.EncryptionConfig
+	SignedURL  storage.SignedURLConfig
+	Cache      storage.CacheConfig
 }
 
 type Config struct {
-	Addr                      string      `env:"ADDR,default=localhost:8080"`
-	LogLevel                  string      `env:"LOG_LEVEL,default=error"`
-	TelegramUpdatesMaxWorkers int         `env:"TELEGRAM_UPDATES_MAX_WORKERS,default=10"`
-	FetchingMaxWorkers        int         `env:"FETCHING_MAX_WORKERS,default=10"`
-	UploadingMaxWorkers       int         `env:"UPLOADING_MAX_WORKERS,default=5"`
-	HashingFunc               string      `env:"FILE_HASHING_FUNC,default=md5"`
-	SessionBackend            BackendType `env:"SESSION_BACKEND_TYPE,default=redis"`
+	Addr                      string        `env:"ADDR,default=localhost:8080"`
+	LogLevel                  string        `env:"LOG_LEVEL,default=error"`
+	TelegramUpdatesMaxWorkers int           `env:"TELEGRAM_UPDATES_MAX_WORKERS,default=10"`
+	TelegramUpdatesQueueSize  int           `env:"TELEGRAM_UPDATES_QUEUE_SIZE,default=100"`
+	FetchingMaxWorkers        int           `env:"FETCHING_MAX_WORKERS,default=10"`
+	UploadingMaxWorkers       int           `env:"UPLOADING_MAX_WORKERS,default=5"`
+	HashingFunc               string        `env:"FILE_HASHING_FUNC,default=md5"`
+	SessionBackend            BackendType   `env:"SESSION_BACKEND_TYPE,default=redis"`
+	SessionExpiration         time.Duration `env:"SESSION_EXPIRATION,default=86400s"`
+	SessionMaxEntries         int           `env:"SESSION_MAX_ENTRIES,default=100000"`
+	SessionCleanupInterval    time.Duration `env:"SESSION_CLEANUP_INTERVAL,default=1m"`
+	SessionResetNotify        bool          `env:"SESSION_RESET_NOTIFY,default=true"`
+	UnavailableVideoTTL       time.Duration `env:"UNAVAILABLE_VIDEO_TTL,default=6h"`
+	MetadataRetentionDays     int           `env:"METADATA_RETENTION_DAYS,default=0"`
+	MetadataRetentionArchive  bool          `env:"METADATA_RETENTION_ARCHIVE,default=true"`
 	DB                        db.Config
+	MetadataCache             db.CacheConfig
 	Redis                     RedisConfig
 	Telegram                  TelegramConfig
 	RabbitMQ                  AMQPConfig
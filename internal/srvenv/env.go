@@ -1,6 +1,10 @@
 package srvenv
 
 import (
+	"errors"
+	"net/http"
+
+	"github.com/go-redis/redis/v8"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 	"github.com/robotomize/cribe/internal/db"
 	"github.com/robotomize/cribe/internal/storage"
@@ -10,20 +14,36 @@ import (
 type Env struct {
 	config         Config
 	db             *db.DB
+	repositories   db.Repositories
+	redis          redis.UniversalClient
 	sessionBackend SessionBackend
 	telegram       *tgbotapi.BotAPI
 	rabbitMQ       *amqp.Connection
 	blob           storage.Blob
+	signer         storage.URLSigner
+	downloads      http.Handler
+	closers        []func() error
 }
 
 func (e Env) Config() Config {
 	return e.config
 }
 
+// DB returns the Postgres pool, nil when the repositories are embedded
 func (e Env) DB() *db.DB {
 	return e.db
 }
 
+// Repositories returns the stores of the backend selected by DB_TYPE
+func (e Env) Repositories() db.Repositories {
+	return e.repositories
+}
+
+// Redis returns the client of the shared metadata cache tier, nil when the tier is off
+func (e Env) Redis() redis.UniversalClient {
+	return e.redis
+}
+
 func (e Env) Blob() storage.Blob {
 	return e.blob
 }
@@ -39,3 +59,31 @@ func (e Env) AMQP() *amqp.Connection {
 func (e Env) Telegram() *tgbotapi.BotAPI {
 	return e.telegram
 }
+
+// URLSigner returns the signer of download links, nil when links are not configured
+func (e Env) URLSigner() storage.URLSigner {
+	return e.signer
+}
+
+// Downloads returns the handler serving signed links under storage.DownloadPath, nil when links
+// are presigned by the storage itself or not configured
+func (e Env) Downloads() http.Handler {
+	return e.downloads
+}
+
+// Close releases the connections and stops the background workers opened by Setup, in reverse order
+func (e *Env) Close() error {
+	var errs []error
+	for i := len(e.closers) - 1; i >= 0; i-- {
+		if err := e.closers[i](); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	e.closers = nil
+
+	return errors.Join(errs...)
+}
+
+func (e *Env) onClose(fn func() error) {
+	e.closers = append(e.closers, fn)
+}
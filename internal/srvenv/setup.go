@@ -2,12 +2,14 @@ package srvenv
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net/http"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 	_ "github.com/lib/pq"
 	"github.com/robotomize/cribe/internal/db"
+	"github.com/robotomize/cribe/internal/db/embedded"
 	"github.com/robotomize/cribe/internal/storage"
 	"github.com/robotomize/cribe/pkg/botstate"
 	"github.com/sethvargo/go-envconfig"
@@ -18,26 +20,28 @@ type SessionBackend interface {
 	Get(ctx context.Context, k string) ([]byte, error)
 	Set(ctx context.Context, k string, v []byte) error
 	Delete(ctx context.Context, k string) error
+	GetVersioned(ctx context.Context, k string) ([]byte, int64, error)
+	CompareAndSet(ctx context.Context, k string, v []byte, version int64) (int64, error)
+	Close() error
 }
 
 type BackendType string
 
-func Setup(ctx context.Context) (*Env, error) {
+func Setup(ctx context.Context) (_ *Env, err error) {
 	var env Env
 	var cfg Config
 
+	defer func() {
+		if err != nil {
+			_ = env.Close()
+		}
+	}()
+
 	if err := envconfig.Process(ctx, &cfg); err != nil {
 		return nil, fmt.Errorf("env processing: %w", err)
 	}
 	env.config = cfg
 
-	sessionBackend, err := ProvideSessionBackendFor(cfg)
-	if err != nil {
-		return nil, fmt.Errorf("setup session backend: %w", err)
-	}
-
-	env.sessionBackend = sessionBackend
-
 	telegram, err := SetupTelegram(cfg.Telegram)
 	if err != nil {
 		return nil, fmt.Errorf("setup telegram client: %w", err)
@@ -48,24 +52,87 @@ func Setup(ctx context.Context) (*Env, error) {
 		return nil, fmt.Errorf("setup rabbitmq connection: %w", err)
 	}
 
+	env.rabbitMQ = rabbitMQConn
+	env.onClose(rabbitMQConn.Close)
+
 	blob, err := ProvideStorageFor(ctx, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("setup storage: %w", err)
 	}
 
-	database, err := db.New(&cfg.DB)
+	signer, downloads, err := ProvideSignerFor(cfg, blob)
 	if err != nil {
+		return nil, fmt.Errorf("setup download links: %w", err)
+	}
+
+	env.signer = signer
+	env.downloads = downloads
+
+	if err = ProvideRepositoriesFor(cfg, &env); err != nil {
 		return nil, fmt.Errorf("setup db: %w", err)
 	}
 
-	env.db = database
+	// the postgres session backend shares the pool of the repositories
+	sessionBackend, err := ProvideSessionBackendFor(cfg, env.db)
+	if err != nil {
+		return nil, fmt.Errorf("setup session backend: %w", err)
+	}
+
+	env.sessionBackend = sessionBackend
+	env.onClose(sessionBackend.Close)
+
+	if cfg.MetadataCache.Redis {
+		client := botstate.NewRedisClient(redisConfig(cfg.Redis))
+		env.onClose(client.Close)
+		if err = client.Ping(ctx).Err(); err != nil {
+			return nil, fmt.Errorf("setup metadata cache redis: %w", err)
+		}
+
+		env.redis = client
+	}
+
 	env.blob = blob
 	env.telegram = telegram
-	env.rabbitMQ = rabbitMQConn
 
 	return &env, nil
 }
 
+// ProvideRepositoriesFor opens the backend of the repositories, Postgres is migrated first when asked to
+func ProvideRepositoriesFor(cfg Config, env *Env) error {
+	switch cfg.DB.Type {
+	case db.TypePostgres:
+		if cfg.DB.AutoMigrate {
+			if err := db.MigrateUp(&cfg.DB); err != nil {
+				return fmt.Errorf("migrate db: %w", err)
+			}
+		}
+
+		database, err := db.New(&cfg.DB)
+		if err != nil {
+			return fmt.Errorf("new postgres db: %w", err)
+		}
+
+		env.db = database
+		env.repositories = db.NewRepositories(database)
+		env.onClose(func() error {
+			database.Close()
+			return nil
+		})
+	case db.TypeEmbedded:
+		database, err := embedded.Open(cfg.DB.Path)
+		if err != nil {
+			return fmt.Errorf("new embedded db: %w", err)
+		}
+
+		env.repositories = embedded.NewRepositories(database)
+		env.onClose(database.Close)
+	default:
+		return fmt.Errorf("unknown db type %q", cfg.DB.Type)
+	}
+
+	return nil
+}
+
 const (
 	StorageTypeFS = "fs"
 	StorageTypeS3 = "s3"
@@ -86,37 +153,129 @@ func ProvideStorageFor(ctx context.Context, cfg Config) (storage.Blob, error) {
 			return nil, fmt.Errorf("new S3 storage: %w", err)
 		}
 		blob = s3
+
+		if cfg.Storage.Cache.Dir != "" {
+			tiered, err := storage.NewTiered(s3, cfg.Storage.Cache)
+			if err != nil {
+				return nil, fmt.Errorf("new tiered storage: %w", err)
+			}
+			blob = tiered
+		}
+	}
+
+	if cfg.Storage.Encryption.KeyID != "" {
+		encrypted, err := storage.NewEncrypted(blob, cfg.Storage.Encryption)
+		if err != nil {
+			return nil, fmt.Errorf("new encrypted storage: %w", err)
+		}
+		blob = encrypted
 	}
 
 	return blob, nil
 }
 
+// ProvideSignerFor returns the signer of download links for oversized videos. S3 objects stored as
+// is are presigned by S3, everything else is served by the returned handler behind an HMAC signature
+func ProvideSignerFor(cfg Config, blob storage.Blob) (storage.URLSigner, http.Handler, error) {
+	if tiered, ok := blob.(*storage.Tiered); ok {
+		blob = tiered.Remote()
+	}
+
+	if s3, ok := blob.(*storage.S3); ok {
+		return s3, nil, nil
+	}
+
+	if cfg.Storage.SignedURL.BaseURL == "" {
+		return nil, nil, nil
+	}
+
+	signer, err := storage.NewHMACSigner(cfg.Storage.SignedURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("new hmac signer: %w", err)
+	}
+
+	return signer, storage.DownloadHandler(blob, cfg.Storage.Bucket, signer), nil
+}
+
 const (
 	BackendTypeRedis    BackendType = "redis"
 	BackendTypeInMemory BackendType = "in_memory"
+	BackendTypePostgres BackendType = "postgres"
 )
 
-func ProvideSessionBackendFor(cfg Config) (SessionBackend, error) {
+// ProvideSessionBackendFor returns the session backend selected by SESSION_BACKEND_TYPE, the postgres one needs
+// the Postgres repositories
+func ProvideSessionBackendFor(cfg Config, database *db.DB) (SessionBackend, error) {
 	var backend SessionBackend
 	switch cfg.SessionBackend {
 	case BackendTypeRedis:
-		redis, err := botstate.NewRedis(
-			botstate.RedisConfig{
-				Expiration: cfg.Redis.Expiration,
-				Addr:       cfg.Redis.Addr,
-			},
-		)
+		redis, err := botstate.NewRedis(redisConfig(cfg.Redis))
 		if err != nil {
 			return nil, fmt.Errorf("create redis session backend: %w", err)
 		}
 		backend = redis
 	case BackendTypeInMemory:
-		backend = botstate.NewInMemoryBackend()
+		backend = botstate.NewInMemoryBackend(botstate.InMemoryConfig{
+			Expiration:      cfg.SessionExpiration,
+			MaxEntries:      cfg.SessionMaxEntries,
+			CleanupInterval: cfg.SessionCleanupInterval,
+		})
+	case BackendTypePostgres:
+		if database == nil {
+			return nil, fmt.Errorf("postgres session backend needs DB_TYPE=%s", db.TypePostgres)
+		}
+
+		backend = botstate.NewPostgres(database.Pool, botstate.PostgresConfig{
+			Expiration:      cfg.SessionExpiration,
+			CleanupInterval: cfg.SessionCleanupInterval,
+		})
+	default:
+		return nil, fmt.Errorf("unknown session backend type %q", cfg.SessionBackend)
 	}
 
 	return backend, nil
 }
 
+func redisConfig(cfg RedisConfig) botstate.RedisConfig {
+	config := botstate.RedisConfig{
+		Expiration:         cfg.Expiration,
+		Addr:               cfg.Addr,
+		Addrs:              cfg.Addrs,
+		MasterName:         cfg.MasterName,
+		SentinelPassword:   cfg.SentinelPassword,
+		Cluster:            cfg.Cluster,
+		Username:           cfg.Username,
+		Password:           cfg.Password,
+		DB:                 cfg.DB,
+		MaxRetries:         cfg.MaxRetries,
+		MinRetryBackoff:    cfg.MinRetryBackoff,
+		MaxRetryBackoff:    cfg.MaxRetryBackoff,
+		DialTimeout:        cfg.DialTimeout,
+		ReadTimeout:        cfg.ReadTimeout,
+		WriteTimeout:       cfg.WriteTimeout,
+		PoolSize:           cfg.PoolSize,
+		MinIdleConns:       cfg.MinIdleConns,
+		MaxConnAge:         cfg.MaxConnAge,
+		PoolTimeout:        cfg.PoolTimeout,
+		IdleTimeout:        cfg.IdleTimeout,
+		IdleCheckFrequency: cfg.IdleCheckFrequency,
+		MaxRedirects:       cfg.MaxRedirects,
+		ReadOnly:           cfg.ReadOnly,
+		RouteByLatency:     cfg.RouteByLatency,
+		RouteRandomly:      cfg.RouteRandomly,
+	}
+
+	if cfg.TLS {
+		config.TLSConfig = &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			ServerName:         cfg.TLSServerName,
+			InsecureSkipVerify: cfg.TLSSkipVerify, // nolint
+		}
+	}
+
+	return config
+}
+
 func SetupAMQP(cfg AMQPConfig) (*amqp.Connection, error) {
 	conn, err := amqp.DialConfig(
 		cfg.ConnectionURL, amqp.Config{
@@ -1,7 +1,36 @@
 package storage
 
+import "time"
+
 type S3Config struct {
 	Region   string `env:"S3_REGION,default=eu-west-3"`
 	AccessID string `env:"S3_ACCESS_ID"`
 	Secret   string `env:"S3_SECRET_KEY"`
 }
+
+type EncryptionConfig struct {
+	// KeyID selects the key new objects are encrypted with, encryption is off when empty
+	KeyID string `env:"STORAGE_ENCRYPTION_KEY_ID"`
+	// Keys maps key IDs to base64 encoded AES keys, e.g. "2021-10:base64,2021-11:base64"
+	Keys map[string]string `env:"STORAGE_ENCRYPTION_KEYS" json:"-"`
+	// AllowPlaintext serves the objects stored before encryption was turned on as they are, otherwise they are
+	// reported missing and fetched again
+	AllowPlaintext bool `env:"STORAGE_ENCRYPTION_ALLOW_PLAINTEXT,default=false"`
+}
+
+type SignedURLConfig struct {
+	// BaseURL is the public address of cribe's http server, links to the FS backend are served there
+	BaseURL string `env:"DOWNLOAD_BASE_URL"`
+	// Secret signs download links served by cribe itself
+	Secret string `env:"DOWNLOAD_SIGNING_SECRET" json:"-"`
+	// TTL is how long oversized videos stay in storage and their links stay valid
+	TTL time.Duration `env:"DOWNLOAD_LINK_TTL,default=24h"`
+	// MaxSize is the largest video shared with a link in bytes, it is read into memory whole
+	MaxSize int64 `env:"DOWNLOAD_MAX_SIZE,default=4294967296"`
+}
+
+type CacheConfig struct {
+	// Dir enables the local disk cache in front of S3
+	Dir      string `env:"STORAGE_CACHE_DIR"`
+	MaxBytes int64  `env:"STORAGE_CACHE_MAX_BYTES,default=10737418240"`
+}
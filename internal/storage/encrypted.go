@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrUnknownKey       = errors.New("unknown encryption key")
+	ErrMalformedContent = errors.New("malformed encrypted content")
+)
+
+const (
+	encryptedMagic   = "CRBE"
+	encryptedVersion = 1
+	// EncryptedChunkSize is the plaintext size of every sealed chunk except the last one
+	EncryptedChunkSize = 64 * 1024
+	noncePrefixSize    = 7
+)
+
+var _ Blob = (*Encrypted)(nil)
+
+// NewEncrypted wraps the blob storage with AES-GCM encryption.
+// Objects are sealed with the key cfg.KeyID, any key of cfg.Keys can be used to open them
+func NewEncrypted(blob Blob, cfg EncryptionConfig) (*Encrypted, error) {
+	if len(cfg.KeyID) == 0 || len(cfg.KeyID) > 255 {
+		return nil, fmt.Errorf("invalid encryption key id %q", cfg.KeyID)
+	}
+
+	keys := make(map[string]cipher.AEAD, len(cfg.Keys))
+	for id, encoded := range cfg.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("decode key %q: %w", id, err)
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+
+		keys[id] = aead
+	}
+
+	if _, ok := keys[cfg.KeyID]; !ok {
+		return nil, fmt.Errorf("active key %q: %w", cfg.KeyID, ErrUnknownKey)
+	}
+
+	return &Encrypted{blob: blob, keyID: cfg.KeyID, keys: keys, allowPlaintext: cfg.AllowPlaintext}, nil
+}
+
+// Encrypted is a Blob decorator storing objects as a header followed by AES-GCM sealed chunks.
+//
+// The header holds the magic, the format version, the key ID and a random nonce prefix.
+// Every chunk nonce is the prefix, the chunk counter and a last chunk flag, and the header is
+// authenticated with every chunk, so reordered, truncated or re-keyed content fails to open
+type Encrypted struct {
+	blob           Blob
+	keyID          string
+	keys           map[string]cipher.AEAD
+	allowPlaintext bool
+}
+
+func (e *Encrypted) CreateObject(ctx context.Context, bucket, key string, contents []byte) error {
+	var buf bytes.Buffer
+	if err := e.Encrypt(&buf, bytes.NewReader(contents)); err != nil {
+		return fmt.Errorf("encrypt object: %w", err)
+	}
+
+	return e.blob.CreateObject(ctx, bucket, key, buf.Bytes())
+}
+
+func (e *Encrypted) DeleteObject(ctx context.Context, bucket, key string) error {
+	return e.blob.DeleteObject(ctx, bucket, key)
+}
+
+func (e *Encrypted) GetObject(ctx context.Context, bucket, key string) ([]byte, error) {
+	sealed, err := e.blob.GetObject(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// an object stored before encryption was turned on has no header
+	if !bytes.HasPrefix(sealed, []byte(encryptedMagic)) {
+		if e.allowPlaintext {
+			return sealed, nil
+		}
+
+		return nil, fmt.Errorf("plaintext object %s: %w", key, ErrNotFound)
+	}
+
+	var buf bytes.Buffer
+	if err = e.Decrypt(&buf, bytes.NewReader(sealed)); err != nil {
+		return nil, fmt.Errorf("decrypt object: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Encrypt reads src in chunks and writes the sealed stream to dst with the active key
+func (e *Encrypted) Encrypt(dst io.Writer, src io.Reader) error {
+	aead := e.keys[e.keyID]
+
+	header := make([]byte, 0, len(encryptedMagic)+2+len(e.keyID)+noncePrefixSize)
+	header = append(header, encryptedMagic...)
+	header = append(header, encryptedVersion, byte(len(e.keyID)))
+	header = append(header, e.keyID...)
+
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return fmt.Errorf("generate nonce prefix: %w", err)
+	}
+
+	header = append(header, prefix...)
+	if _, err := dst.Write(header); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+
+	// read one byte ahead so the last chunk is known before it is sealed
+	plain := make([]byte, EncryptedChunkSize+1)
+	sealed := make([]byte, 0, EncryptedChunkSize+aead.Overhead())
+	n, err := io.ReadFull(src, plain)
+	for counter := uint32(0); ; counter++ {
+		last := false
+		switch {
+		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			last = true
+		case err != nil:
+			return fmt.Errorf("read plaintext: %w", err)
+		default:
+			n = EncryptedChunkSize
+		}
+
+		sealed = aead.Seal(sealed[:0], chunkNonce(prefix, counter, last), plain[:n], header)
+		if _, err = dst.Write(sealed); err != nil {
+			return fmt.Errorf("write chunk: %w", err)
+		}
+
+		if last {
+			return nil
+		}
+
+		if counter == ^uint32(0) {
+			return fmt.Errorf("plaintext too large")
+		}
+
+		plain[0] = plain[EncryptedChunkSize]
+		n, err = io.ReadFull(src, plain[1:])
+		n++
+	}
+}
+
+// Decrypt opens the sealed stream from src chunk by chunk and writes the plaintext to dst
+func (e *Encrypted) Decrypt(dst io.Writer, src io.Reader) error {
+	fixed := make([]byte, len(encryptedMagic)+2)
+	if _, err := io.ReadFull(src, fixed); err != nil {
+		return ErrMalformedContent
+	}
+
+	if string(fixed[:len(encryptedMagic)]) != encryptedMagic || fixed[len(encryptedMagic)] != encryptedVersion {
+		return ErrMalformedContent
+	}
+
+	rest := make([]byte, int(fixed[len(encryptedMagic)+1])+noncePrefixSize)
+	if _, err := io.ReadFull(src, rest); err != nil {
+		return ErrMalformedContent
+	}
+
+	header := append(fixed, rest...)
+	keyID := string(rest[:len(rest)-noncePrefixSize])
+	prefix := rest[len(rest)-noncePrefixSize:]
+
+	aead, ok := e.keys[keyID]
+	if !ok {
+		return fmt.Errorf("key %q: %w", keyID, ErrUnknownKey)
+	}
+
+	chunkSize := EncryptedChunkSize + aead.Overhead()
+	sealed := make([]byte, chunkSize+1)
+	plain := make([]byte, 0, EncryptedChunkSize)
+	n, err := io.ReadFull(src, sealed)
+	for counter := uint32(0); ; counter++ {
+		last := false
+		switch {
+		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			last = true
+		case err != nil:
+			return fmt.Errorf("read chunk: %w", err)
+		default:
+			n = chunkSize
+		}
+
+		plain, err = aead.Open(plain[:0], chunkNonce(prefix, counter, last), sealed[:n], header)
+		if err != nil {
+			return ErrMalformedContent
+		}
+
+		if _, err = dst.Write(plain); err != nil {
+			return fmt.Errorf("write plaintext: %w", err)
+		}
+
+		if last {
+			return nil
+		}
+
+		sealed[0] = sealed[chunkSize]
+		n, err = io.ReadFull(src, sealed[1:])
+		n++
+	}
+}
+
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, noncePrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+
+	return nonce
+}
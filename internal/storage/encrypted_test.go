@@ -0,0 +1,349 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"testing"
+)
+
+type memoryBlob struct {
+	mtx     sync.Mutex
+	objects map[string][]byte
+}
+
+func newMemoryBlob() *memoryBlob {
+	return &memoryBlob{objects: make(map[string][]byte)}
+}
+
+func (m *memoryBlob) CreateObject(_ context.Context, bucket, key string, contents []byte) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.objects[bucket+"/"+key] = append([]byte(nil), contents...)
+
+	return nil
+}
+
+func (m *memoryBlob) DeleteObject(_ context.Context, bucket, key string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	delete(m.objects, bucket+"/"+key)
+
+	return nil
+}
+
+func (m *memoryBlob) GetObject(_ context.Context, bucket, key string) ([]byte, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	b, ok := m.objects[bucket+"/"+key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return append([]byte(nil), b...), nil
+}
+
+func newEncryptionKey(t testing.TB) string {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func randomBytes(t testing.TB, n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestEncrypted_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		size int
+	}{
+		{name: "empty", size: 0},
+		{name: "small", size: 11},
+		{name: "chunk", size: EncryptedChunkSize},
+		{name: "chunk_and_byte", size: EncryptedChunkSize + 1},
+		{name: "many_chunks", size: 3*EncryptedChunkSize + 17},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.TODO()
+			backend := newMemoryBlob()
+			blob, err := NewEncrypted(backend, EncryptionConfig{
+				KeyID: "k1",
+				Keys:  map[string]string{"k1": newEncryptionKey(t)},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			contents := randomBytes(t, tc.size)
+			if err = blob.CreateObject(ctx, "bucket", "key", contents); err != nil {
+				t.Fatal(err)
+			}
+
+			stored, err := backend.GetObject(ctx, "bucket", "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.size > 0 && bytes.Contains(stored, contents) {
+				t.Errorf("expected stored object to not contain the plaintext")
+			}
+
+			b, err := blob.GetObject(ctx, "bucket", "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(b, contents) {
+				t.Errorf("expected round trip of %d bytes, got %d bytes", len(contents), len(b))
+			}
+		})
+	}
+}
+
+func TestEncrypted_Tamper(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		tamper func(b []byte) []byte
+	}{
+		{
+			name:   "flip_header",
+			tamper: func(b []byte) []byte { b[len(encryptedMagic)+2+2+1] ^= 1; return b },
+		},
+		{
+			name:   "flip_first_chunk",
+			tamper: func(b []byte) []byte { b[64] ^= 1; return b },
+		},
+		{
+			name:   "flip_last_byte",
+			tamper: func(b []byte) []byte { b[len(b)-1] ^= 1; return b },
+		},
+		{
+			name:   "truncate_last_chunk",
+			tamper: func(b []byte) []byte { return b[:len(b)-100] },
+		},
+		{
+			name: "drop_last_chunk",
+			tamper: func(b []byte) []byte {
+				return b[:len(encryptedMagic)+2+2+noncePrefixSize+2*(EncryptedChunkSize+16)]
+			},
+		},
+		{
+			name: "swap_chunks",
+			tamper: func(b []byte) []byte {
+				start, size := len(encryptedMagic)+2+2+noncePrefixSize, EncryptedChunkSize+16
+				first := append([]byte(nil), b[start:start+size]...)
+				copy(b[start:], b[start+size:start+2*size])
+				copy(b[start+size:], first)
+				return b
+			},
+		},
+		{
+			name:   "bad_version",
+			tamper: func(b []byte) []byte { b[len(encryptedMagic)]++; return b },
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.TODO()
+			backend := newMemoryBlob()
+			blob, err := NewEncrypted(backend, EncryptionConfig{
+				KeyID: "k1",
+				Keys:  map[string]string{"k1": newEncryptionKey(t)},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = blob.CreateObject(ctx, "bucket", "key", randomBytes(t, 2*EncryptedChunkSize+500)); err != nil {
+				t.Fatal(err)
+			}
+
+			stored, err := backend.GetObject(ctx, "bucket", "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = backend.CreateObject(ctx, "bucket", "key", tc.tamper(stored)); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err = blob.GetObject(ctx, "bucket", "key"); !errors.Is(err, ErrMalformedContent) {
+				t.Errorf("expected %v to be %v", err, ErrMalformedContent)
+			}
+		})
+	}
+}
+
+func TestEncrypted_Plaintext(t *testing.T) {
+	t.Parallel()
+
+	plaintext := []byte("stored before encryption was turned on")
+	cases := []struct {
+		name           string
+		allowPlaintext bool
+		expected       []byte
+		err            error
+	}{
+		{
+			name: "refetched",
+			err:  ErrNotFound,
+		},
+		{
+			name:           "passed_through",
+			allowPlaintext: true,
+			expected:       plaintext,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.TODO()
+			backend := newMemoryBlob()
+			if err := backend.CreateObject(ctx, "bucket", "key", plaintext); err != nil {
+				t.Fatal(err)
+			}
+
+			blob, err := NewEncrypted(backend, EncryptionConfig{
+				KeyID:          "k1",
+				Keys:           map[string]string{"k1": newEncryptionKey(t)},
+				AllowPlaintext: tc.allowPlaintext,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := blob.GetObject(ctx, "bucket", "key")
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v to be %v", err, tc.err)
+			}
+
+			if !bytes.Equal(got, tc.expected) {
+				t.Errorf("got %q, expected %q", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestEncrypted_KeyRotation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.TODO()
+	backend := newMemoryBlob()
+	oldKey, newKey := newEncryptionKey(t), newEncryptionKey(t)
+
+	before, err := NewEncrypted(backend, EncryptionConfig{KeyID: "old", Keys: map[string]string{"old": oldKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = before.CreateObject(ctx, "bucket", "old", []byte("sealed with the old key")); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := NewEncrypted(backend, EncryptionConfig{
+		KeyID: "new",
+		Keys:  map[string]string{"old": oldKey, "new": newKey},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = after.CreateObject(ctx, "bucket", "new", []byte("sealed with the new key")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := after.GetObject(ctx, "bucket", "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := string(b), "sealed with the old key"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	if _, err = before.GetObject(ctx, "bucket", "new"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected %v to be %v", err, ErrUnknownKey)
+	}
+
+	retired, err := NewEncrypted(backend, EncryptionConfig{KeyID: "new", Keys: map[string]string{"new": newKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = retired.GetObject(ctx, "bucket", "old"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected %v to be %v", err, ErrUnknownKey)
+	}
+}
+
+func TestNewEncrypted(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		cfg  EncryptionConfig
+		err  bool
+	}{
+		{
+			name: "default",
+			cfg:  EncryptionConfig{KeyID: "k1", Keys: map[string]string{"k1": newEncryptionKey(t)}},
+		},
+		{
+			name: "missing_active_key",
+			cfg:  EncryptionConfig{KeyID: "k2", Keys: map[string]string{"k1": newEncryptionKey(t)}},
+			err:  true,
+		},
+		{
+			name: "bad_base64",
+			cfg:  EncryptionConfig{KeyID: "k1", Keys: map[string]string{"k1": "!!!"}},
+			err:  true,
+		},
+		{
+			name: "bad_key_size",
+			cfg:  EncryptionConfig{KeyID: "k1", Keys: map[string]string{"k1": base64.StdEncoding.EncodeToString([]byte("short"))}},
+			err:  true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := NewEncrypted(newMemoryBlob(), tc.cfg); (err != nil) != tc.err {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 var _ Blob = (*FS)(nil)
@@ -36,6 +37,17 @@ func NewFilesystemStorage(_ context.Context) (Blob, error) {
 
 func (s *FS) CreateObject(_ context.Context, folder, filename string, contents []byte) error {
 	pth := filepath.Join(folder, filename)
+	if dir := filepath.Dir(pth); dir != filepath.Clean(folder) {
+		// nested keys get their directories created, the bucket folder itself must already exist
+		if _, err := os.Stat(folder); err != nil {
+			return fmt.Errorf("failed to create object: %w", err)
+		}
+
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return fmt.Errorf("create object dir: %w", err)
+		}
+	}
+
 	if err := os.WriteFile(pth, contents, 0o600); err != nil {
 		return fmt.Errorf("failed to create object: %w", err)
 	}
@@ -49,6 +61,14 @@ func (s *FS) DeleteObject(_ context.Context, folder, filename string) error {
 		return fmt.Errorf("delete fs object: %w", err)
 	}
 
+	// remove directories left empty by nested keys, os.Remove fails on a non-empty one
+	root := filepath.Clean(folder)
+	for dir := filepath.Dir(pth); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			break
+		}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+)
+
+const (
+	// objectKeyPrefix keeps format-aware keys apart from legacy ones, which sit at the bucket root
+	objectKeyPrefix      = "videos"
+	defaultFormatSegment = "default"
+)
+
+// ObjectKey returns the blob key of a single video format in the form videos/video/format/hash.
+// The hash is taken over mime and quality, so formats sharing a quality label never collide
+func ObjectKey(videoID, mime, quality string) string {
+	format := sanitizeSegment(quality)
+	if format == "" {
+		format = defaultFormatSegment
+	}
+
+	sum := sha256.Sum256([]byte(mime + "\x00" + quality))
+
+	return path.Join(objectKeyPrefix, sanitizeSegment(videoID), format, hex.EncodeToString(sum[:8]))
+}
+
+// formatExtensions are the file extensions of the media types youtube serves, the system mime table rarely
+// lists them
+var formatExtensions = map[string]string{
+	"video/mp4":  ".mp4",
+	"video/webm": ".webm",
+	"video/3gpp": ".3gp",
+	"audio/mp4":  ".m4a",
+	"audio/webm": ".weba",
+}
+
+// ObjectFilename returns the name a downloaded video format is saved under, the extension follows the mime
+// type and is left out when the type is unknown
+func ObjectFilename(videoID, mimeType string) string {
+	name := sanitizeSegment(videoID)
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return name
+	}
+
+	if ext, ok := formatExtensions[mediaType]; ok {
+		return name + ext
+	}
+
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+		return name + exts[0]
+	}
+
+	return name
+}
+
+// LegacyObjectKey returns the key objects were stored under before the format-aware scheme
+func LegacyObjectKey(videoID string) string {
+	return sanitizeSegment(videoID)
+}
+
+// MigrateObject moves the object stored under the from key to the to key and returns its contents.
+// ErrNotFound is returned when there is nothing stored under the from key
+func MigrateObject(ctx context.Context, blob Blob, bucket, from, to string) ([]byte, error) {
+	contents, err := blob.GetObject(ctx, bucket, from)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("get legacy object: %w", err)
+	}
+
+	if err = blob.CreateObject(ctx, bucket, to, contents); err != nil {
+		return nil, fmt.Errorf("create migrated object: %w", err)
+	}
+
+	if err = blob.DeleteObject(ctx, bucket, from); err != nil {
+		return nil, fmt.Errorf("delete legacy object: %w", err)
+	}
+
+	return contents, nil
+}
+
+// sanitizeSegment keeps a key segment inside its own directory level
+func sanitizeSegment(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
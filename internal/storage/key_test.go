@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestObjectKey(t *testing.T) {
+	t.Parallel()
+
+	audio := ObjectKey("rFejpH_tAHM", "audio/mp4", "tiny")
+	video := ObjectKey("rFejpH_tAHM", `video/mp4; codecs="avc1.64001F, mp4a.40.2"`, "hd720")
+	webm := ObjectKey("rFejpH_tAHM", `video/webm; codecs="vp9"`, "hd720")
+
+	for _, key := range []string{audio, video, webm} {
+		if key == LegacyObjectKey("rFejpH_tAHM") {
+			t.Errorf("expected %q to differ from the legacy key", key)
+		}
+	}
+
+	if audio == video || video == webm {
+		t.Errorf("expected distinct keys, got %q %q %q", audio, video, webm)
+	}
+
+	if got, want := ObjectKey("rFejpH_tAHM", "audio/mp4", "tiny"), audio; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	if got := ObjectKey("../../etc", "audio/mp4", "../x"); bytes.Contains([]byte(got), []byte("..")) {
+		t.Errorf("expected key %q to have no parent references", got)
+	}
+}
+
+func TestObjectFilename(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		videoID  string
+		mime     string
+		expected string
+	}{
+		{name: "mp4", videoID: "rFejpH_tAHM", mime: `video/mp4; codecs="avc1.64001F, mp4a.40.2"`, expected: "rFejpH_tAHM.mp4"},
+		{name: "webm", videoID: "rFejpH_tAHM", mime: `video/webm; codecs="vp9"`, expected: "rFejpH_tAHM.webm"},
+		{name: "audio", videoID: "rFejpH_tAHM", mime: "audio/mp4", expected: "rFejpH_tAHM.m4a"},
+		{name: "unknown", videoID: "rFejpH_tAHM", mime: "video/x-unknown", expected: "rFejpH_tAHM"},
+		{name: "invalid", videoID: "rFejpH_tAHM", mime: "", expected: "rFejpH_tAHM"},
+		{name: "unsafe_id", videoID: `a"b/c`, mime: "video/mp4", expected: "a_b_c.mp4"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := ObjectFilename(tc.videoID, tc.mime); got != tc.expected {
+				t.Errorf("expected %q to be %q", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestMigrateObject(t *testing.T) {
+	t.Parallel()
+
+	tmp, err := os.MkdirTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(tmp) })
+
+	ctx := context.TODO()
+	blob, err := NewFilesystemStorage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = blob.CreateObject(ctx, tmp, LegacyObjectKey("video"), []byte("contents")); err != nil {
+		t.Fatal(err)
+	}
+
+	key := ObjectKey("video", "video/mp4", "hd720")
+	b, err := MigrateObject(ctx, blob, tmp, LegacyObjectKey("video"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := b, []byte("contents"); !bytes.Equal(got, want) {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	if _, err = blob.GetObject(ctx, tmp, LegacyObjectKey("video")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected legacy object to be removed, got %v", err)
+	}
+
+	if _, err = blob.GetObject(ctx, tmp, key); err != nil {
+		t.Errorf("expected migrated object, got %v", err)
+	}
+
+	if _, err = MigrateObject(ctx, blob, tmp, LegacyObjectKey("video"), key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v to be %v", err, ErrNotFound)
+	}
+
+	if err = blob.DeleteObject(ctx, tmp, key); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 0 {
+		t.Errorf("expected empty key directories to be removed, got %d entries", len(entries))
+	}
+}
@@ -25,6 +25,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -33,7 +35,10 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
-var _ Blob = (*S3)(nil)
+var (
+	_ Blob      = (*S3)(nil)
+	_ URLSigner = (*S3)(nil)
+)
 
 func NewS3(cfg S3Config) (*S3, error) {
 	sess, err := session.NewSession(&aws.Config{
@@ -115,3 +120,25 @@ func (s *S3) GetObject(ctx context.Context, bucket, key string) ([]byte, error)
 func (s *S3) PublicAccess(_ context.Context, bucket, key string) string {
 	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, s.cfg.Region, key)
 }
+
+// SignedURL returns a presigned GET link to the object valid for ttl
+func (s *S3) SignedURL(_ context.Context, bucket, key, filename string, ttl time.Duration) (string, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if filename != "" {
+		input.ResponseContentDisposition = aws.String(
+			mime.FormatMediaType("attachment", map[string]string{"filename": filename}),
+		)
+	}
+
+	req, _ := s.svc.GetObjectRequest(input)
+
+	u, err := req.Presign(ttl)
+	if err != nil {
+		return "", fmt.Errorf("presign object: %w", err)
+	}
+
+	return u, nil
+}
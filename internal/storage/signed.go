@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DownloadPath is the HTTP path prefix signed download links are served under
+const DownloadPath = "/download/"
+
+var ErrInvalidSignature = errors.New("invalid download link signature")
+
+// URLSigner issues time-limited download links for stored objects, the object is saved under filename
+type URLSigner interface {
+	SignedURL(ctx context.Context, bucket, key, filename string, ttl time.Duration) (string, error)
+}
+
+// NewHMACSigner returns a signer for links served by DownloadHandler under baseURL
+func NewHMACSigner(cfg SignedURLConfig) (*HMACSigner, error) {
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("download base url is not set")
+	}
+
+	if len(cfg.Secret) < 32 {
+		return nil, fmt.Errorf("download signing secret must be at least 32 bytes long")
+	}
+
+	return &HMACSigner{baseURL: strings.TrimSuffix(cfg.BaseURL, "/"), secret: []byte(cfg.Secret)}, nil
+}
+
+var _ URLSigner = (*HMACSigner)(nil)
+
+// HMACSigner signs links to cribe's own download endpoint, it is used for the FS backend and for
+// blobs whose stored bytes can not be handed out as is
+type HMACSigner struct {
+	baseURL string
+	secret  []byte
+	now     func() time.Time
+}
+
+func (h *HMACSigner) SignedURL(_ context.Context, bucket, key, filename string, ttl time.Duration) (string, error) {
+	expires := h.timeNow().Add(ttl).Unix()
+
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	if filename != "" {
+		q.Set("filename", filename)
+	}
+	q.Set("signature", h.sign(bucket, key, filename, expires))
+
+	return h.baseURL + path.Join(DownloadPath, key) + "?" + q.Encode(), nil
+}
+
+// Verify checks the signature and expiration of a link to the key
+func (h *HMACSigner) Verify(bucket, key string, query url.Values) error {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(query.Get("signature")), []byte(h.sign(bucket, key, query.Get("filename"), expires))) {
+		return ErrInvalidSignature
+	}
+
+	if h.timeNow().Unix() > expires {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// sign covers the filename only when there is one, so links issued without it stay valid
+func (h *HMACSigner) sign(bucket, key, filename string, expires int64) string {
+	mac := hmac.New(sha256.New, h.secret)
+	fmt.Fprintf(mac, "%s\x00%s\x00%d", bucket, key, expires)
+	if filename != "" {
+		fmt.Fprintf(mac, "\x00%s", filename)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (h *HMACSigner) timeNow() time.Time {
+	if h.now != nil {
+		return h.now()
+	}
+
+	return time.Now()
+}
+
+// DownloadHandler serves objects of the bucket to requests carrying a valid HMACSigner signature
+func DownloadHandler(blob Blob, bucket string, signer *HMACSigner) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		key := strings.TrimPrefix(r.URL.Path, DownloadPath)
+		if key == "" || key != path.Clean(key) || strings.HasPrefix(key, "../") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if err := signer.Verify(bucket, key, r.URL.Query()); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		contents, err := blob.GetObject(r.Context(), bucket, key)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		filename := r.URL.Query().Get("filename")
+		if filename == "" {
+			filename = path.Base(key)
+		}
+
+		w.Header().Set("Content-Type", http.DetectContentType(contents))
+		w.Header().Set("Content-Length", strconv.Itoa(len(contents)))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(contents)
+		}
+	})
+}
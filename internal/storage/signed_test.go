@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHMACSigner_DownloadHandler(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.TODO()
+	blob := newMemoryBlob()
+	key := ObjectKey("video", "video/mp4", "hd720")
+	if err := blob.CreateObject(ctx, "bucket", key, []byte("contents")); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := NewHMACSigner(SignedURLConfig{
+		BaseURL: "https://cribe.example/",
+		Secret:  strings.Repeat("s", 32),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	signer.now = func() time.Time { return now }
+
+	link, err := signer.SignedURL(ctx, "bucket", key, "video.mp4", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(link, "https://cribe.example"+DownloadPath+key+"?") {
+		t.Fatalf("unexpected link %q", link)
+	}
+
+	other, err := signer.SignedURL(ctx, "bucket", ObjectKey("other", "video/mp4", "hd720"), "video.mp4", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherQuery := other[strings.Index(other, "?"):]
+
+	unnamed, err := signer.SignedURL(ctx, "bucket", key, "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a link carries the filename it was signed for
+	renamed := strings.Replace(link, "filename=video.mp4", "filename=video.exe", 1)
+
+	cases := []struct {
+		name        string
+		target      string
+		after       time.Duration
+		status      int
+		disposition string
+	}{
+		{
+			name:        "default",
+			target:      strings.TrimPrefix(link, "https://cribe.example"),
+			status:      http.StatusOK,
+			disposition: "attachment; filename=video.mp4",
+		},
+		{
+			name:        "without_filename",
+			target:      strings.TrimPrefix(unnamed, "https://cribe.example"),
+			status:      http.StatusOK,
+			disposition: "attachment; filename=" + path.Base(key),
+		},
+		{
+			name:   "other_filename",
+			target: strings.TrimPrefix(renamed, "https://cribe.example"),
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "expired",
+			target: strings.TrimPrefix(link, "https://cribe.example"),
+			after:  2 * time.Hour,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "signature_of_other_key",
+			target: DownloadPath + key + otherQuery,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "unsigned",
+			target: DownloadPath + key,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "parent_reference",
+			target: DownloadPath + "../" + key + otherQuery,
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			verifier, err := NewHMACSigner(SignedURLConfig{BaseURL: "https://cribe.example", Secret: strings.Repeat("s", 32)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			verifier.now = func() time.Time { return now.Add(tc.after) }
+
+			rec := httptest.NewRecorder()
+			DownloadHandler(blob, "bucket", verifier).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.target, nil))
+			if got, want := rec.Code, tc.status; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+
+			if tc.status == http.StatusOK && rec.Body.String() != "contents" {
+				t.Errorf("expected %q to be %q", rec.Body.String(), "contents")
+			}
+
+			if got := rec.Header().Get("Content-Disposition"); got != tc.disposition {
+				t.Errorf("expected %q to be %q", got, tc.disposition)
+			}
+		})
+	}
+}
+
+func TestNewHMACSigner(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewHMACSigner(SignedURLConfig{BaseURL: "https://cribe.example", Secret: "short"}); err == nil {
+		t.Error("expected short secret to be rejected")
+	}
+
+	if _, err := NewHMACSigner(SignedURLConfig{Secret: strings.Repeat("s", 32)}); err == nil {
+		t.Error("expected missing base url to be rejected")
+	}
+}
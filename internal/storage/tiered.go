@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"expvar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/robotomize/cribe/internal/lru"
+)
+
+// TieredMetrics are the local cache counters of every Tiered storage, published as storage_cache
+var TieredMetrics = expvar.NewMap("storage_cache")
+
+func init() {
+	TieredMetrics.Set("hit_ratio", expvar.Func(func() interface{} {
+		hits, misses := metricValue("hits"), metricValue("misses")
+		if hits+misses == 0 {
+			return 0.0
+		}
+
+		return float64(hits) / float64(hits+misses)
+	}))
+}
+
+func metricValue(name string) int64 {
+	if v, ok := TieredMetrics.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+
+	return 0
+}
+
+var _ Blob = (*Tiered)(nil)
+
+// tmpPrefix marks local copies still being written
+const tmpPrefix = ".tmp-"
+
+// NewTiered returns a storage writing through to the remote one and keeping a bounded local copy of objects.
+// Files already in the cache dir are picked up, the most recently modified ones are kept
+func NewTiered(remote Blob, cfg CacheConfig) (*Tiered, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+
+	t := &Tiered{remote: remote, dir: cfg.Dir}
+	t.cache = lru.New[string, int64](
+		cfg.MaxBytes,
+		lru.WithSizeFunc[string, int64](func(size int64) int64 { return size }),
+		lru.WithEvictFunc[string, int64](func(name string, _ int64) {
+			TieredMetrics.Add("evictions", 1)
+			_ = os.Remove(filepath.Join(t.dir, name))
+		}),
+	)
+
+	entries, err := os.ReadDir(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("read cache dir: %w", err)
+	}
+
+	files := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		if strings.HasPrefix(entry.Name(), tmpPrefix) {
+			_ = os.Remove(filepath.Join(cfg.Dir, entry.Name()))
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		files = append(files, info)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+
+	for _, info := range files {
+		t.cache.Add(info.Name(), info.Size())
+	}
+
+	return t, nil
+}
+
+// Tiered is a Blob with a local disk LRU cache in front of a remote storage
+type Tiered struct {
+	remote Blob
+	dir    string
+	cache  *lru.Cache[string, int64]
+}
+
+// Remote returns the storage behind the local cache
+func (t *Tiered) Remote() Blob {
+	return t.remote
+}
+
+func (t *Tiered) CreateObject(ctx context.Context, bucket, key string, contents []byte) error {
+	if err := t.remote.CreateObject(ctx, bucket, key, contents); err != nil {
+		return err
+	}
+
+	t.store(bucket, key, contents)
+
+	return nil
+}
+
+func (t *Tiered) DeleteObject(ctx context.Context, bucket, key string) error {
+	t.cache.Remove(t.name(bucket, key))
+
+	return t.remote.DeleteObject(ctx, bucket, key)
+}
+
+func (t *Tiered) GetObject(ctx context.Context, bucket, key string) ([]byte, error) {
+	name := t.name(bucket, key)
+	if _, ok := t.cache.Get(name); ok {
+		b, err := os.ReadFile(filepath.Join(t.dir, name))
+		if err == nil {
+			TieredMetrics.Add("hits", 1)
+
+			return b, nil
+		}
+
+		t.cache.Remove(name)
+	}
+
+	TieredMetrics.Add("misses", 1)
+
+	b, err := t.remote.GetObject(ctx, bucket, key)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	t.store(bucket, key, b)
+
+	return b, nil
+}
+
+// store writes the local copy, the cache is best effort so failures only leave the object uncached
+func (t *Tiered) store(bucket, key string, contents []byte) {
+	name := t.name(bucket, key)
+	if int64(len(contents)) > t.cache.Capacity() {
+		t.cache.Remove(name)
+
+		return
+	}
+
+	tmp, err := os.CreateTemp(t.dir, tmpPrefix+"*")
+	if err != nil {
+		return
+	}
+
+	_, err = tmp.Write(contents)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(t.dir, name))
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		t.cache.Remove(name)
+
+		return
+	}
+
+	t.cache.Add(name, int64(len(contents)))
+}
+
+func (t *Tiered) name(bucket, key string) string {
+	sum := sha256.Sum256([]byte(bucket + "\x00" + key))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+type countingBlob struct {
+	*memoryBlob
+	gets int64
+}
+
+func (c *countingBlob) GetObject(ctx context.Context, bucket, key string) ([]byte, error) {
+	atomic.AddInt64(&c.gets, 1)
+
+	return c.memoryBlob.GetObject(ctx, bucket, key)
+}
+
+func TestTiered_GetObject(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.TODO()
+	remote := &countingBlob{memoryBlob: newMemoryBlob()}
+	blob, err := NewTiered(remote, CacheConfig{Dir: t.TempDir(), MaxBytes: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = blob.CreateObject(ctx, "bucket", "a", []byte("aaaa")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := blob.GetObject(ctx, "bucket", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(b, []byte("aaaa")) {
+		t.Errorf("expected %q to be %q", b, "aaaa")
+	}
+
+	if got := atomic.LoadInt64(&remote.gets); got != 0 {
+		t.Errorf("expected written object to be served locally, got %d remote reads", got)
+	}
+
+	if err = remote.CreateObject(ctx, "bucket", "b", []byte("bbbb")); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err = blob.GetObject(ctx, "bucket", "b"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := atomic.LoadInt64(&remote.gets); got != 1 {
+		t.Errorf("expected a single remote read, got %d", got)
+	}
+
+	if _, err = blob.GetObject(ctx, "bucket", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v to be %v", err, ErrNotFound)
+	}
+}
+
+func TestTiered_Bounded(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.TODO()
+	dir := t.TempDir()
+	remote := &countingBlob{memoryBlob: newMemoryBlob()}
+	blob, err := NewTiered(remote, CacheConfig{Dir: dir, MaxBytes: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err = blob.CreateObject(ctx, "bucket", key, []byte("xxxx")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = blob.CreateObject(ctx, "bucket", "huge", make([]byte, 11)); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(entries), 2; got != want {
+		t.Errorf("expected %d cached files to be %d", got, want)
+	}
+
+	if _, err = blob.GetObject(ctx, "bucket", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := atomic.LoadInt64(&remote.gets); got != 1 {
+		t.Errorf("expected evicted object to be read remotely, got %d reads", got)
+	}
+
+	if err = blob.DeleteObject(ctx, "bucket", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = blob.GetObject(ctx, "bucket", "a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v to be %v", err, ErrNotFound)
+	}
+
+	restarted, err := NewTiered(remote, CacheConfig{Dir: dir, MaxBytes: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := atomic.LoadInt64(&remote.gets)
+	if _, err = restarted.GetObject(ctx, "bucket", "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := atomic.LoadInt64(&remote.gets); got != before {
+		t.Errorf("expected files of the previous run to be served locally")
+	}
+}
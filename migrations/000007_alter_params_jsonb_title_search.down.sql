@@ -0,0 +1,10 @@
+BEGIN;
+DROP INDEX IF EXISTS metadata_created_at_idx;
+DROP INDEX IF EXISTS metadata_title_tsv_idx;
+
+ALTER TABLE metadata
+    DROP COLUMN title_tsv;
+
+ALTER TABLE metadata
+    ALTER COLUMN params TYPE JSON USING params::JSON;
+END;
\ No newline at end of file
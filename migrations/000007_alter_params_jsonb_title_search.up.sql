@@ -0,0 +1,11 @@
+BEGIN;
+ALTER TABLE metadata
+    ALTER COLUMN params TYPE JSONB USING params::JSONB;
+
+ALTER TABLE metadata
+    ADD COLUMN title_tsv TSVECTOR
+        GENERATED ALWAYS AS (to_tsvector('simple', COALESCE(params ->> 'title', ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS metadata_title_tsv_idx ON metadata USING GIN (title_tsv);
+CREATE INDEX IF NOT EXISTS metadata_created_at_idx ON metadata (created_at DESC);
+END;
\ No newline at end of file
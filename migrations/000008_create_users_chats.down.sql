@@ -0,0 +1,4 @@
+BEGIN;
+DROP TABLE IF EXISTS chats;
+DROP TABLE IF EXISTS users;
+END;
\ No newline at end of file
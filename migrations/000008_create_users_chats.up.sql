@@ -0,0 +1,24 @@
+BEGIN;
+CREATE TABLE IF NOT EXISTS users
+(
+    id             BIGINT PRIMARY KEY,
+    username       TEXT,
+    language_code  TEXT,
+    blocked        BOOLEAN                  DEFAULT FALSE,
+    requests_count BIGINT                   DEFAULT 0,
+    first_seen_at  TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_seen_at   TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS chats
+(
+    id             BIGINT PRIMARY KEY,
+    type           TEXT,
+    title          TEXT,
+    username       TEXT,
+    blocked        BOOLEAN                  DEFAULT FALSE,
+    requests_count BIGINT                   DEFAULT 0,
+    first_seen_at  TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_seen_at   TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+END;
\ No newline at end of file
@@ -0,0 +1,3 @@
+BEGIN;
+DROP TABLE IF EXISTS requests;
+END;
\ No newline at end of file
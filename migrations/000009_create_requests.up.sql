@@ -0,0 +1,18 @@
+BEGIN;
+CREATE TABLE IF NOT EXISTS requests
+(
+    CONSTRAINT requests_user_video_format_key UNIQUE (user_id, video_id, mime, quality),
+
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT NOT NULL,
+    chat_id    BIGINT NOT NULL,
+    video_id   TEXT   NOT NULL,
+    mime       TEXT   NOT NULL,
+    quality    TEXT   NOT NULL,
+    outcome    TEXT   NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS requests_user_id_updated_at_idx ON requests (user_id, updated_at DESC);
+END;
\ No newline at end of file
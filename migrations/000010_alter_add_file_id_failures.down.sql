@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE metadata
+    DROP COLUMN file_id_failures;
+END;
\ No newline at end of file
@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE metadata
+    ADD COLUMN file_id_failures INT NOT NULL DEFAULT 0;
+END;
\ No newline at end of file
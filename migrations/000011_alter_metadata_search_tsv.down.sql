@@ -0,0 +1,13 @@
+BEGIN;
+DROP INDEX IF EXISTS metadata_channel_id_idx;
+DROP INDEX IF EXISTS metadata_search_tsv_idx;
+
+ALTER TABLE metadata
+    DROP COLUMN search_tsv;
+
+ALTER TABLE metadata
+    ADD COLUMN title_tsv TSVECTOR
+        GENERATED ALWAYS AS (to_tsvector('simple', COALESCE(params ->> 'title', ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS metadata_title_tsv_idx ON metadata USING GIN (title_tsv);
+END;
\ No newline at end of file
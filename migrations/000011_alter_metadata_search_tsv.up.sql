@@ -0,0 +1,18 @@
+BEGIN;
+DROP INDEX IF EXISTS metadata_title_tsv_idx;
+
+ALTER TABLE metadata
+    DROP COLUMN title_tsv;
+
+ALTER TABLE metadata
+    ADD COLUMN search_tsv TSVECTOR
+        GENERATED ALWAYS AS (
+            setweight(to_tsvector('simple', COALESCE(params ->> 'title', '')), 'A') ||
+            setweight(to_tsvector('simple', COALESCE(params ->> 'author', '')), 'B') ||
+            setweight(to_tsvector('simple', COALESCE(params -> 'keywords', '[]'::JSONB)), 'B') ||
+            setweight(to_tsvector('simple', COALESCE(params ->> 'description', '')), 'C')
+        ) STORED;
+
+CREATE INDEX IF NOT EXISTS metadata_search_tsv_idx ON metadata USING GIN (search_tsv);
+CREATE INDEX IF NOT EXISTS metadata_channel_id_idx ON metadata ((params ->> 'channel_id'));
+END;
\ No newline at end of file
@@ -0,0 +1,3 @@
+BEGIN;
+DROP TABLE IF EXISTS unavailable_videos;
+END;
\ No newline at end of file
@@ -0,0 +1,10 @@
+BEGIN;
+CREATE TABLE IF NOT EXISTS unavailable_videos
+(
+    video_id   TEXT PRIMARY KEY,
+    reason     TEXT                     NOT NULL,
+    details    TEXT                     NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+END;
\ No newline at end of file
@@ -0,0 +1,10 @@
+BEGIN;
+DROP TABLE IF EXISTS metadata_archive;
+
+DROP INDEX IF EXISTS metadata_hit_count_idx;
+DROP INDEX IF EXISTS metadata_last_accessed_at_idx;
+
+ALTER TABLE metadata
+    DROP COLUMN last_accessed_at,
+    DROP COLUMN hit_count;
+END;
\ No newline at end of file
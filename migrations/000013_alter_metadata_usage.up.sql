@@ -0,0 +1,24 @@
+BEGIN;
+ALTER TABLE metadata
+    ADD COLUMN hit_count        BIGINT                   NOT NULL DEFAULT 0,
+    ADD COLUMN last_accessed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS metadata_last_accessed_at_idx ON metadata (last_accessed_at);
+CREATE INDEX IF NOT EXISTS metadata_hit_count_idx ON metadata (hit_count DESC);
+
+CREATE TABLE IF NOT EXISTS metadata_archive
+(
+    video_id         TEXT                     NOT NULL,
+    quality          TEXT                     NOT NULL,
+    mime             TEXT                     NOT NULL,
+    file_id          TEXT,
+    params           JSONB,
+    hit_count        BIGINT                   NOT NULL DEFAULT 0,
+    last_accessed_at TIMESTAMP WITH TIME ZONE,
+    created_at       TIMESTAMP WITH TIME ZONE,
+    updated_at       TIMESTAMP WITH TIME ZONE,
+    archived_at      TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS metadata_archive_video_id_idx ON metadata_archive (video_id);
+END;
\ No newline at end of file
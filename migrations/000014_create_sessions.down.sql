@@ -0,0 +1,3 @@
+BEGIN;
+DROP TABLE IF EXISTS sessions;
+END;
\ No newline at end of file
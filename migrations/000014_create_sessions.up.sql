@@ -0,0 +1,11 @@
+BEGIN;
+CREATE TABLE IF NOT EXISTS sessions
+(
+    key        TEXT PRIMARY KEY,
+    data       BYTEA                    NOT NULL,
+    version    BIGINT                   NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS sessions_expires_at_idx ON sessions (expires_at);
+END;
\ No newline at end of file
@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE metadata
+    DROP COLUMN link_expires_at;
+END;
\ No newline at end of file
@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE metadata
+    ADD COLUMN link_expires_at TIMESTAMP WITH TIME ZONE;
+END;
\ No newline at end of file
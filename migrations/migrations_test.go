@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"io/fs"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFS(t *testing.T) {
+	t.Parallel()
+
+	entries, err := fs.ReadDir(FS, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ups, downs := make(map[int]string), make(map[int]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		version, err := strconv.Atoi(name[:strings.Index(name, "_")])
+		if err != nil {
+			t.Fatalf("migration %q has no version: %v", name, err)
+		}
+
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			ups[version] = name
+		case strings.HasSuffix(name, ".down.sql"):
+			downs[version] = name
+		default:
+			t.Errorf("unexpected embedded file %q", name)
+		}
+	}
+
+	if len(ups) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+
+	for version := 1; version <= len(ups); version++ {
+		if _, ok := ups[version]; !ok {
+			t.Errorf("missing up migration %d", version)
+		}
+
+		if _, ok := downs[version]; !ok {
+			t.Errorf("missing down migration %d", version)
+		}
+	}
+}
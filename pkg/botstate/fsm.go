@@ -1,64 +1,226 @@
 package botstate
 
 import (
+	"context"
+	"fmt"
 	"sync"
+	"time"
 )
 
 const (
 	Default StateType = "init"
 	Noop    EventType = "noop"
+	// TimeoutEvent is sent when the machine stayed in a state longer than its timeout. It moves the machine
+	// to Default unless the state declares another transition for it
+	TimeoutEvent EventType = "timeout"
+	// BackEvent moves the machine to the state it came from, see History, unless the state declares another
+	// transition for it
+	BackEvent EventType = "back"
+	// DefaultHistoryLimit is how many states the machine remembers for BackEvent
+	DefaultHistoryLimit = 16
 )
 
 type StateType string
 
 type EventType string
 
+// EventContext is the event context of the machines of the former untyped API, see Adapt
 type EventContext interface{}
 
-type Action interface {
+// Action is executed when the machine enters a state, it returns the next event to send or Noop to wait.
+// An error stops the machine in the state
+type Action[C any] interface {
+	Execute(ctx context.Context, eventCtx C) (EventType, error)
+}
+
+// ActionFunc is a function used as an action
+type ActionFunc[C any] func(ctx context.Context, eventCtx C) (EventType, error)
+
+func (f ActionFunc[C]) Execute(ctx context.Context, eventCtx C) (EventType, error) {
+	return f(ctx, eventCtx)
+}
+
+// LegacyAction is an action of the former untyped API, it finds its context.Context in the event context
+type LegacyAction interface {
 	Execute(eventCtx EventContext) EventType
 }
 
+// Adapt returns the action running the legacy one, it gets the typed event context as an EventContext and
+// never fails
+func Adapt[C any](action LegacyAction) Action[C] {
+	return ActionFunc[C](func(_ context.Context, eventCtx C) (EventType, error) {
+		return action.Execute(eventCtx), nil
+	})
+}
+
+// NoopAction is the action of a state waiting for the next event
+type NoopAction[C any] struct{}
+
+func (NoopAction[C]) Execute(_ context.Context, _ C) (EventType, error) {
+	return Noop, nil
+}
+
 type Events map[EventType]StateType
 
-type State struct {
-	Action Action
+// Guard tells whether the transition on an event may happen, an error rejects it with the error as the reason
+type Guard[C any] func(ctx context.Context, eventCtx C) error
+
+// Guards are the guards of the events of a state
+type Guards[C any] map[EventType]Guard[C]
+
+// Hook is run when the machine enters or leaves a state
+type Hook[C any] func(ctx context.Context, eventCtx C)
+
+type State[C any] struct {
+	// Action is executed when the machine enters the state, NoopAction waits for the next event
+	Action Action[C]
+	// Parent is the state the state is nested in, the events and guards the state does not declare are
+	// taken from its parents
+	Parent StateType
 	Events Events
+	Guards Guards[C]
+	// OnEnter is run when the machine enters the state, before its action. The hooks of the parents entered
+	// on the way are run first
+	OnEnter Hook[C]
+	// OnExit is run when the machine leaves the state, before the hooks of the parents left on the way
+	OnExit Hook[C]
+	// Timeout is how long the machine may stay in the state, 0 means forever. The expiry is noticed by
+	// Session.Load, the hooks and actions run by its TimeoutEvent get the zero event context unless the
+	// session was given one with SetTimeoutContext
+	Timeout time.Duration
+}
+
+// Transition is a change of the current state caused by an event
+type Transition struct {
+	From  StateType
+	To    StateType
+	Event EventType
+}
+
+// Listener observes the transitions of a machine, it is run once the transition is committed and before the
+// action of the state entered
+type Listener[C any] func(t Transition, eventCtx C)
+
+// RejectedError is returned for a transition rejected by a guard, it matches ErrEventRejected
+type RejectedError struct {
+	State  StateType
+	Event  EventType
+	Reason error
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("event %s rejected in state %s: %v", e.Event, e.State, e.Reason)
+}
+
+func (e *RejectedError) Is(target error) bool {
+	return target == ErrEventRejected
+}
+
+func (e *RejectedError) Unwrap() error {
+	return e.Reason
 }
 
-type States map[StateType]State
+// ActionError is returned for an action failed in a state. The transition to the state is committed before
+// its action runs, so the machine stays in the state the action failed in
+type ActionError struct {
+	State StateType
+	Err   error
+}
+
+func (e *ActionError) Error() string {
+	return fmt.Sprintf("action of state %s: %v", e.State, e.Err)
+}
+
+func (e *ActionError) Unwrap() error {
+	return e.Err
+}
+
+type States[C any] map[StateType]State[C]
+
+// NewStateMachine returns the machine of the states in Default, the states are validated first, see Validate
+func NewStateMachine[C any](states States[C]) (*StateMachine[C], error) {
+	if err := states.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid states: %w", err)
+	}
 
-func NewStateMachine(states States) *StateMachine {
-	return &StateMachine{states: states}
+	return &StateMachine[C]{states: states, curr: Default, historyLimit: DefaultHistoryLimit, timeFn: time.Now}, nil
 }
 
-type StateMachine struct {
-	mtx    sync.RWMutex
-	prev   StateType
-	curr   StateType
-	states States
+// StateMachine is the machine of the states whose actions get event contexts of type C
+type StateMachine[C any] struct {
+	mtx sync.RWMutex
+	// sending serializes SendEvent, mtx is only held to read and commit the current state
+	sending sync.Mutex
+	curr    StateType
+	// history are the states the machine came from, the last one on top
+	history      []StateType
+	historyLimit int
+	states       States[C]
+	listeners    []Listener[C]
+	// entered is when the machine entered the current state
+	entered time.Time
+	timeFn  func() time.Time
 }
 
-func (s *StateMachine) Current() StateType {
+// AddListener registers the listener of every following transition
+func (s *StateMachine[C]) AddListener(l Listener[C]) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.listeners = append(s.listeners, l)
+}
+
+func (s *StateMachine[C]) Current() StateType {
 	s.mtx.RLock()
 	defer s.mtx.RUnlock()
 
 	return s.curr
 }
 
-func (s *StateMachine) Previous() StateType {
+// Previous returns the state the machine came from, it is empty for an empty history
+func (s *StateMachine[C]) Previous() StateType {
 	s.mtx.RLock()
 	defer s.mtx.RUnlock()
 
-	return s.prev
+	if len(s.history) == 0 {
+		return ""
+	}
+
+	return s.history[len(s.history)-1]
 }
 
-func (s *StateMachine) SendEvent(event EventType, eventCtx EventContext) error {
+// History returns the states the machine came from, the most recent one last
+func (s *StateMachine[C]) History() []StateType {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	return append([]StateType(nil), s.history...)
+}
+
+// SetHistoryLimit sets how many states the machine remembers, the oldest ones are forgotten first. 0 means
+// no limit
+func (s *StateMachine[C]) SetHistoryLimit(limit int) {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
+	s.historyLimit = limit
+	s.trimHistory()
+}
+
+// SendEvent moves the machine on the event and runs the actions of the states entered until one of them
+// returns Noop. The error of an action is returned as ActionError. Guards, hooks, listeners and actions run
+// with the machine unlocked, they may read it but must not send events to it, an action returns the next
+// event instead
+func (s *StateMachine[C]) SendEvent(ctx context.Context, event EventType, eventCtx C) error {
+	s.sending.Lock()
+	defer s.sending.Unlock()
+
 	for {
-		nextState, err := s.getNextState(event)
+		s.mtx.RLock()
+		curr := s.curr
+		nextState, back, err := s.getNextState(event)
+		guard := s.states.guard(curr, event)
+		s.mtx.RUnlock()
 		if err != nil {
 			return ErrEventRejected
 		}
@@ -68,10 +230,37 @@ func (s *StateMachine) SendEvent(event EventType, eventCtx EventContext) error {
 			return ErrStateNotFound
 		}
 
-		s.prev = s.curr
-		s.curr = nextState
+		if guard != nil {
+			if err = guard(ctx, eventCtx); err != nil {
+				return &RejectedError{State: curr, Event: event, Reason: err}
+			}
+		}
+
+		exit, enter := s.states.path(curr, nextState)
+		for _, name := range exit {
+			if hook := s.states[name].OnExit; hook != nil {
+				hook(ctx, eventCtx)
+			}
+		}
+
+		transition := Transition{From: curr, To: nextState, Event: event}
+		listeners := s.commit(transition, back)
+
+		for _, name := range enter {
+			if hook := s.states[name].OnEnter; hook != nil {
+				hook(ctx, eventCtx)
+			}
+		}
+
+		for _, l := range listeners {
+			l(transition, eventCtx)
+		}
+
+		nextEvent, err := state.Action.Execute(ctx, eventCtx)
+		if err != nil {
+			return &ActionError{State: nextState, Err: err}
+		}
 
-		nextEvent := state.Action.Execute(eventCtx)
 		if nextEvent == Noop {
 			return nil
 		}
@@ -80,14 +269,55 @@ func (s *StateMachine) SendEvent(event EventType, eventCtx EventContext) error {
 	}
 }
 
-func (s *StateMachine) getNextState(event EventType) (StateType, error) {
-	if state, ok := s.states[s.curr]; ok {
-		if state.Events != nil {
-			if next, ok := state.Events[event]; ok {
-				return next, nil
-			}
-		}
+// commit moves the machine to the state of the transition and returns the listeners to notify of it
+func (s *StateMachine[C]) commit(t Transition, back bool) []Listener[C] {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if back {
+		s.history = s.history[:len(s.history)-1]
+	} else {
+		s.history = append(s.history, s.curr)
+		s.trimHistory()
+	}
+
+	s.curr = t.To
+	s.entered = s.timeFn()
+
+	return append([]Listener[C](nil), s.listeners...)
+}
+
+// Expired tells whether the machine stayed in the current state longer than its timeout
+func (s *StateMachine[C]) Expired() bool {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	state, ok := s.states[s.curr]
+	if !ok || state.Timeout <= 0 || s.entered.IsZero() {
+		return false
+	}
+
+	return s.timeFn().Sub(s.entered) >= state.Timeout
+}
+
+// getNextState returns the state the event moves the machine to, back tells it is taken from the history
+func (s *StateMachine[C]) getNextState(event EventType) (next StateType, back bool, err error) {
+	if next, ok := s.states.resolve(s.curr, event); ok {
+		return next, false, nil
 	}
 
-	return Default, ErrEventRejected
+	switch {
+	case event == TimeoutEvent && s.states[s.curr].Timeout > 0:
+		return Default, false, nil
+	case event == BackEvent && len(s.history) > 0:
+		return s.history[len(s.history)-1], true, nil
+	}
+
+	return Default, false, ErrEventRejected
+}
+
+func (s *StateMachine[C]) trimHistory() {
+	if s.historyLimit > 0 && len(s.history) > s.historyLimit {
+		s.history = append([]StateType(nil), s.history[len(s.history)-s.historyLimit:]...)
+	}
 }
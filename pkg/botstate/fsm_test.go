@@ -0,0 +1,246 @@
+package botstate
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const (
+	stateParsing StateType = "parsing"
+	stateChoice  StateType = "choice"
+
+	eventParse  EventType = "parse"
+	eventChoose EventType = "choose"
+	eventReset  EventType = "reset"
+)
+
+func TestStateMachine_SendEvent(t *testing.T) {
+	t.Parallel()
+
+	errNoLink := errors.New("no link")
+	errParsing := errors.New("parsing")
+	testCases := []struct {
+		name     string
+		event    EventType
+		eventCtx string
+		current  StateType
+		log      []string
+		err      error
+	}{
+		{
+			name:     "test_transitions",
+			event:    eventParse,
+			eventCtx: "link",
+			current:  stateChoice,
+			log: []string{
+				"exit init", "enter parsing", "init -parse-> parsing", "execute parsing",
+				"exit parsing", "enter choice", "parsing -choose-> choice",
+			},
+		},
+		{
+			name:     "test_guard_rejects",
+			event:    eventParse,
+			eventCtx: "",
+			current:  Default,
+			err:      errNoLink,
+		},
+		{
+			name:     "test_action_fails",
+			event:    eventParse,
+			eventCtx: "broken",
+			current:  stateParsing,
+			log:      []string{"exit init", "enter parsing", "init -parse-> parsing", "execute parsing"},
+			err:      errParsing,
+		},
+		{
+			name:    "test_unknown_event",
+			event:   eventReset,
+			current: Default,
+			err:     ErrEventRejected,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var log []string
+			ctx := context.Background()
+			hook := func(entry string) Hook[string] {
+				return func(context.Context, string) { log = append(log, entry) }
+			}
+
+			machine, err := NewStateMachine(States[string]{
+				Default: {
+					Action: NoopAction[string]{},
+					Events: Events{eventParse: stateParsing},
+					Guards: Guards[string]{
+						eventParse: func(_ context.Context, link string) error {
+							if link == "" {
+								return errNoLink
+							}
+
+							return nil
+						},
+					},
+					OnExit: hook("exit init"),
+				},
+				stateParsing: {
+					Action: ActionFunc[string](func(_ context.Context, link string) (EventType, error) {
+						log = append(log, "execute parsing")
+						if link == "broken" {
+							return Noop, errParsing
+						}
+
+						return eventChoose, nil
+					}),
+					Events:  Events{eventChoose: stateChoice},
+					OnEnter: hook("enter parsing"),
+					OnExit:  hook("exit parsing"),
+				},
+				stateChoice: {
+					Action:  NoopAction[string]{},
+					Events:  Events{eventReset: Default},
+					OnEnter: hook("enter choice"),
+				},
+			})
+			if err != nil {
+				t.Fatalf("new state machine: %v", err)
+			}
+
+			machine.AddListener(func(tr Transition, _ string) {
+				log = append(log, string(tr.From)+" -"+string(tr.Event)+"-> "+string(tr.To))
+			})
+
+			err = machine.SendEvent(ctx, tc.event, tc.eventCtx)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("SendEvent got: %v, expected: %v", err, tc.err)
+			}
+
+			if errors.Is(tc.err, errNoLink) {
+				var rejected *RejectedError
+				if !errors.As(err, &rejected) || !errors.Is(err, ErrEventRejected) || rejected.State != Default {
+					t.Errorf("SendEvent got: %v, expected a rejection in state %s", err, Default)
+				}
+			}
+
+			if errors.Is(tc.err, errParsing) {
+				var failed *ActionError
+				if !errors.As(err, &failed) || failed.State != stateParsing {
+					t.Errorf("SendEvent got: %v, expected a failure in state %s", err, stateParsing)
+				}
+			}
+
+			if machine.Current() != tc.current {
+				t.Errorf("current got: %s, expected: %s", machine.Current(), tc.current)
+			}
+
+			if !reflect.DeepEqual(log, tc.log) {
+				t.Errorf("log got: %q, expected: %q", log, tc.log)
+			}
+		})
+	}
+}
+
+type legacyParsing struct {
+	executed []EventContext
+}
+
+func (l *legacyParsing) Execute(eventCtx EventContext) EventType {
+	l.executed = append(l.executed, eventCtx)
+
+	return eventChoose
+}
+
+func TestAdapt(t *testing.T) {
+	t.Parallel()
+
+	legacy := &legacyParsing{}
+	machine, err := NewStateMachine(States[EventContext]{
+		Default:      {Action: NoopAction[EventContext]{}, Events: Events{eventParse: stateParsing}},
+		stateParsing: {Action: Adapt[EventContext](legacy), Events: Events{eventChoose: stateChoice}},
+		stateChoice:  {Action: NoopAction[EventContext]{}},
+	})
+	if err != nil {
+		t.Fatalf("new state machine: %v", err)
+	}
+
+	if err = machine.SendEvent(context.Background(), eventParse, "link"); err != nil {
+		t.Fatalf("SendEvent: %v", err)
+	}
+
+	if machine.Current() != stateChoice {
+		t.Errorf("current got: %s, expected: %s", machine.Current(), stateChoice)
+	}
+
+	if !reflect.DeepEqual(legacy.executed, []EventContext{"link"}) {
+		t.Errorf("legacy action executed with: %v, expected: %v", legacy.executed, []EventContext{"link"})
+	}
+}
+
+func TestStateMachine_SendEventCallbacksReadMachine(t *testing.T) {
+	t.Parallel()
+
+	errParsing := errors.New("parsing")
+	var machine *StateMachine[string]
+	var log []string
+	seen := func(entry string) {
+		log = append(log, entry+" in "+string(machine.Current()))
+	}
+
+	machine, err := NewStateMachine(States[string]{
+		Default: {
+			Action: NoopAction[string]{},
+			Events: Events{eventParse: stateParsing},
+			Guards: Guards[string]{
+				eventParse: func(context.Context, string) error {
+					seen("guard")
+					return nil
+				},
+			},
+			OnExit: func(context.Context, string) { seen("exit") },
+		},
+		stateParsing: {
+			Action: ActionFunc[string](func(context.Context, string) (EventType, error) {
+				seen("execute")
+				return Noop, errParsing
+			}),
+			OnEnter: func(context.Context, string) { seen("enter") },
+		},
+	})
+	if err != nil {
+		t.Fatalf("new state machine: %v", err)
+	}
+
+	machine.AddListener(func(Transition, string) { seen("listener") })
+
+	done := make(chan error, 1)
+	go func() {
+		done <- machine.SendEvent(context.Background(), eventParse, "link")
+	}()
+
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SendEvent deadlocked on callbacks reading the machine")
+	}
+
+	var failed *ActionError
+	if !errors.As(err, &failed) || !errors.Is(err, errParsing) || failed.State != stateParsing {
+		t.Fatalf("SendEvent got: %v, expected a failure in state %s", err, stateParsing)
+	}
+
+	expected := []string{"guard in init", "exit in init", "enter in parsing", "listener in parsing", "execute in parsing"}
+	if !reflect.DeepEqual(log, expected) {
+		t.Errorf("log got: %q, expected: %q", log, expected)
+	}
+
+	// the transition is committed before the failed action
+	if machine.Current() != stateParsing || machine.Previous() != Default {
+		t.Errorf("current got: %s, previous: %s, expected: %s, %s", machine.Current(), machine.Previous(), stateParsing, Default)
+	}
+}
@@ -0,0 +1,75 @@
+package botstate
+
+import (
+	"fmt"
+	"strings"
+)
+
+type edge struct {
+	from    StateType
+	to      StateType
+	event   EventType
+	guarded bool
+}
+
+// edges returns the transitions of the machine in a stable order, the inherited and implicit timeout ones
+// included. The transitions on BackEvent taken from the history are not known in advance and left out
+func (s States[C]) edges() []edge {
+	var edges []edge
+	for _, name := range s.names() {
+		for _, event := range s.events(name) {
+			target, _ := s.resolve(name, event)
+			edges = append(edges, edge{from: name, to: target, event: event, guarded: s.guard(name, event) != nil})
+		}
+
+		if _, ok := s.resolve(name, TimeoutEvent); !ok && s[name].Timeout > 0 {
+			edges = append(edges, edge{from: name, to: Default, event: TimeoutEvent})
+		}
+	}
+
+	return edges
+}
+
+func (e edge) label() string {
+	label := string(e.event)
+	if e.guarded {
+		label += " [guarded]"
+	}
+
+	return label
+}
+
+// DOT renders the machine as a Graphviz digraph, Default is drawn as the initial state
+func (s States[C]) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph fsm {\n")
+	b.WriteString("\trankdir=LR;\n")
+	for _, name := range s.names() {
+		shape := "box"
+		if name == Default {
+			shape = "doublecircle"
+		}
+
+		fmt.Fprintf(&b, "\t%q [shape=%s];\n", name, shape)
+	}
+
+	for _, e := range s.edges() {
+		fmt.Fprintf(&b, "\t%q -> %q [label=%q];\n", e.from, e.to, e.label())
+	}
+
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+// Mermaid renders the machine as a Mermaid state diagram, Default is drawn as the initial state
+func (s States[C]) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("stateDiagram-v2\n")
+	fmt.Fprintf(&b, "\t[*] --> %s\n", Default)
+	for _, e := range s.edges() {
+		fmt.Fprintf(&b, "\t%s --> %s: %s\n", e.from, e.to, e.label())
+	}
+
+	return b.String()
+}
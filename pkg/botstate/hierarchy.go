@@ -0,0 +1,92 @@
+package botstate
+
+import "sort"
+
+// ancestors returns the state followed by its parents, it stops at an unknown parent or a cycle
+func (s States[C]) ancestors(name StateType) []StateType {
+	chain := []StateType{name}
+	seen := map[StateType]bool{name: true}
+	for {
+		state, ok := s[chain[len(chain)-1]]
+		if !ok || state.Parent == "" || seen[state.Parent] {
+			return chain
+		}
+
+		seen[state.Parent] = true
+		chain = append(chain, state.Parent)
+	}
+}
+
+// resolve returns the target of the event declared by the state or its nearest parent
+func (s States[C]) resolve(name StateType, event EventType) (StateType, bool) {
+	for _, ancestor := range s.ancestors(name) {
+		if target, ok := s[ancestor].Events[event]; ok {
+			return target, true
+		}
+	}
+
+	return "", false
+}
+
+// guard returns the guard of the event declared by the state or its nearest parent
+func (s States[C]) guard(name StateType, event EventType) Guard[C] {
+	for _, ancestor := range s.ancestors(name) {
+		if guard, ok := s[ancestor].Guards[event]; ok {
+			return guard
+		}
+	}
+
+	return nil
+}
+
+// events returns the events the state handles sorted, the ones inherited from its parents included
+func (s States[C]) events(name StateType) []EventType {
+	seen := make(map[EventType]bool)
+	var events []EventType
+	for _, ancestor := range s.ancestors(name) {
+		for event := range s[ancestor].Events {
+			if !seen[event] {
+				seen[event] = true
+				events = append(events, event)
+			}
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i] < events[j] })
+
+	return events
+}
+
+// path returns the states left, innermost first, and entered, outermost first, on the transition between two
+// states. The common parents are neither left nor entered, a transition to the same state leaves and enters it
+func (s States[C]) path(from, to StateType) (exit []StateType, enter []StateType) {
+	if from == to {
+		return []StateType{from}, []StateType{to}
+	}
+
+	fromChain, toChain := s.ancestors(from), s.ancestors(to)
+	common := make(map[StateType]bool, len(toChain))
+	for _, name := range toChain {
+		common[name] = true
+	}
+
+	var lca StateType
+	for _, name := range fromChain {
+		if common[name] {
+			lca = name
+			break
+		}
+
+		exit = append(exit, name)
+	}
+
+	for _, name := range toChain {
+		if name == lca {
+			break
+		}
+
+		enter = append([]StateType{name}, enter...)
+	}
+
+	return exit, enter
+}
@@ -0,0 +1,181 @@
+package botstate
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const (
+	stateSettings StateType = "settings"
+	stateLanguage StateType = "language"
+	stateQuality  StateType = "quality"
+
+	eventSettings EventType = "settings"
+	eventLanguage EventType = "language"
+	eventQuality  EventType = "quality"
+	eventCancel   EventType = "cancel"
+)
+
+func newNestedMachine(t *testing.T, log *[]string) *StateMachine[EventContext] {
+	t.Helper()
+
+	hook := func(entry string) Hook[EventContext] {
+		return func(context.Context, EventContext) { *log = append(*log, entry) }
+	}
+
+	machine, err := NewStateMachine(States[EventContext]{
+		Default: {
+			Action: NoopAction[EventContext]{},
+			Events: Events{eventSettings: stateLanguage},
+			OnExit: hook("exit init"),
+		},
+		stateSettings: {
+			Action:  NoopAction[EventContext]{},
+			Events:  Events{eventCancel: Default, eventLanguage: stateLanguage, eventQuality: stateQuality},
+			OnEnter: hook("enter settings"),
+			OnExit:  hook("exit settings"),
+		},
+		stateLanguage: {
+			Action:  NoopAction[EventContext]{},
+			Parent:  stateSettings,
+			OnEnter: hook("enter language"),
+			OnExit:  hook("exit language"),
+		},
+		stateQuality: {
+			Action:  NoopAction[EventContext]{},
+			Parent:  stateSettings,
+			Events:  Events{eventCancel: stateLanguage},
+			OnEnter: hook("enter quality"),
+			OnExit:  hook("exit quality"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("new state machine: %v", err)
+	}
+
+	return machine
+}
+
+func TestStateMachine_nested(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		events  []EventType
+		current StateType
+		history []StateType
+		log     []string
+		err     error
+	}{
+		{
+			name:    "test_enters_parents_first",
+			events:  []EventType{eventSettings},
+			current: stateLanguage,
+			history: []StateType{Default},
+			log:     []string{"exit init", "enter settings", "enter language"},
+		},
+		{
+			name:    "test_sibling_keeps_parent",
+			events:  []EventType{eventSettings, eventQuality},
+			current: stateQuality,
+			history: []StateType{Default, stateLanguage},
+			log: []string{
+				"exit init", "enter settings", "enter language", "exit language", "enter quality",
+			},
+		},
+		{
+			name:    "test_inherited_event",
+			events:  []EventType{eventSettings, eventCancel},
+			current: Default,
+			history: []StateType{Default, stateLanguage},
+			log: []string{
+				"exit init", "enter settings", "enter language", "exit language", "exit settings",
+			},
+		},
+		{
+			name:    "test_child_overrides_parent",
+			events:  []EventType{eventSettings, eventQuality, eventCancel},
+			current: stateLanguage,
+			history: []StateType{Default, stateLanguage, stateQuality},
+			log: []string{
+				"exit init", "enter settings", "enter language", "exit language", "enter quality",
+				"exit quality", "enter language",
+			},
+		},
+		{
+			name:    "test_back",
+			events:  []EventType{eventSettings, eventQuality, BackEvent, BackEvent},
+			current: Default,
+			log: []string{
+				"exit init", "enter settings", "enter language", "exit language", "enter quality",
+				"exit quality", "enter language", "exit language", "exit settings",
+			},
+		},
+		{
+			name:    "test_back_without_history",
+			events:  []EventType{BackEvent},
+			current: Default,
+			err:     ErrEventRejected,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				log []string
+				err error
+			)
+
+			machine := newNestedMachine(t, &log)
+			for _, event := range tc.events {
+				if err = machine.SendEvent(context.Background(), event, nil); err != nil {
+					break
+				}
+			}
+
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("SendEvent got: %v, expected: %v", err, tc.err)
+			}
+
+			if machine.Current() != tc.current {
+				t.Errorf("current got: %s, expected: %s", machine.Current(), tc.current)
+			}
+
+			if history := machine.History(); !reflect.DeepEqual(history, tc.history) {
+				t.Errorf("history got: %v, expected: %v", history, tc.history)
+			}
+
+			if !reflect.DeepEqual(log, tc.log) {
+				t.Errorf("log got: %q, expected: %q", log, tc.log)
+			}
+		})
+	}
+}
+
+func TestStateMachine_SetHistoryLimit(t *testing.T) {
+	t.Parallel()
+
+	var log []string
+	machine := newNestedMachine(t, &log)
+	machine.SetHistoryLimit(2)
+
+	for _, event := range []EventType{eventSettings, eventQuality, eventLanguage, eventQuality} {
+		if err := machine.SendEvent(context.Background(), event, nil); err != nil {
+			t.Fatalf("SendEvent: %v", err)
+		}
+	}
+
+	expected := []StateType{stateQuality, stateLanguage}
+	if history := machine.History(); !reflect.DeepEqual(history, expected) {
+		t.Errorf("history got: %v, expected: %v", history, expected)
+	}
+
+	if machine.Previous() != stateLanguage {
+		t.Errorf("previous got: %s, expected: %s", machine.Previous(), stateLanguage)
+	}
+}
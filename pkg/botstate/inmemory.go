@@ -1,23 +1,214 @@
 package botstate
 
-import "context"
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type InMemoryConfig struct {
+	// Expiration is the lifetime of a session since it was last set, 0 keeps sessions until they are evicted
+	Expiration time.Duration
+	// MaxEntries bounds the number of sessions, the least recently used one is evicted to fit a new one.
+	// 0 means no bound
+	MaxEntries int
+	// CleanupInterval is how often the janitor removes expired sessions, 0 disables the janitor and expired
+	// sessions are only removed when they are read
+	CleanupInterval time.Duration
+}
 
 var _ Backend = (*InMemoryBackend)(nil)
 
-func NewInMemoryBackend() *InMemoryBackend {
-	return &InMemoryBackend{}
+// NewInMemoryBackend returns the backend keeping sessions in the process, it behaves like RedisBackend.
+// Close stops its janitor
+func NewInMemoryBackend(cfg InMemoryConfig) *InMemoryBackend {
+	b := &InMemoryBackend{
+		cfg:    cfg,
+		ll:     list.New(),
+		items:  make(map[string]*list.Element),
+		timeFn: time.Now,
+		done:   make(chan struct{}),
+	}
+
+	if cfg.CleanupInterval > 0 {
+		go b.janitor(cfg.CleanupInterval)
+	}
+
+	return b
+}
+
+type inMemoryEntry struct {
+	key     string
+	value   []byte
+	version int64
+	expires time.Time
+}
+
+type InMemoryBackend struct {
+	cfg InMemoryConfig
+
+	mtx    sync.Mutex
+	ll     *list.List
+	items  map[string]*list.Element
+	timeFn func() time.Time
+
+	closeOnce sync.Once
+	done      chan struct{}
 }
 
-type InMemoryBackend struct{}
+func (i *InMemoryBackend) Get(ctx context.Context, k string) ([]byte, error) {
+	v, _, err := i.GetVersioned(ctx, k)
+
+	return v, err
+}
+
+func (i *InMemoryBackend) GetVersioned(_ context.Context, k string) ([]byte, int64, error) {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	e, ok := i.lookup(k)
+	if !ok {
+		return nil, 0, ErrSessionNotFound
+	}
+
+	return append([]byte(nil), e.value...), e.version, nil
+}
+
+// Set stores the session unconditionally, its version is incremented
+func (i *InMemoryBackend) Set(_ context.Context, k string, v []byte) error {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	var version int64
+	if e, ok := i.lookup(k); ok {
+		version = e.version
+	}
+
+	i.store(k, v, version+1)
+
+	return nil
+}
+
+func (i *InMemoryBackend) CompareAndSet(_ context.Context, k string, v []byte, version int64) (int64, error) {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	var current int64
+	if e, ok := i.lookup(k); ok {
+		current = e.version
+	}
+
+	if current != version {
+		return 0, ErrSessionConflict
+	}
+
+	i.store(k, v, version+1)
+
+	return version + 1, nil
+}
+
+// Delete removes the session, a missing one is not an error
+func (i *InMemoryBackend) Delete(_ context.Context, k string) error {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	if el, ok := i.items[k]; ok {
+		i.remove(el)
+	}
+
+	return nil
+}
+
+// Len returns the number of stored sessions, expired ones not yet removed included
+func (i *InMemoryBackend) Len() int {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	return i.ll.Len()
+}
+
+// Close stops the janitor
+func (i *InMemoryBackend) Close() error {
+	i.closeOnce.Do(func() {
+		close(i.done)
+	})
+
+	return nil
+}
+
+func (i *InMemoryBackend) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-i.done:
+			return
+		case <-ticker.C:
+			i.removeExpired()
+		}
+	}
+}
+
+func (i *InMemoryBackend) removeExpired() {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	now := i.timeFn()
+	for el := i.ll.Front(); el != nil; {
+		next := el.Next()
+		if i.expired(el.Value.(*inMemoryEntry), now) {
+			i.remove(el)
+		}
+
+		el = next
+	}
+}
+
+// lookup returns the live entry of the key, an expired one is removed
+func (i *InMemoryBackend) lookup(k string) (*inMemoryEntry, bool) {
+	el, ok := i.items[k]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*inMemoryEntry)
+	if i.expired(e, i.timeFn()) {
+		i.remove(el)
+
+		return nil, false
+	}
+
+	i.ll.MoveToFront(el)
+
+	return e, true
+}
+
+func (i *InMemoryBackend) store(k string, v []byte, version int64) {
+	e := &inMemoryEntry{key: k, value: append([]byte(nil), v...), version: version}
+	if i.cfg.Expiration > 0 {
+		e.expires = i.timeFn().Add(i.cfg.Expiration)
+	}
+
+	if el, ok := i.items[k]; ok {
+		el.Value = e
+		i.ll.MoveToFront(el)
+
+		return
+	}
 
-func (i InMemoryBackend) Get(ctx context.Context, k string) ([]byte, error) {
-	panic("implement me")
+	i.items[k] = i.ll.PushFront(e)
+	for i.cfg.MaxEntries > 0 && i.ll.Len() > i.cfg.MaxEntries {
+		i.remove(i.ll.Back())
+	}
 }
 
-func (i InMemoryBackend) Set(ctx context.Context, k string, v []byte) error {
-	panic("implement me")
+func (i *InMemoryBackend) expired(e *inMemoryEntry, now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
 }
 
-func (i InMemoryBackend) Delete(ctx context.Context, k string) error {
-	panic("implement me")
+func (i *InMemoryBackend) remove(el *list.Element) {
+	i.ll.Remove(el)
+	delete(i.items, el.Value.(*inMemoryEntry).key)
 }
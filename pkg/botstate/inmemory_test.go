@@ -0,0 +1,227 @@
+package botstate
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInMemoryBackend(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2021, 10, 19, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name       string
+		maxEntries int
+		// set are the keys set in order, a minute apart
+		set     []string
+		deleted []string
+		// elapsed is the time passed since the first set when the sessions are read
+		elapsed  time.Duration
+		found    []string
+		notFound []string
+	}{
+		{
+			name:     "test_not_found",
+			notFound: []string{"1"},
+		},
+		{
+			name:  "test_found",
+			set:   []string{"1", "2"},
+			found: []string{"1", "2"},
+		},
+		{
+			name:     "test_deleted",
+			set:      []string{"1", "2"},
+			deleted:  []string{"1", "3"},
+			found:    []string{"2"},
+			notFound: []string{"1"},
+		},
+		{
+			name:     "test_expired",
+			set:      []string{"1", "2"},
+			elapsed:  time.Hour,
+			found:    []string{"2"},
+			notFound: []string{"1"},
+		},
+		{
+			name:     "test_set_again_prolongs",
+			set:      []string{"1", "2", "1"},
+			elapsed:  time.Hour + time.Minute,
+			found:    []string{"1"},
+			notFound: []string{"2"},
+		},
+		{
+			name:       "test_evicts_least_recently_used",
+			maxEntries: 2,
+			set:        []string{"1", "2", "1", "3"},
+			found:      []string{"1", "3"},
+			notFound:   []string{"2"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			clock := now
+			b := NewInMemoryBackend(InMemoryConfig{Expiration: time.Hour, MaxEntries: tc.maxEntries})
+			b.timeFn = func() time.Time { return clock }
+
+			for _, k := range tc.set {
+				clock = clock.Add(time.Minute)
+				if err := b.Set(ctx, k, []byte("state "+k)); err != nil {
+					t.Fatalf("set: %v", err)
+				}
+			}
+
+			for _, k := range tc.deleted {
+				if err := b.Delete(ctx, k); err != nil {
+					t.Fatalf("delete: %v", err)
+				}
+			}
+
+			clock = now.Add(time.Minute + tc.elapsed)
+			for _, k := range tc.found {
+				v, err := b.Get(ctx, k)
+				if err != nil {
+					t.Fatalf("get %s: %v", k, err)
+				}
+
+				if string(v) != "state "+k {
+					t.Errorf("get %s got: %q, expected: %q", k, v, "state "+k)
+				}
+			}
+
+			for _, k := range tc.notFound {
+				if _, err := b.Get(ctx, k); !errors.Is(err, ErrSessionNotFound) {
+					t.Errorf("get %s got: %v, expected: %v", k, err, ErrSessionNotFound)
+				}
+			}
+		})
+	}
+}
+
+func TestInMemoryBackend_copies(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	b := NewInMemoryBackend(InMemoryConfig{})
+
+	v := []byte("state")
+	if err := b.Set(ctx, "1", v); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	v[0] = 'x'
+	got, err := b.Get(ctx, "1")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+
+	got[1] = 'x'
+	if got, _ = b.Get(ctx, "1"); string(got) != "state" {
+		t.Errorf("get got: %q, expected: %q", got, "state")
+	}
+}
+
+func TestInMemoryBackend_janitor(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	b := NewInMemoryBackend(InMemoryConfig{Expiration: 10 * time.Millisecond, CleanupInterval: 5 * time.Millisecond})
+	defer b.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := b.Set(ctx, strconv.Itoa(i), []byte("state")); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for b.Len() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("janitor left %d expired sessions", b.Len())
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestInMemoryBackend_concurrent(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	b := NewInMemoryBackend(InMemoryConfig{Expiration: time.Minute, MaxEntries: 16, CleanupInterval: time.Millisecond})
+	defer b.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				k := strconv.Itoa((i * j) % 32)
+				if err := b.Set(ctx, k, []byte(k)); err != nil {
+					t.Errorf("set: %v", err)
+				}
+
+				if _, err := b.Get(ctx, k); err != nil && !errors.Is(err, ErrSessionNotFound) {
+					t.Errorf("get: %v", err)
+				}
+
+				if err := b.Delete(ctx, strconv.Itoa(j%32)); err != nil {
+					t.Errorf("delete: %v", err)
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if b.Len() > 16 {
+		t.Errorf("stored sessions got: %d, expected at most: %d", b.Len(), 16)
+	}
+}
+
+func TestInMemoryBackend_CompareAndSet(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	b := NewInMemoryBackend(InMemoryConfig{})
+
+	version, err := b.CompareAndSet(ctx, "1", []byte("first"), 0)
+	if err != nil || version != 1 {
+		t.Fatalf("compare and set of a new session got: %d %v, expected: 1", version, err)
+	}
+
+	if _, err = b.CompareAndSet(ctx, "1", []byte("stale"), 0); !errors.Is(err, ErrSessionConflict) {
+		t.Errorf("compare and set of a stale version got: %v, expected: %v", err, ErrSessionConflict)
+	}
+
+	if err = b.Set(ctx, "1", []byte("second")); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	v, version, err := b.GetVersioned(ctx, "1")
+	if err != nil || string(v) != "second" || version != 2 {
+		t.Fatalf("get versioned got: %q %d %v, expected: %q 2", v, version, err, "second")
+	}
+
+	if version, err = b.CompareAndSet(ctx, "1", []byte("third"), version); err != nil || version != 3 {
+		t.Errorf("compare and set got: %d %v, expected: 3", version, err)
+	}
+
+	if err = b.Delete(ctx, "1"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	// a deleted session starts over from version 0
+	if version, err = b.CompareAndSet(ctx, "1", []byte("new"), 0); err != nil || version != 1 {
+		t.Errorf("compare and set of a deleted session got: %d %v, expected: 1", version, err)
+	}
+}
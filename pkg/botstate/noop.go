@@ -18,6 +18,14 @@ func (n NoopBackend) Set(_ context.Context, _ string, _ []byte) error {
 	return nil
 }
 
+func (n NoopBackend) GetVersioned(_ context.Context, _ string) ([]byte, int64, error) {
+	return nil, 0, nil
+}
+
+func (n NoopBackend) CompareAndSet(_ context.Context, _ string, _ []byte, version int64) (int64, error) {
+	return version + 1, nil
+}
+
 func (n NoopBackend) Delete(_ context.Context, _ string) error {
 	return nil
 }
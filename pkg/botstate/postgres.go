@@ -0,0 +1,188 @@
+package botstate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type PostgresConfig struct {
+	// Expiration is the lifetime of a session since it was last set, 0 keeps sessions until they are deleted
+	Expiration time.Duration
+	// CleanupInterval is how often the janitor deletes expired sessions, 0 disables the janitor and expired
+	// sessions are only skipped when they are read
+	CleanupInterval time.Duration
+}
+
+var _ Backend = (*PostgresBackend)(nil)
+
+// NewPostgres returns the backend keeping sessions in the sessions table of the pool:
+//
+//	CREATE TABLE sessions
+//	(
+//	    key        TEXT PRIMARY KEY,
+//	    data       BYTEA  NOT NULL,
+//	    version    BIGINT NOT NULL,
+//	    expires_at TIMESTAMP WITH TIME ZONE
+//	);
+//
+// Close stops its janitor, the pool is left open
+func NewPostgres(pool *pgxpool.Pool, cfg PostgresConfig) *PostgresBackend {
+	b := &PostgresBackend{
+		cfg:    cfg,
+		pool:   pool,
+		timeFn: time.Now,
+		done:   make(chan struct{}),
+	}
+
+	if cfg.CleanupInterval > 0 {
+		go b.janitor(cfg.CleanupInterval)
+	}
+
+	return b
+}
+
+type PostgresBackend struct {
+	cfg    PostgresConfig
+	pool   *pgxpool.Pool
+	timeFn func() time.Time
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (p *PostgresBackend) Get(ctx context.Context, k string) ([]byte, error) {
+	v, _, err := p.GetVersioned(ctx, k)
+
+	return v, err
+}
+
+func (p *PostgresBackend) GetVersioned(ctx context.Context, k string) ([]byte, int64, error) {
+	var (
+		data    []byte
+		version int64
+	)
+
+	if err := p.pool.QueryRow(ctx, `
+		SELECT data, version FROM sessions WHERE key = $1 AND (expires_at IS NULL OR expires_at > $2)
+	`, k, p.timeFn()).Scan(&data, &version); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, 0, ErrSessionNotFound
+		}
+
+		return nil, 0, fmt.Errorf("postgres get: %w", err)
+	}
+
+	return data, version, nil
+}
+
+// Set stores the session unconditionally, its version is incremented
+func (p *PostgresBackend) Set(ctx context.Context, k string, v []byte) error {
+	if _, err := p.pool.Exec(ctx, `
+		INSERT INTO sessions (key, data, version, expires_at) VALUES ($1, $2, 1, $3)
+		ON CONFLICT (key) DO UPDATE
+		SET data = EXCLUDED.data, version = sessions.version + 1, expires_at = EXCLUDED.expires_at
+	`, k, v, p.expiresAt()); err != nil {
+		return fmt.Errorf("postgres set: %w", err)
+	}
+
+	return nil
+}
+
+// CompareAndSet stores the session when its version still equals version, an expired session counts as
+// missing and starts over from version 1
+func (p *PostgresBackend) CompareAndSet(ctx context.Context, k string, v []byte, version int64) (int64, error) {
+	var (
+		next int64
+		row  pgx.Row
+	)
+
+	now := p.timeFn()
+	if version == 0 {
+		row = p.pool.QueryRow(ctx, `
+			INSERT INTO sessions (key, data, version, expires_at) VALUES ($1, $2, 1, $3)
+			ON CONFLICT (key) DO UPDATE
+			SET data = EXCLUDED.data, version = 1, expires_at = EXCLUDED.expires_at
+			WHERE sessions.expires_at IS NOT NULL AND sessions.expires_at <= $4
+			RETURNING version
+		`, k, v, p.expiresAt(), now)
+	} else {
+		row = p.pool.QueryRow(ctx, `
+			UPDATE sessions SET data = $2, version = version + 1, expires_at = $3
+			WHERE key = $1 AND version = $4 AND (expires_at IS NULL OR expires_at > $5)
+			RETURNING version
+		`, k, v, p.expiresAt(), version, now)
+	}
+
+	if err := row.Scan(&next); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrSessionConflict
+		}
+
+		return 0, fmt.Errorf("postgres compare and set: %w", err)
+	}
+
+	return next, nil
+}
+
+// Delete removes the session, a missing one is not an error
+func (p *PostgresBackend) Delete(ctx context.Context, k string) error {
+	if _, err := p.pool.Exec(ctx, `DELETE FROM sessions WHERE key = $1`, k); err != nil {
+		return fmt.Errorf("postgres delete: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteExpired deletes the expired sessions
+func (p *PostgresBackend) DeleteExpired(ctx context.Context) error {
+	if _, err := p.pool.Exec(
+		ctx, `DELETE FROM sessions WHERE expires_at IS NOT NULL AND expires_at <= $1`, p.timeFn(),
+	); err != nil {
+		return fmt.Errorf("postgres delete expired: %w", err)
+	}
+
+	return nil
+}
+
+// Close stops the janitor
+func (p *PostgresBackend) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+
+	return nil
+}
+
+func (p *PostgresBackend) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			// a failed cleanup is retried on the next tick, reads skip expired sessions anyway
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			_ = p.DeleteExpired(ctx)
+			cancel()
+		}
+	}
+}
+
+// expiresAt returns the expiry of a session set now, nil when sessions do not expire
+func (p *PostgresBackend) expiresAt() *time.Time {
+	if p.cfg.Expiration <= 0 {
+		return nil
+	}
+
+	expires := p.timeFn().Add(p.cfg.Expiration)
+
+	return &expires
+}
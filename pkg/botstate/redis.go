@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -18,6 +19,23 @@ type RedisConfig struct {
 	Network string
 	// host:port address.
 	Addr string
+	// Addrs are the host:port addresses of the Sentinel or Cluster nodes, Addr is used when it is empty.
+	Addrs []string
+	// MasterName is the name of the master monitored by Sentinel, it selects the Sentinel failover client.
+	MasterName string
+	// Password of the Sentinel nodes.
+	SentinelPassword string
+	// Cluster selects the Redis Cluster client.
+	Cluster bool
+	// The maximum number of retries of a command redirected by the cluster.
+	// Default is 3 retries.
+	MaxRedirects int
+	// ReadOnly enables read-only commands on the replicas of the cluster.
+	ReadOnly bool
+	// RouteByLatency routes read-only commands of the cluster to the closest master or replica node.
+	RouteByLatency bool
+	// RouteRandomly routes read-only commands of the cluster to a random master or replica node.
+	RouteRandomly bool
 	// Dialer creates new network connection and has priority over
 	// Network and Addr options.
 	Dialer func(ctx context.Context, network, addr string) (net.Conn, error)
@@ -82,33 +100,64 @@ type RedisConfig struct {
 	TLSConfig *tls.Config
 }
 
+// NewRedisClient returns the client of the deployment the config describes: the Sentinel failover client when
+// MasterName is set, the Cluster client when Cluster is and the single node client otherwise
+func NewRedisClient(opt RedisConfig) redis.UniversalClient {
+	addrs := opt.Addrs
+	if len(addrs) == 0 && opt.Addr != "" {
+		addrs = []string{opt.Addr}
+	}
+
+	universal := &redis.UniversalOptions{
+		Addrs:              addrs,
+		DB:                 opt.DB,
+		Dialer:             opt.Dialer,
+		Username:           opt.Username,
+		Password:           opt.Password,
+		SentinelPassword:   opt.SentinelPassword,
+		MaxRetries:         opt.MaxRetries,
+		MinRetryBackoff:    opt.MinRetryBackoff,
+		MaxRetryBackoff:    opt.MaxRetryBackoff,
+		DialTimeout:        opt.DialTimeout,
+		ReadTimeout:        opt.ReadTimeout,
+		WriteTimeout:       opt.WriteTimeout,
+		PoolSize:           opt.PoolSize,
+		MinIdleConns:       opt.MinIdleConns,
+		MaxConnAge:         opt.MaxConnAge,
+		PoolTimeout:        opt.PoolTimeout,
+		IdleTimeout:        opt.IdleTimeout,
+		IdleCheckFrequency: opt.IdleCheckFrequency,
+		TLSConfig:          opt.TLSConfig,
+		MaxRedirects:       opt.MaxRedirects,
+		ReadOnly:           opt.ReadOnly,
+		RouteByLatency:     opt.RouteByLatency,
+		RouteRandomly:      opt.RouteRandomly,
+		MasterName:         opt.MasterName,
+	}
+
+	switch {
+	case opt.MasterName != "":
+		return redis.NewFailoverClient(universal.Failover())
+	case opt.Cluster:
+		return redis.NewClusterClient(universal.Cluster())
+	}
+
+	options := universal.Simple()
+	options.Network = opt.Network
+
+	return redis.NewClient(options)
+}
+
+// NewRedis returns the backend keeping sessions in redis, every session is a single hash so the backend works
+// with Redis Cluster
 func NewRedis(opt RedisConfig) (*RedisBackend, error) {
 	r := &RedisBackend{
+		ctx:        context.Background(),
 		expiration: opt.Expiration,
-		client: redis.NewClient(&redis.Options{
-			Network:            opt.Network,
-			Addr:               opt.Addr,
-			Dialer:             opt.Dialer,
-			Username:           opt.Username,
-			Password:           opt.Password,
-			DB:                 opt.DB,
-			MaxRetries:         opt.MaxRetries,
-			MinRetryBackoff:    opt.MinRetryBackoff,
-			MaxRetryBackoff:    opt.MaxRetryBackoff,
-			DialTimeout:        opt.DialTimeout,
-			ReadTimeout:        opt.ReadTimeout,
-			WriteTimeout:       opt.WriteTimeout,
-			PoolSize:           opt.PoolSize,
-			MinIdleConns:       opt.MinIdleConns,
-			MaxConnAge:         opt.MaxConnAge,
-			PoolTimeout:        opt.PoolTimeout,
-			IdleTimeout:        opt.IdleTimeout,
-			IdleCheckFrequency: opt.IdleCheckFrequency,
-			TLSConfig:          opt.TLSConfig,
-		}),
-	}
-
-	if err := r.client.Ping(context.Background()).Err(); err != nil {
+		client:     NewRedisClient(opt),
+	}
+
+	if err := r.client.Ping(r.ctx).Err(); err != nil {
 		return nil, fmt.Errorf("redis ping: %w", err)
 	}
 
@@ -120,7 +169,7 @@ var _ Backend = (*RedisBackend)(nil)
 type RedisBackend struct {
 	ctx        context.Context
 	expiration time.Duration
-	client     *redis.Client
+	client     redis.UniversalClient
 }
 
 func (r *RedisBackend) Ping() error {
@@ -131,30 +180,145 @@ func (r *RedisBackend) Ping() error {
 	return nil
 }
 
+// Close closes the client
+func (r *RedisBackend) Close() error {
+	if err := r.client.Close(); err != nil {
+		return fmt.Errorf("close redis: %w", err)
+	}
+
+	return nil
+}
+
+// sessionKey returns the key of the hash holding the session data and its version. Sessions stored by older
+// releases as a string under the plain key are moved into the hash by GetVersioned
+func (r RedisBackend) sessionKey(k string) string {
+	return redisKeyPrefix + k
+}
+
+const (
+	redisKeyPrefix    = "botstate:"
+	redisFieldData    = "data"
+	redisFieldVersion = "version"
+)
+
+// compareAndSetScript stores the data when the version field still equals ARGV[2], a missing session has
+// version 0. It returns the new version or -1 on a conflict
+var compareAndSetScript = redis.NewScript(`
+local current = tonumber(redis.call('HGET', KEYS[1], 'version') or '0')
+if current ~= tonumber(ARGV[2]) then
+	return -1
+end
+local version = redis.call('HINCRBY', KEYS[1], 'version', 1)
+redis.call('HSET', KEYS[1], 'data', ARGV[1])
+if tonumber(ARGV[3]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+end
+return version
+`)
+
 func (r RedisBackend) Get(ctx context.Context, k string) ([]byte, error) {
-	v, err := r.client.Get(ctx, k).Bytes()
+	v, _, err := r.GetVersioned(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func (r RedisBackend) GetVersioned(ctx context.Context, k string) ([]byte, int64, error) {
+	values, err := r.client.HMGet(ctx, r.sessionKey(k), redisFieldData, redisFieldVersion).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("redis get: %w", err)
+	}
+
+	data, ok := values[0].(string)
+	if !ok {
+		return r.migrateLegacy(ctx, k)
+	}
+
+	var version int64
+	if raw, ok := values[1].(string); ok {
+		if version, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			return nil, 0, fmt.Errorf("parse session version: %w", err)
+		}
+	}
+
+	return []byte(data), version, nil
+}
+
+// migrateLegacy moves the session an older release stored as a string under the plain key into the hash.
+// The legacy key is dropped only once the hash holds the session, a session written to the hash meanwhile
+// wins over it
+func (r RedisBackend) migrateLegacy(ctx context.Context, k string) ([]byte, int64, error) {
+	data, err := r.client.Get(ctx, k).Bytes()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
-			return nil, ErrSessionNotFound
+			return nil, 0, ErrSessionNotFound
 		}
 
-		return nil, fmt.Errorf("redis get: %w", err)
+		return nil, 0, fmt.Errorf("redis get legacy session: %w", err)
 	}
 
-	return v, nil
+	if _, err = decodeState(data); err != nil {
+		return nil, 0, fmt.Errorf("decode legacy session: %w", err)
+	}
+
+	version, err := r.CompareAndSet(ctx, k, data, 0)
+	if err != nil && !errors.Is(err, ErrSessionConflict) {
+		return nil, 0, fmt.Errorf("move legacy session: %w", err)
+	}
+
+	if err = r.client.Del(ctx, k).Err(); err != nil {
+		return nil, 0, fmt.Errorf("redis delete legacy session: %w", err)
+	}
+
+	if version == 0 {
+		return r.GetVersioned(ctx, k)
+	}
+
+	return data, version, nil
 }
 
+// Set stores the session unconditionally, its version is incremented
 func (r RedisBackend) Set(ctx context.Context, k string, v []byte) error {
-	if err := r.client.Set(ctx, k, v, r.expiration).Err(); err != nil {
+	key := r.sessionKey(k)
+	if _, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, redisFieldData, v)
+		pipe.HIncrBy(ctx, key, redisFieldVersion, 1)
+		if r.expiration > 0 {
+			pipe.PExpire(ctx, key, r.expiration)
+		}
+
+		return nil
+	}); err != nil {
 		return fmt.Errorf("unable set value: %w", err)
 	}
 
 	return nil
 }
 
+func (r RedisBackend) CompareAndSet(ctx context.Context, k string, v []byte, version int64) (int64, error) {
+	next, err := compareAndSetScript.Run(
+		ctx, r.client, []string{r.sessionKey(k)}, v, version, r.expiration.Milliseconds(),
+	).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("redis compare and set: %w", err)
+	}
+
+	if next < 0 {
+		return 0, ErrSessionConflict
+	}
+
+	return next, nil
+}
+
+// Delete removes the session and the legacy key of an older release, so the session is not moved back later.
+// The keys are deleted one by one, they may live in different slots of a cluster
 func (r RedisBackend) Delete(ctx context.Context, k string) error {
-	if err := r.client.Del(ctx, k).Err(); err != nil {
-		return fmt.Errorf("redis delete: %w", err)
+	for _, key := range []string{r.sessionKey(k), k} {
+		if err := r.client.Del(ctx, key).Err(); err != nil {
+			return fmt.Errorf("redis delete: %w", err)
+		}
 	}
 
 	return nil
@@ -0,0 +1,62 @@
+package botstate
+
+import (
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestNewRedisClient(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		cfg      RedisConfig
+		expected string
+	}{
+		{
+			name:     "test_single",
+			cfg:      RedisConfig{Addr: "localhost:6379", Addrs: []string{"localhost:6380"}},
+			expected: "localhost:6380",
+		},
+		{
+			name:     "test_single_addr",
+			cfg:      RedisConfig{Addr: "localhost:6379"},
+			expected: "localhost:6379",
+		},
+		{
+			name:     "test_sentinel",
+			cfg:      RedisConfig{Addrs: []string{"localhost:26379"}, MasterName: "master"},
+			expected: "sentinel",
+		},
+		{
+			name:     "test_cluster",
+			cfg:      RedisConfig{Addr: "localhost:7000", Cluster: true},
+			expected: "cluster",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			client := NewRedisClient(tc.cfg)
+			defer client.Close()
+
+			var got string
+			switch c := client.(type) {
+			case *redis.ClusterClient:
+				got = "cluster"
+			case *redis.Client:
+				got = c.Options().Addr
+				if got == "FailoverClient" {
+					got = "sentinel"
+				}
+			}
+
+			if got != tc.expected {
+				t.Errorf("client got: %s, expected: %s", got, tc.expected)
+			}
+		})
+	}
+}
@@ -5,83 +5,228 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 )
 
 var (
 	ErrEventRejected   = errors.New("event rejected")
-	ErrSessionNotFound = errors.New("not found")
-	ErrStateNotFound   = errors.New("not found")
+	ErrSessionNotFound = errors.New("session not found")
+	ErrStateNotFound   = errors.New("state not found")
+	// ErrSessionVersion is returned by Load for a session written by a newer version of the package
+	ErrSessionVersion = errors.New("unsupported session version")
+	// ErrSessionConflict is returned by Flush when the session was changed in the backend since it was loaded
+	ErrSessionConflict = errors.New("session changed concurrently")
 )
 
 type Backend interface {
 	Get(ctx context.Context, k string) ([]byte, error)
 	Set(ctx context.Context, k string, v []byte) error
 	Delete(ctx context.Context, k string) error
+	// GetVersioned returns the value with its version, it is ErrSessionNotFound for a missing key
+	GetVersioned(ctx context.Context, k string) ([]byte, int64, error)
+	// CompareAndSet stores the value when the stored version still equals version, a missing key has version 0.
+	// It returns the new version or ErrSessionConflict
+	CompareAndSet(ctx context.Context, k string, v []byte, version int64) (int64, error)
 }
 
+// SessionVersion is the version of the session encoding written by Flush. Sessions of version 0 were stored
+// before the data bag existed, they load with an empty one
+const SessionVersion = 1
+
 type StateEncoded struct {
-	Current  StateType `json:"current"`
-	Previous StateType `json:"previous"`
+	Version  int                        `json:"version,omitempty"`
+	Current  StateType                  `json:"current"`
+	Previous StateType                  `json:"previous"`
+	Data     map[string]json.RawMessage `json:"data,omitempty"`
+	// History are the states the session came from, sessions stored without it have Previous only
+	History []StateType `json:"history,omitempty"`
+	// EnteredAt is when the current state was entered, sessions stored without it are timed from their load
+	EnteredAt time.Time `json:"entered_at"`
 }
 
 type Options struct{}
 
-func NewSession(identity string, backend Backend, state *StateMachine) *Session {
-	return &Session{identity: identity, backend: backend, StateMachine: state}
+func NewSession[C any](identity string, backend Backend, state *StateMachine[C]) *Session[C] {
+	return &Session[C]{identity: identity, backend: backend, StateMachine: state}
 }
 
-type Session struct {
-	*StateMachine
+type Session[C any] struct {
+	*StateMachine[C]
 	identity string
 	backend  Backend
+	data     map[string]json.RawMessage
+	timedOut StateType
+	// timeoutCtx is the event context of the TimeoutEvent sent by Load
+	timeoutCtx C
+	// version is the backend version of the session as of the last Load or Flush
+	version int64
+}
+
+// TimedOut returns the state the session was reset from by the last Load, it is empty when the session
+// did not time out
+func (s *Session[C]) TimedOut() StateType {
+	return s.timedOut
+}
+
+// SetTimeoutContext sets the event context Load sends TimeoutEvent with, the zero one is used by default
+func (s *Session[C]) SetTimeoutContext(eventCtx C) {
+	s.timeoutCtx = eventCtx
+}
+
+// Data is the data bag of a session, it is implemented by every Session
+type Data interface {
+	values() *map[string]json.RawMessage
+}
+
+func (s *Session[C]) values() *map[string]json.RawMessage {
+	return &s.data
+}
+
+// Key is a typed key of the session data, its values are JSON encoded
+type Key[T any] string
+
+// Get returns the value of the key, ok is false when the session has no such value
+func (k Key[T]) Get(s Data) (value T, ok bool, err error) {
+	raw, ok := (*s.values())[string(k)]
+	if !ok {
+		return value, false, nil
+	}
+
+	if err = json.Unmarshal(raw, &value); err != nil {
+		return value, false, fmt.Errorf("unmarshal session data %s: %w", k, err)
+	}
+
+	return value, true, nil
 }
 
-func (s *Session) Clean(ctx context.Context) error {
+// Set stores the value of the key, it is saved by the next Flush
+func (k Key[T]) Set(s Data, value T) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("marshal session data %s: %w", k, err)
+	}
+
+	data := s.values()
+	if *data == nil {
+		*data = make(map[string]json.RawMessage)
+	}
+
+	(*data)[string(k)] = raw
+
+	return nil
+}
+
+// Delete removes the value of the key
+func (k Key[T]) Delete(s Data) {
+	delete(*s.values(), string(k))
+}
+
+// Clean removes the session from the backend and drops its data
+func (s *Session[C]) Clean(ctx context.Context) error {
 	if err := s.backend.Delete(ctx, s.identity); err != nil {
 		return fmt.Errorf("unable delete state: %w", err)
 	}
 
+	s.data = nil
+	s.version = 0
+
 	return nil
 }
 
-// Flush save fsm state to backend
-func (s *Session) Flush(ctx context.Context) error {
-	encoded, err := json.Marshal(StateEncoded{Current: s.curr, Previous: s.prev})
+// Flush save fsm state and session data to backend. It returns ErrSessionConflict when the session was
+// changed since it was loaded, the caller may Load it again and retry the event
+func (s *Session[C]) Flush(ctx context.Context) error {
+	encoded, err := json.Marshal(
+		StateEncoded{
+			Version:   SessionVersion,
+			Current:   s.curr,
+			Previous:  s.Previous(),
+			Data:      s.data,
+			History:   s.history,
+			EnteredAt: s.entered,
+		},
+	)
 	if err != nil {
 		return fmt.Errorf("marshal json: %w", err)
 	}
 
-	if err = s.backend.Set(ctx, s.identity, encoded); err != nil {
+	version, err := s.backend.CompareAndSet(ctx, s.identity, encoded, s.version)
+	if err != nil {
 		return fmt.Errorf("unable flush state: %w", err)
 	}
 
+	s.version = version
+
 	return nil
 }
 
-// Load method load session data from backend and current state
-func (s *Session) Load(ctx context.Context) error {
+// Load method load session data from backend and current state. A session that stayed in its state longer than
+// the state timeout is moved on by TimeoutEvent, sent with the context of SetTimeoutContext, see TimedOut
+func (s *Session[C]) Load(ctx context.Context) error {
 	var state StateEncoded
+	s.timedOut = ""
 	// load state from backend
-	bytes, err := s.backend.Get(ctx, s.identity)
-	if err != nil {
-		if errors.Is(err, ErrSessionNotFound) {
-			// load default state
-			s.curr = Default
+	bytes, version, err := s.backend.GetVersioned(ctx, s.identity)
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return fmt.Errorf("get state from session: %w", err)
+	}
 
-			return nil
-		}
+	// the noop backend stores nothing and finds nothing
+	if errors.Is(err, ErrSessionNotFound) || len(bytes) == 0 {
+		// load default state
+		s.curr = Default
+		s.history = nil
+		s.data = nil
+		s.entered = time.Time{}
+		s.version = 0
 
-		return fmt.Errorf("get state from session: %w", err)
+		return nil
 	}
 
-	// unmarshal state
-	if err = json.Unmarshal(bytes, &state); err != nil {
-		return fmt.Errorf("unable marshal: %w", err)
+	if state, err = decodeState(bytes); err != nil {
+		return err
 	}
 
 	// set state from backend
 	s.curr = state.Current
-	s.prev = state.Previous
+	s.history = state.History
+	if s.history == nil && state.Previous != "" {
+		s.history = []StateType{state.Previous}
+	}
+
+	s.trimHistory()
+
+	s.data = state.Data
+	s.entered = state.EnteredAt
+	if s.entered.IsZero() {
+		// the session was stored before EnteredAt, its state is timed from now on and times out on a later load
+		s.entered = s.timeFn()
+	}
+
+	s.version = version
+
+	if s.Expired() {
+		timedOut := s.curr
+		if err = s.SendEvent(ctx, TimeoutEvent, s.timeoutCtx); err != nil {
+			return fmt.Errorf("send timeout event: %w", err)
+		}
+
+		s.timedOut = timedOut
+	}
 
 	return nil
 }
+
+// decodeState decodes a session of any version up to SessionVersion
+func decodeState(b []byte) (StateEncoded, error) {
+	var state StateEncoded
+	if err := json.Unmarshal(b, &state); err != nil {
+		return state, fmt.Errorf("unable marshal: %w", err)
+	}
+
+	if state.Version > SessionVersion {
+		return state, fmt.Errorf("%w: %d", ErrSessionVersion, state.Version)
+	}
+
+	return state, nil
+}
@@ -0,0 +1,448 @@
+package botstate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type formatChoice struct {
+	VideoID string   `json:"video_id"`
+	Formats []string `json:"formats"`
+}
+
+var (
+	keyChoice = Key[formatChoice]("choice")
+	keyPage   = Key[int]("page")
+)
+
+func TestSession_data(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend := NewInMemoryBackend(InMemoryConfig{})
+	choice := formatChoice{VideoID: "video", Formats: []string{"hd720", "medium"}}
+
+	session := NewSession("1", backend, newTestMachine(t))
+	if err := session.Load(ctx); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if _, ok, err := keyChoice.Get(session); ok || err != nil {
+		t.Fatalf("get from new session got: %v %v, expected nothing", ok, err)
+	}
+
+	if err := keyChoice.Set(session, choice); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	if err := keyPage.Set(session, 2); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	keyPage.Delete(session)
+	if err := session.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	loaded := NewSession("1", backend, newTestMachine(t))
+	if err := loaded.Load(ctx); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	got, ok, err := keyChoice.Get(loaded)
+	if err != nil || !ok {
+		t.Fatalf("get got: %v %v, expected a value", ok, err)
+	}
+
+	if !reflect.DeepEqual(got, choice) {
+		t.Errorf("get got: %+v, expected: %+v", got, choice)
+	}
+
+	if _, ok, _ = keyPage.Get(loaded); ok {
+		t.Errorf("deleted value is loaded")
+	}
+
+	// a value of another type under the key is an error, not a zero value
+	if _, _, err = Key[int]("choice").Get(loaded); err == nil {
+		t.Errorf("get of a mistyped value got: nil, expected an error")
+	}
+
+	if err = loaded.Clean(ctx); err != nil {
+		t.Fatalf("clean: %v", err)
+	}
+
+	if _, ok, _ = keyChoice.Get(loaded); ok {
+		t.Errorf("cleaned session keeps its data")
+	}
+}
+
+func TestSession_Load(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		stored   string
+		current  StateType
+		previous StateType
+		data     bool
+		err      error
+	}{
+		{
+			name:    "test_not_found",
+			current: Default,
+		},
+		{
+			name:     "test_unversioned",
+			stored:   `{"current":"parsing","previous":"init"}`,
+			current:  "parsing",
+			previous: Default,
+		},
+		{
+			name:     "test_current",
+			stored:   `{"version":1,"current":"parsing","previous":"init","data":{"page":3}}`,
+			current:  "parsing",
+			previous: Default,
+			data:     true,
+		},
+		{
+			name:   "test_newer",
+			stored: `{"version":2,"current":"parsing"}`,
+			err:    ErrSessionVersion,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			backend := NewInMemoryBackend(InMemoryConfig{})
+			if tc.stored != "" {
+				if err := backend.Set(ctx, "1", []byte(tc.stored)); err != nil {
+					t.Fatalf("set: %v", err)
+				}
+			}
+
+			session := NewSession("1", backend, newTestMachine(t))
+			err := session.Load(ctx)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("load got: %v, expected: %v", err, tc.err)
+			}
+
+			if tc.err != nil {
+				return
+			}
+
+			if session.Current() != tc.current || session.Previous() != tc.previous {
+				t.Errorf(
+					"loaded states got: %s %s, expected: %s %s",
+					session.Current(), session.Previous(), tc.current, tc.previous,
+				)
+			}
+
+			page, ok, err := keyPage.Get(session)
+			if err != nil || ok != tc.data || (ok && page != 3) {
+				t.Errorf("loaded data got: %d %v %v, expected data: %v", page, ok, err, tc.data)
+			}
+		})
+	}
+}
+
+func TestSession_noopBackend(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	session := NewSession("1", NewNoopBackend(), newTestMachine(t))
+	if err := keyPage.Set(session, 1); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	if err := session.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	if err := session.Load(ctx); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if session.Current() != Default {
+		t.Errorf("current got: %s, expected: %s", session.Current(), Default)
+	}
+
+	if _, ok, _ := keyPage.Get(session); ok {
+		t.Errorf("noop backend keeps data")
+	}
+}
+
+func TestSession_timeout(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2021, 10, 19, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name     string
+		elapsed  time.Duration
+		events   Events
+		current  StateType
+		timedOut StateType
+	}{
+		{
+			name:    "test_active",
+			elapsed: time.Minute,
+			current: stateChoice,
+		},
+		{
+			name:     "test_timed_out",
+			elapsed:  10 * time.Minute,
+			current:  Default,
+			timedOut: stateChoice,
+		},
+		{
+			name:     "test_timed_out_to_declared_state",
+			elapsed:  time.Hour,
+			events:   Events{TimeoutEvent: stateParsing},
+			current:  stateParsing,
+			timedOut: stateChoice,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			backend := NewInMemoryBackend(InMemoryConfig{})
+
+			var exited bool
+			var exitCtx EventContext
+			newMachine := func(at time.Time) *StateMachine[EventContext] {
+				machine, err := NewStateMachine(States[EventContext]{
+					Default: State[EventContext]{
+						Action: NoopAction[EventContext]{},
+						Events: Events{eventChoose: stateChoice, eventParse: stateParsing},
+					},
+					stateParsing: State[EventContext]{Action: NoopAction[EventContext]{}},
+					stateChoice: State[EventContext]{
+						Action:  NoopAction[EventContext]{},
+						Events:  tc.events,
+						Timeout: 10 * time.Minute,
+						OnExit: func(_ context.Context, eventCtx EventContext) {
+							exited = true
+							exitCtx = eventCtx
+						},
+					},
+				})
+				if err != nil {
+					t.Fatalf("new state machine: %v", err)
+				}
+
+				machine.timeFn = func() time.Time { return at }
+
+				return machine
+			}
+
+			session := NewSession("1", backend, newMachine(now))
+			if err := session.Load(ctx); err != nil {
+				t.Fatalf("load: %v", err)
+			}
+
+			if err := session.SendEvent(ctx, eventChoose, nil); err != nil {
+				t.Fatalf("send event: %v", err)
+			}
+
+			if err := session.Flush(ctx); err != nil {
+				t.Fatalf("flush: %v", err)
+			}
+
+			loaded := NewSession("1", backend, newMachine(now.Add(tc.elapsed)))
+			loaded.SetTimeoutContext("timeout")
+			if err := loaded.Load(ctx); err != nil {
+				t.Fatalf("load: %v", err)
+			}
+
+			if loaded.Current() != tc.current || loaded.TimedOut() != tc.timedOut {
+				t.Errorf(
+					"loaded session got: %s %q, expected: %s %q",
+					loaded.Current(), loaded.TimedOut(), tc.current, tc.timedOut,
+				)
+			}
+
+			if exited != (tc.timedOut != "") {
+				t.Errorf("exit hook run got: %v, expected: %v", exited, tc.timedOut != "")
+			}
+
+			if exited && exitCtx != "timeout" {
+				t.Errorf("exit hook event context got: %v, expected the timeout context", exitCtx)
+			}
+		})
+	}
+}
+
+func TestSession_conflict(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend := NewInMemoryBackend(InMemoryConfig{})
+
+	first := NewSession("1", backend, newTestMachine(t))
+	second := NewSession("1", backend, newTestMachine(t))
+	for _, s := range []*Session[EventContext]{first, second} {
+		if err := s.Load(ctx); err != nil {
+			t.Fatalf("load: %v", err)
+		}
+	}
+
+	if err := keyPage.Set(first, 1); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	if err := first.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	if err := keyPage.Set(second, 2); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	if err := second.Flush(ctx); !errors.Is(err, ErrSessionConflict) {
+		t.Fatalf("flush of a stale session got: %v, expected: %v", err, ErrSessionConflict)
+	}
+
+	// the caller reloads the session and retries
+	if err := second.Load(ctx); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if page, _, _ := keyPage.Get(second); page != 1 {
+		t.Errorf("reloaded page got: %d, expected: %d", page, 1)
+	}
+
+	if err := keyPage.Set(second, 2); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	if err := second.Flush(ctx); err != nil {
+		t.Fatalf("flush of a reloaded session: %v", err)
+	}
+
+	// a session flushed twice keeps its own version
+	if err := second.Flush(ctx); err != nil {
+		t.Errorf("second flush: %v", err)
+	}
+}
+
+func TestSession_history(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend := NewInMemoryBackend(InMemoryConfig{})
+
+	var log []string
+	session := NewSession("1", backend, newNestedMachine(t, &log))
+	if err := session.Load(ctx); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	for _, event := range []EventType{eventSettings, eventQuality} {
+		if err := session.SendEvent(ctx, event, nil); err != nil {
+			t.Fatalf("send event: %v", err)
+		}
+	}
+
+	if err := session.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	loaded := NewSession("1", backend, newNestedMachine(t, &log))
+	if err := loaded.Load(ctx); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	expected := []StateType{Default, stateLanguage}
+	if history := loaded.History(); !reflect.DeepEqual(history, expected) {
+		t.Fatalf("loaded history got: %v, expected: %v", history, expected)
+	}
+
+	for _, expected := range []StateType{stateLanguage, Default} {
+		if err := loaded.SendEvent(ctx, BackEvent, nil); err != nil {
+			t.Fatalf("send back event: %v", err)
+		}
+
+		if loaded.Current() != expected {
+			t.Errorf("current after back got: %s, expected: %s", loaded.Current(), expected)
+		}
+	}
+}
+
+func newTestMachine(t *testing.T) *StateMachine[EventContext] {
+	t.Helper()
+
+	machine, err := NewStateMachine(States[EventContext]{Default: State[EventContext]{Action: NoopAction[EventContext]{}}})
+	if err != nil {
+		t.Fatalf("new state machine: %v", err)
+	}
+
+	return machine
+}
+
+func TestSession_timeoutWithoutEnteredAt(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Date(2021, 10, 19, 12, 0, 0, 0, time.UTC)
+	backend := NewInMemoryBackend(InMemoryConfig{})
+
+	// a session stored before the entered time was recorded
+	encoded, err := json.Marshal(StateEncoded{Version: SessionVersion, Current: stateChoice})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	if err = backend.Set(ctx, "1", encoded); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	newSession := func(at time.Time) *Session[EventContext] {
+		machine, err := NewStateMachine(States[EventContext]{
+			Default: State[EventContext]{Action: NoopAction[EventContext]{}, Events: Events{eventChoose: stateChoice}},
+			stateChoice: State[EventContext]{
+				Action:  NoopAction[EventContext]{},
+				Timeout: 10 * time.Minute,
+			},
+		})
+		if err != nil {
+			t.Fatalf("new state machine: %v", err)
+		}
+
+		machine.timeFn = func() time.Time { return at }
+
+		return NewSession("1", backend, machine)
+	}
+
+	session := newSession(now)
+	if err = session.Load(ctx); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if session.Current() != stateChoice || session.TimedOut() != "" {
+		t.Fatalf("first load got: %s %q, expected: %s", session.Current(), session.TimedOut(), stateChoice)
+	}
+
+	if err = session.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	loaded := newSession(now.Add(time.Hour))
+	if err = loaded.Load(ctx); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if loaded.Current() != Default || loaded.TimedOut() != stateChoice {
+		t.Errorf(
+			"later load got: %s %q, expected: %s %q", loaded.Current(), loaded.TimedOut(), Default, stateChoice,
+		)
+	}
+}
@@ -0,0 +1,147 @@
+package botstate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	ErrMissingDefault   = errors.New("missing default state")
+	ErrUnknownTarget    = errors.New("transition to an unknown state")
+	ErrUnreachableState = errors.New("unreachable state")
+	ErrNilAction        = errors.New("state without action")
+	ErrUnknownParent    = errors.New("unknown parent state")
+	ErrParentCycle      = errors.New("cycle of parent states")
+)
+
+// Validate checks that the machine starts in Default, every transition leads to a declared state,
+// every state has an action and a declared parent not nested in itself and can be reached from Default, unless
+// it is the parent of other states. It returns all problems found joined
+func (s States[C]) Validate() error {
+	var errs []error
+	if _, ok := s[Default]; !ok {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrMissingDefault, Default))
+	}
+
+	for _, name := range s.names() {
+		state := s[name]
+		if state.Action == nil {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrNilAction, name))
+		}
+
+		if state.Parent != "" {
+			chain := s.ancestors(name)
+			top := s[chain[len(chain)-1]]
+			switch {
+			case !s.declared(state.Parent):
+				errs = append(errs, fmt.Errorf("%w: %s of %s", ErrUnknownParent, state.Parent, name))
+			case top.Parent != "" && s.declared(top.Parent):
+				errs = append(errs, fmt.Errorf("%w: %s", ErrParentCycle, name))
+			}
+		}
+
+		for _, event := range state.events() {
+			if _, ok := s[state.Events[event]]; !ok {
+				errs = append(
+					errs, fmt.Errorf("%w: %s -%s-> %s", ErrUnknownTarget, name, event, state.Events[event]),
+				)
+			}
+		}
+	}
+
+	if _, ok := s[Default]; ok {
+		reachable := s.reachable()
+		parents := s.parents()
+		for _, name := range s.names() {
+			if !reachable[name] && !parents[name] {
+				errs = append(errs, fmt.Errorf("%w: %s", ErrUnreachableState, name))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// reachable returns the states the machine can get to from Default
+func (s States[C]) reachable() map[StateType]bool {
+	reachable := map[StateType]bool{Default: true}
+	queue := []StateType{Default}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		for _, target := range s.targets(name) {
+			if _, ok := s[target]; ok && !reachable[target] {
+				reachable[target] = true
+				queue = append(queue, target)
+			}
+		}
+	}
+
+	return reachable
+}
+
+// names returns the names of the states sorted, Default first
+func (s States[C]) names() []StateType {
+	names := make([]StateType, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == Default) != (names[j] == Default) {
+			return names[i] == Default
+		}
+
+		return names[i] < names[j]
+	})
+
+	return names
+}
+
+// events returns the events of the state sorted
+func (s State[C]) events() []EventType {
+	events := make([]EventType, 0, len(s.Events))
+	for event := range s.Events {
+		events = append(events, event)
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i] < events[j] })
+
+	return events
+}
+
+// targets returns the states the state moves to, the inherited and implicit timeout transitions included
+func (s States[C]) targets(name StateType) []StateType {
+	events := s.events(name)
+	targets := make([]StateType, 0, len(events)+1)
+	for _, event := range events {
+		target, _ := s.resolve(name, event)
+		targets = append(targets, target)
+	}
+
+	if _, ok := s.resolve(name, TimeoutEvent); !ok && s[name].Timeout > 0 {
+		targets = append(targets, Default)
+	}
+
+	return targets
+}
+
+// parents returns the states other states are nested in
+func (s States[C]) parents() map[StateType]bool {
+	parents := make(map[StateType]bool)
+	for _, state := range s {
+		if state.Parent != "" {
+			parents[state.Parent] = true
+		}
+	}
+
+	return parents
+}
+
+func (s States[C]) declared(name StateType) bool {
+	_, ok := s[name]
+
+	return ok
+}
@@ -0,0 +1,162 @@
+package botstate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStates_Validate(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		states   States[EventContext]
+		expected []error
+	}{
+		{
+			name: "test_valid",
+			states: States[EventContext]{
+				Default:      State[EventContext]{Action: NoopAction[EventContext]{}, Events: Events{eventParse: stateParsing}},
+				stateParsing: State[EventContext]{Action: NoopAction[EventContext]{}, Events: Events{eventReset: Default}},
+			},
+		},
+		{
+			name: "test_reached_by_timeout_only",
+			states: States[EventContext]{
+				Default:      State[EventContext]{Action: NoopAction[EventContext]{}, Events: Events{eventParse: stateParsing}},
+				stateParsing: State[EventContext]{Action: NoopAction[EventContext]{}, Events: Events{TimeoutEvent: stateChoice}, Timeout: time.Minute},
+				stateChoice:  State[EventContext]{Action: NoopAction[EventContext]{}},
+			},
+		},
+		{
+			name:     "test_missing_default",
+			states:   States[EventContext]{stateParsing: State[EventContext]{Action: NoopAction[EventContext]{}}},
+			expected: []error{ErrMissingDefault},
+		},
+		{
+			name: "test_unknown_target",
+			states: States[EventContext]{
+				Default: State[EventContext]{Action: NoopAction[EventContext]{}, Events: Events{eventParse: stateParsing}},
+			},
+			expected: []error{ErrUnknownTarget},
+		},
+		{
+			name: "test_unreachable",
+			states: States[EventContext]{
+				Default:     State[EventContext]{Action: NoopAction[EventContext]{}},
+				stateChoice: State[EventContext]{Action: NoopAction[EventContext]{}, Events: Events{eventReset: Default}},
+			},
+			expected: []error{ErrUnreachableState},
+		},
+		{
+			name: "test_nil_action",
+			states: States[EventContext]{
+				Default:      State[EventContext]{Action: NoopAction[EventContext]{}, Events: Events{eventParse: stateParsing}},
+				stateParsing: State[EventContext]{},
+			},
+			expected: []error{ErrNilAction},
+		},
+		{
+			name: "test_parent_not_reached",
+			states: States[EventContext]{
+				Default:       {Action: NoopAction[EventContext]{}, Events: Events{eventParse: stateParsing}},
+				stateSettings: {Action: NoopAction[EventContext]{}, Events: Events{eventReset: Default}},
+				stateParsing:  {Action: NoopAction[EventContext]{}, Parent: stateSettings},
+			},
+		},
+		{
+			name: "test_unknown_parent",
+			states: States[EventContext]{
+				Default:      {Action: NoopAction[EventContext]{}, Events: Events{eventParse: stateParsing}},
+				stateParsing: {Action: NoopAction[EventContext]{}, Parent: stateSettings},
+			},
+			expected: []error{ErrUnknownParent},
+		},
+		{
+			name: "test_parent_cycle",
+			states: States[EventContext]{
+				Default:       {Action: NoopAction[EventContext]{}, Events: Events{eventParse: stateParsing}},
+				stateParsing:  {Action: NoopAction[EventContext]{}, Parent: stateSettings},
+				stateSettings: {Action: NoopAction[EventContext]{}, Parent: stateParsing},
+			},
+			expected: []error{ErrParentCycle},
+		},
+		{
+			name: "test_all_problems",
+			states: States[EventContext]{
+				stateParsing: State[EventContext]{Events: Events{eventChoose: stateChoice}},
+			},
+			expected: []error{ErrMissingDefault, ErrNilAction, ErrUnknownTarget},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			err := tc.states.Validate()
+			if len(tc.expected) == 0 && err != nil {
+				t.Fatalf("Validate got: %v, expected: nil", err)
+			}
+
+			for _, expected := range tc.expected {
+				if !errors.Is(err, expected) {
+					t.Errorf("Validate got: %v, expected: %v", err, expected)
+				}
+			}
+
+			if _, newErr := NewStateMachine(tc.states); (newErr != nil) != (err != nil) {
+				t.Errorf("NewStateMachine got: %v, expected the error of Validate: %v", newErr, err)
+			}
+		})
+	}
+}
+
+func TestStates_export(t *testing.T) {
+	t.Parallel()
+
+	states := States[EventContext]{
+		Default: {
+			Action: NoopAction[EventContext]{},
+			Events: Events{eventParse: stateParsing},
+			Guards: Guards[EventContext]{eventParse: func(context.Context, EventContext) error { return nil }},
+		},
+		stateSettings: {Action: NoopAction[EventContext]{}, Events: Events{eventReset: Default}},
+		stateParsing: {
+			Action:  NoopAction[EventContext]{},
+			Parent:  stateSettings,
+			Events:  Events{eventChoose: stateParsing},
+			Timeout: time.Minute,
+		},
+	}
+
+	dot := `digraph fsm {
+	rankdir=LR;
+	"init" [shape=doublecircle];
+	"parsing" [shape=box];
+	"settings" [shape=box];
+	"init" -> "parsing" [label="parse [guarded]"];
+	"parsing" -> "parsing" [label="choose"];
+	"parsing" -> "init" [label="reset"];
+	"parsing" -> "init" [label="timeout"];
+	"settings" -> "init" [label="reset"];
+}
+`
+	if got := states.DOT(); got != dot {
+		t.Errorf("DOT got:\n%s\nexpected:\n%s", got, dot)
+	}
+
+	mermaid := `stateDiagram-v2
+	[*] --> init
+	init --> parsing: parse [guarded]
+	parsing --> parsing: choose
+	parsing --> init: reset
+	parsing --> init: timeout
+	settings --> init: reset
+`
+	if got := states.Mermaid(); got != mermaid {
+		t.Errorf("Mermaid got:\n%s\nexpected:\n%s", got, mermaid)
+	}
+}
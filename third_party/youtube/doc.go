@@ -0,0 +1,4 @@
+/*
+Package youtube implement youtube download package in go.
+*/
+package youtube
@@ -0,0 +1,8 @@
+module github.com/kkdai/youtube/v2
+
+go 1.16
+
+require (
+	github.com/bitly/go-simplejson v0.5.0
+	golang.org/x/net v0.0.0-20210614182718-04defd469f4e
+)